@@ -174,3 +174,19 @@ static uint16_t csum_inet_digest(struct csum_inet* csum)
 	return ~csum->acc;
 }
 #endif
+
+#if defined(SYZ_EXECUTOR) || defined(SYZ_USE_CRC32_CHECKSUMS)
+// poly is in reversed form, e.g. 0xedb88320 for crc32 and 0x82f63b78 for crc32c.
+static uint32_t csum_crc32(const uint8_t* data, size_t length, uint32_t poly)
+{
+	uint32_t crc = 0xffffffff;
+	size_t i;
+	for (i = 0; i < length; i++) {
+		crc ^= data[i];
+		int bit;
+		for (bit = 0; bit < 8; bit++)
+			crc = (crc & 1) ? (crc >> 1) ^ poly : crc >> 1;
+	}
+	return ~crc;
+}
+#endif
@@ -34,6 +34,18 @@ const int kMaxCommands = 1000;
 const uint64_t instr_eof = -1;
 const uint64_t instr_copyin = -2;
 const uint64_t instr_copyout = -3;
+const uint64_t instr_batch_sep = -4;
+const uint64_t instr_copyin_fill = -6;
+const uint64_t instr_header = -15;
+const uint64_t instr_call_timeout = -16;
+const uint64_t instr_call_props = -20;
+
+// Header of programs serialized with prog.ExecOpts.EmitHeader.
+const uint64_t exec_format_magic = 0x53595a45;
+const uint64_t exec_format_version = 1;
+const uint64_t exec_flag_big_endian = 1 << 4;
+const uint64_t exec_flag_varint = 1 << 6;
+const uint64_t exec_flags_supported = exec_flag_big_endian | exec_flag_varint;
 
 const uint64_t arg_const = 0;
 const uint64_t arg_result = 1;
@@ -76,6 +88,9 @@ bool collide;
 ALIGNED(64 << 10)
 char input_data[kMaxInput];
 
+// Words of the program are varints (prog.ExecOpts.Varint) rather than 8-byte values.
+bool input_varint;
+
 // We use the default value instead of results of failed syscalls.
 // -1 is an invalid fd and an invalid address and deterministic,
 // so good enough for our purposes.
@@ -83,6 +98,7 @@ const uint64_t default_value = -1;
 
 // Checksum kinds.
 const uint64_t arg_csum_inet = 0;
+const uint64_t arg_csum_crc32 = 1;
 
 // Checksum chunk kinds.
 const uint64_t arg_csum_chunk_data = 0;
@@ -100,7 +116,8 @@ struct thread_t {
 
 	event_t ready;
 	event_t done;
-	uint64_t* copyout_pos;
+	uint8_t* copyout_pos;
+	bool copyout_varint;
 	uint64_t copyout_index;
 	bool handled;
 	int call_index;
@@ -174,16 +191,16 @@ struct kcov_comparison_t {
 };
 
 long execute_syscall(call_t* c, long a0, long a1, long a2, long a3, long a4, long a5, long a6, long a7, long a8);
-thread_t* schedule_call(int call_index, int call_num, uint64_t copyout_index, uint64_t num_args, uint64_t* args, uint64_t* pos);
+thread_t* schedule_call(int call_index, int call_num, uint64_t copyout_index, uint64_t num_args, uint64_t* args, uint8_t* pos);
 void handle_completion(thread_t* th);
 void execute_call(thread_t* th);
 void thread_create(thread_t* th, int id);
 void* worker_thread(void* arg);
 uint32_t* write_output(uint32_t v);
 void write_completed(uint32_t completed);
-uint64_t read_input(uint64_t** input_posp, bool peek = false);
-uint64_t read_arg(uint64_t** input_posp);
-uint64_t read_result(uint64_t** input_posp);
+uint64_t read_input(uint8_t** input_posp, bool peek = false, bool varint = input_varint);
+uint64_t read_arg(uint8_t** input_posp);
+uint64_t read_result(uint8_t** input_posp);
 void copyin(char* addr, uint64_t val, uint64_t size, uint64_t bf_off, uint64_t bf_len);
 uint64_t copyout(char* addr, uint64_t size);
 void cover_open();
@@ -295,17 +312,30 @@ void reply_execute(int status)
 void execute_one()
 {
 retry:
-	uint64_t* input_pos = (uint64_t*)input_data;
+	uint8_t* input_pos = (uint8_t*)input_data;
+	input_varint = false;
 	write_output(0); // Number of executed syscalls (updated later).
 
 	if (!collide && !flag_threaded)
 		cover_enable(&threads[0]);
 
 	int call_index = 0;
+	uint64_t call_timeout_ms = 0;
 	for (;;) {
 		uint64_t call_num = read_input(&input_pos);
 		if (call_num == instr_eof)
 			break;
+		if (call_num == instr_header) {
+			// The header is always an 8-byte word, it may switch the rest of the program to varints.
+			uint64_t header = read_input(&input_pos);
+			uint64_t flags = header & 0xffff;
+			if (header >> 32 != exec_format_magic || ((header >> 16) & 0xffff) != exec_format_version)
+				fail("bad exec format header 0x%llx", header);
+			if (flags & ~exec_flags_supported)
+				fail("unsupported exec format flags 0x%llx", flags);
+			input_varint = flags & exec_flag_varint;
+			continue;
+		}
 		if (call_num == instr_copyin) {
 			char* addr = (char*)read_input(&input_pos);
 			uint64_t typ = read_input(&input_pos);
@@ -314,6 +344,14 @@ retry:
 			switch (typ) {
 			case arg_const: {
 				uint64_t arg = read_input(&input_pos);
+				if (size == 16) {
+					// 16-byte values are passed as low and high words.
+					uint64_t arg_high = read_input(&input_pos);
+					read_input(&input_pos); // bit field offset
+					read_input(&input_pos); // bit field length
+					NONFAILING(*(uint64_t*)addr = arg; *(uint64_t*)(addr + 8) = arg_high);
+					break;
+				}
 				uint64_t bf_off = read_input(&input_pos);
 				uint64_t bf_len = read_input(&input_pos);
 				copyin(addr, arg, size, bf_off, bf_len);
@@ -325,10 +363,11 @@ retry:
 				break;
 			}
 			case arg_data: {
+				if (size > (uint64_t)(input_data + kMaxInput - (char*)input_pos))
+					fail("data arg overflows input");
 				NONFAILING(memcpy(addr, input_pos, size));
-				// Read out the data.
-				for (uint64_t i = 0; i < (size + 7) / 8; i++)
-					read_input(&input_pos);
+				// Read out the data, it is padded to 8 bytes only without varints.
+				input_pos += input_varint ? size : (size + 7) / 8 * 8;
 				break;
 			}
 			case arg_csum: {
@@ -372,6 +411,20 @@ retry:
 					copyin(csum_addr, csum_value, 2, 0, 0);
 					break;
 				}
+				case arg_csum_crc32: {
+					if (csum_size != 4) {
+						fail("crc32 checksum must be 4 bytes, not %lu", size);
+					}
+					uint64_t data_addr = read_input(&input_pos);
+					uint64_t data_size = read_input(&input_pos);
+					uint64_t poly = read_input(&input_pos);
+					debug("calculating crc32 checksum for %llx:%llu, poly %llx\n", data_addr, data_size, poly);
+					uint32_t csum_value = 0;
+					NONFAILING(csum_value = csum_crc32((const uint8_t*)data_addr, data_size, poly));
+					debug("writing crc32 checksum %x to %llx\n", csum_value, csum_addr);
+					copyin(csum_addr, csum_value, 4, 0, 0);
+					break;
+				}
 				default:
 					fail("bad checksum kind %lu", csum_kind);
 				}
@@ -382,6 +435,36 @@ retry:
 			}
 			continue;
 		}
+		if (call_num == instr_copyin_fill) {
+			char* addr = (char*)read_input(&input_pos);
+			uint64_t size = read_input(&input_pos);
+			uint64_t val = read_input(&input_pos);
+			debug("copyin fill to %p\n", addr);
+			NONFAILING(memset(addr, val, size));
+			continue;
+		}
+		if (call_num == instr_batch_sep) {
+			// Next program in the batch must not see results of the previous one.
+			memset(results, 0, sizeof(results));
+			// It starts with 8-byte words, its header may switch to varints.
+			input_varint = false;
+			continue;
+		}
+		if (call_num == instr_call_timeout) {
+			// Timeout of the next call, used in threaded mode only,
+			// since otherwise a hanging call blocks the whole program anyway.
+			call_timeout_ms = read_input(&input_pos);
+			continue;
+		}
+		if (call_num == instr_call_props) {
+			// Properties of the next call are optional hints, none of them are supported yet.
+			uint64_t num_props = read_input(&input_pos);
+			for (uint64_t i = 0; i < num_props; i++) {
+				read_input(&input_pos); // key
+				read_input(&input_pos); // value
+			}
+			continue;
+		}
 		if (call_num == instr_copyout) {
 			read_input(&input_pos); // index
 			read_input(&input_pos); // addr
@@ -403,6 +486,11 @@ retry:
 		for (uint64_t i = num_args; i < 6; i++)
 			args[i] = 0;
 		thread_t* th = schedule_call(call_index++, call_num, copyout_index, num_args, args, input_pos);
+		uint64_t timeout_ms = flag_debug ? 500 : 20;
+		if (call_timeout_ms != 0) {
+			timeout_ms = call_timeout_ms;
+			call_timeout_ms = 0;
+		}
 
 		if (collide && (call_index % 2) == 0) {
 			// Don't wait for every other call.
@@ -410,8 +498,9 @@ retry:
 		} else if (flag_threaded) {
 			// Wait for call completion.
 			// Note: sys knows about this 20ms timeout when it generates
-			// timespec/timeval values.
-			const uint64_t timeout_ms = flag_debug ? 500 : 20;
+			// timespec/timeval values. Calls with a timeout in descriptions
+			// are given the specified time, after that the call is left hanging
+			// in its thread and the program continues.
 			if (event_timedwait(&th->done, timeout_ms))
 				handle_completion(th);
 			// Check if any of previous calls have completed.
@@ -444,7 +533,7 @@ retry:
 	}
 }
 
-thread_t* schedule_call(int call_index, int call_num, uint64_t copyout_index, uint64_t num_args, uint64_t* args, uint64_t* pos)
+thread_t* schedule_call(int call_index, int call_num, uint64_t copyout_index, uint64_t num_args, uint64_t* args, uint8_t* pos)
 {
 	// Find a spare thread to execute the call.
 	int i;
@@ -466,6 +555,7 @@ thread_t* schedule_call(int call_index, int call_num, uint64_t copyout_index, ui
 		fail("bad thread state in schedule: ready=%d done=%d handled=%d",
 		     event_isset(&th->ready), event_isset(&th->done), th->handled);
 	th->copyout_pos = pos;
+	th->copyout_varint = input_varint;
 	th->copyout_index = copyout_index;
 	event_reset(&th->done);
 	th->handled = false;
@@ -493,12 +583,14 @@ void handle_completion(thread_t* th)
 			results[th->copyout_index].val = th->res;
 		}
 		for (bool done = false; !done;) {
-			uint64_t instr = read_input(&th->copyout_pos);
+			// The main thread may have moved on to the next program in the batch
+			// that uses different encoding, so use the encoding of the call.
+			uint64_t instr = read_input(&th->copyout_pos, false, th->copyout_varint);
 			switch (instr) {
 			case instr_copyout: {
-				uint64_t index = read_input(&th->copyout_pos);
-				char* addr = (char*)read_input(&th->copyout_pos);
-				uint64_t size = read_input(&th->copyout_pos);
+				uint64_t index = read_input(&th->copyout_pos, false, th->copyout_varint);
+				char* addr = (char*)read_input(&th->copyout_pos, false, th->copyout_varint);
+				uint64_t size = read_input(&th->copyout_pos, false, th->copyout_varint);
 				uint64_t val = copyout(addr, size);
 				if (index >= kMaxCommands)
 					fail("result idx %ld overflows kMaxCommands", index);
@@ -722,7 +814,7 @@ uint64_t copyout(char* addr, uint64_t size)
 	return res;
 }
 
-uint64_t read_arg(uint64_t** input_posp)
+uint64_t read_arg(uint8_t** input_posp)
 {
 	uint64_t typ = read_input(input_posp);
 	uint64_t size = read_input(input_posp);
@@ -746,7 +838,7 @@ uint64_t read_arg(uint64_t** input_posp)
 	return arg;
 }
 
-uint64_t read_result(uint64_t** input_posp)
+uint64_t read_result(uint8_t** input_posp)
 {
 	uint64_t idx = read_input(input_posp);
 	uint64_t op_div = read_input(input_posp);
@@ -763,14 +855,32 @@ uint64_t read_result(uint64_t** input_posp)
 	return arg;
 }
 
-uint64_t read_input(uint64_t** input_posp, bool peek)
+uint64_t read_input(uint8_t** input_posp, bool peek, bool varint)
 {
-	uint64_t* input_pos = *input_posp;
-	if ((char*)input_pos >= input_data + kMaxInput)
-		fail("input command overflows input");
+	uint8_t* input_pos = *input_posp;
+	uint64_t v = 0;
+	if (!varint) {
+		if ((char*)input_pos + sizeof(v) > input_data + kMaxInput)
+			fail("input command overflows input");
+		memcpy(&v, input_pos, sizeof(v));
+		input_pos += sizeof(v);
+	} else {
+		// Zigzag LEB128 as written by Go binary.PutVarint.
+		for (int shift = 0;; shift += 7) {
+			if ((char*)input_pos >= input_data + kMaxInput)
+				fail("input command overflows input");
+			if (shift >= 64)
+				fail("varint overflows uint64");
+			uint8_t b = *input_pos++;
+			v |= (uint64_t)(b & 0x7f) << shift;
+			if (!(b & 0x80))
+				break;
+		}
+		v = (v >> 1) ^ -(v & 1);
+	}
 	if (!peek)
-		*input_posp = input_pos + 1;
-	return *input_pos;
+		*input_posp = input_pos;
+	return v;
 }
 
 void kcov_comparison_t::write()
@@ -2,7 +2,7 @@
 
 #if defined(__i386__) || 0
 #define GOARCH "386"
-#define SYZ_REVISION "fd39559cec7e0bf3b73161acf9105976b4e778d6"
+#define SYZ_REVISION "ca4f8241037dd88b06bbaa3175bdfbb68e9f87a8"
 #define __NR_syz_emit_ethernet 1000000
 #define __NR_syz_extract_tcp_res 1000001
 #define __NR_syz_fuse_mount 1000002
@@ -1467,7 +1467,7 @@ call_t syscalls[] = {
 
 #if defined(__x86_64__) || 0
 #define GOARCH "amd64"
-#define SYZ_REVISION "20b754ebbf859e5765e0f3d5f2e5c9cd0468304c"
+#define SYZ_REVISION "39de1838e4aaa731855ea18a1024995271c0f66e"
 #define __NR_syz_emit_ethernet 1000000
 #define __NR_syz_extract_tcp_res 1000001
 #define __NR_syz_fuse_mount 1000002
@@ -2993,7 +2993,7 @@ call_t syscalls[] = {
 
 #if defined(__arm__) || 0
 #define GOARCH "arm"
-#define SYZ_REVISION "22274c8a0815d6ce80b34c051e8074163b988754"
+#define SYZ_REVISION "38a9e9ac042b8a58d60142548d75e3d918759914"
 #define __NR_syz_emit_ethernet 1000000
 #define __NR_syz_extract_tcp_res 1000001
 #define __NR_syz_fuse_mount 1000002
@@ -4468,7 +4468,7 @@ call_t syscalls[] = {
 
 #if defined(__aarch64__) || 0
 #define GOARCH "arm64"
-#define SYZ_REVISION "f5bf5c05890ab70b1ea1b1029f18449ac7b4b6a2"
+#define SYZ_REVISION "57199e926a51607b612d754eed7515e1349f3dc2"
 #define __NR_syz_emit_ethernet 1000000
 #define __NR_syz_extract_tcp_res 1000001
 #define __NR_syz_fuse_mount 1000002
@@ -5923,7 +5923,7 @@ call_t syscalls[] = {
 
 #if defined(__ppc64__) || defined(__PPC64__) || defined(__powerpc64__) || 0
 #define GOARCH "ppc64le"
-#define SYZ_REVISION "afc4844915d998b5b3b4659b741b83b54e797d06"
+#define SYZ_REVISION "23ed3d0e6bfd93ad54b380fd7bf626d5df8d5ab9"
 #define __NR_syz_emit_ethernet 1000000
 #define __NR_syz_extract_tcp_res 1000001
 #define __NR_syz_fuse_mount 1000002
@@ -2,10 +2,10 @@
 
 #if 0
 #define GOARCH "32"
-#define SYZ_REVISION "79ae2d829892c1b024cfea6076725a13e0ada442"
+#define SYZ_REVISION "c6cd27a55d7a82651c7cbbcc0e1f1dcd38502e3c"
 #define __NR_syz_test 1000000
 
-unsigned syscall_count = 76;
+unsigned syscall_count = 84;
 call_t syscalls[] = {
 	{"mmap", 0, (syscall_t)mmap},
 	{"mutate0", 0, (syscall_t)mutate0},
@@ -30,17 +30,23 @@ call_t syscalls[] = {
 	{"syz_test$array2", 1000000, (syscall_t)syz_test},
 	{"syz_test$bf0", 1000000, (syscall_t)syz_test},
 	{"syz_test$bf1", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_alias", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_crc32c", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_encode", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv4", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_ipv4_options", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv4_tcp", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_ipv4_tcp_kind", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv4_udp", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv6_icmp", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv6_tcp", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv6_udp", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_ipv6_udp_kind", 1000000, (syscall_t)syz_test},
 	{"syz_test$end0", 1000000, (syscall_t)syz_test},
 	{"syz_test$end1", 1000000, (syscall_t)syz_test},
 	{"syz_test$hint_data", 1000000, (syscall_t)syz_test},
 	{"syz_test$int", 1000000, (syscall_t)syz_test},
+	{"syz_test$int128", 1000000, (syscall_t)syz_test},
 	{"syz_test$length0", 1000000, (syscall_t)syz_test},
 	{"syz_test$length1", 1000000, (syscall_t)syz_test},
 	{"syz_test$length10", 1000000, (syscall_t)syz_test},
@@ -74,6 +80,8 @@ call_t syscalls[] = {
 	{"syz_test$regression2", 1000000, (syscall_t)syz_test},
 	{"syz_test$res0", 1000000, (syscall_t)syz_test},
 	{"syz_test$res1", 1000000, (syscall_t)syz_test},
+	{"syz_test$res2", 1000000, (syscall_t)syz_test},
+	{"syz_test$res3", 1000000, (syscall_t)syz_test},
 	{"syz_test$struct", 1000000, (syscall_t)syz_test},
 	{"syz_test$text_x86_16", 1000000, (syscall_t)syz_test},
 	{"syz_test$text_x86_32", 1000000, (syscall_t)syz_test},
@@ -89,10 +97,10 @@ call_t syscalls[] = {
 
 #if 0
 #define GOARCH "64"
-#define SYZ_REVISION "b1c83c04183eb27b5158df59d58c510efb35257d"
+#define SYZ_REVISION "9098ed13d957b90c3f9b6398344066285fa30089"
 #define __NR_syz_test 1000000
 
-unsigned syscall_count = 76;
+unsigned syscall_count = 84;
 call_t syscalls[] = {
 	{"mmap", 0, (syscall_t)mmap},
 	{"mutate0", 0, (syscall_t)mutate0},
@@ -117,17 +125,23 @@ call_t syscalls[] = {
 	{"syz_test$array2", 1000000, (syscall_t)syz_test},
 	{"syz_test$bf0", 1000000, (syscall_t)syz_test},
 	{"syz_test$bf1", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_alias", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_crc32c", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_encode", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv4", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_ipv4_options", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv4_tcp", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_ipv4_tcp_kind", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv4_udp", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv6_icmp", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv6_tcp", 1000000, (syscall_t)syz_test},
 	{"syz_test$csum_ipv6_udp", 1000000, (syscall_t)syz_test},
+	{"syz_test$csum_ipv6_udp_kind", 1000000, (syscall_t)syz_test},
 	{"syz_test$end0", 1000000, (syscall_t)syz_test},
 	{"syz_test$end1", 1000000, (syscall_t)syz_test},
 	{"syz_test$hint_data", 1000000, (syscall_t)syz_test},
 	{"syz_test$int", 1000000, (syscall_t)syz_test},
+	{"syz_test$int128", 1000000, (syscall_t)syz_test},
 	{"syz_test$length0", 1000000, (syscall_t)syz_test},
 	{"syz_test$length1", 1000000, (syscall_t)syz_test},
 	{"syz_test$length10", 1000000, (syscall_t)syz_test},
@@ -161,6 +175,8 @@ call_t syscalls[] = {
 	{"syz_test$regression2", 1000000, (syscall_t)syz_test},
 	{"syz_test$res0", 1000000, (syscall_t)syz_test},
 	{"syz_test$res1", 1000000, (syscall_t)syz_test},
+	{"syz_test$res2", 1000000, (syscall_t)syz_test},
+	{"syz_test$res3", 1000000, (syscall_t)syz_test},
 	{"syz_test$struct", 1000000, (syscall_t)syz_test},
 	{"syz_test$text_x86_16", 1000000, (syscall_t)syz_test},
 	{"syz_test$text_x86_32", 1000000, (syscall_t)syz_test},
@@ -159,6 +159,30 @@ extern "C" int test_csum_inet()
 	return 0;
 }
 
+extern "C" int test_csum_crc32()
+{
+	struct {
+		const char* data;
+		size_t length;
+		uint32_t poly;
+		uint32_t csum;
+	} tests[] = {
+	    {"", 0, 0xedb88320, 0},
+	    {"123456789", 9, 0xedb88320, 0xcbf43926},
+	    {"123456789", 9, 0x82f63b78, 0xe3069283},
+	    {"\x00\x00\x00\x00", 4, 0x82f63b78, 0x48674bc7},
+	};
+
+	for (unsigned i = 0; i < ARRAY_SIZE(tests); i++) {
+		uint32_t csum = csum_crc32((const uint8_t*)tests[i].data, tests[i].length, tests[i].poly);
+		if (csum != tests[i].csum) {
+			fprintf(stderr, "bad crc32 checksum in test #%u, want: %x, got: %x\n", i, tests[i].csum, csum);
+			return 1;
+		}
+	}
+	return 0;
+}
+
 int randInt(int start, int end)
 {
 	return rand() % (end + 1 - start) + start;
@@ -29,6 +29,10 @@ func TestCsumInetAcc(t *testing.T) {
 	testWrapper(t, testCsumInetAcc)
 }
 
+func TestCsumCrc32(t *testing.T) {
+	testWrapper(t, testCsumCrc32)
+}
+
 func TestKVM(t *testing.T) {
 	testWrapper(t, testKVM)
 }
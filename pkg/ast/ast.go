@@ -87,6 +87,7 @@ type Call struct {
 	NR       uint64
 	Args     []*Field
 	Ret      *Type
+	Attrs    []*Ident
 }
 
 func (n *Call) Info() (Pos, string, string) {
@@ -80,6 +80,10 @@ func (n *Call) clone() Node {
 	if n.Ret != nil {
 		ret = n.Ret.clone()
 	}
+	var attrs []*Ident
+	for _, a := range n.Attrs {
+		attrs = append(attrs, a.clone())
+	}
 	return &Call{
 		Pos:      n.Pos,
 		Name:     n.Name.clone(),
@@ -87,6 +91,7 @@ func (n *Call) clone() Node {
 		NR:       n.NR,
 		Args:     args,
 		Ret:      ret,
+		Attrs:    attrs,
 	}
 }
 
@@ -258,9 +258,16 @@ func (p *parser) parseCall(name *Ident) *Call {
 		p.tryConsume(tokComma)
 	}
 	p.consume(tokRParen)
-	if p.tok != tokNewLine {
+	if p.tok != tokNewLine && p.tok != tokLBrack {
 		c.Ret = p.parseType()
 	}
+	if p.tryConsume(tokLBrack) {
+		c.Attrs = append(c.Attrs, p.parseIdent())
+		for p.tryConsume(tokComma) {
+			c.Attrs = append(c.Attrs, p.parseIdent())
+		}
+		p.consume(tokRBrack)
+	}
 	return c
 }
 
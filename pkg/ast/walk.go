@@ -40,6 +40,9 @@ func WalkNode(n0 Node, cb func(n Node)) {
 		if n.Ret != nil {
 			WalkNode(n.Ret, cb)
 		}
+		for _, a := range n.Attrs {
+			WalkNode(a, cb)
+		}
 	case *Struct:
 		WalkNode(n.Name, cb)
 		for _, f := range n.Fields {
@@ -161,6 +161,7 @@ func (comp *compiler) checkTypes() {
 			if n.Ret != nil {
 				comp.checkType(n.Ret, true, true, false, false)
 			}
+			comp.parseCallAttrs(n)
 		}
 	}
 }
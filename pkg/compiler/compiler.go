@@ -153,6 +153,25 @@ func (comp *compiler) parseStructAttrs(n *ast.Struct) (packed bool, align uint64
 	return
 }
 
+func (comp *compiler) parseCallAttrs(n *ast.Call) (timeout uint64) {
+	for _, attr := range n.Attrs {
+		switch {
+		case strings.HasPrefix(attr.Name, "timeout_"):
+			t, err := strconv.ParseUint(attr.Name[8:], 10, 64)
+			if err != nil || t == 0 {
+				comp.error(attr.Pos, "bad syscall %v timeout %v",
+					n.Name.Name, attr.Name[8:])
+				continue
+			}
+			timeout = t
+		default:
+			comp.error(attr.Pos, "unknown syscall %v attribute %v",
+				n.Name.Name, attr.Name)
+		}
+	}
+	return
+}
+
 func (comp *compiler) getTypeDesc(t *ast.Type) *typeDesc {
 	if desc := builtinTypes[t.Ident]; desc != nil {
 		return desc
@@ -72,6 +72,7 @@ func (comp *compiler) genSyscall(n *ast.Call) *prog.Syscall {
 		NR:       n.NR,
 		Args:     comp.genFieldArray(n.Args, prog.DirIn, true),
 		Ret:      ret,
+		Timeout:  comp.parseCallAttrs(n),
 	}
 }
 
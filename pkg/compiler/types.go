@@ -77,6 +77,18 @@ var typeInt = &typeDesc{
 	},
 }
 
+// 16-byte ints can't be passed in registers and don't support ranges and bitfields.
+var typeInt128 = &typeDesc{
+	Names: []string{"int128"},
+	Gen: func(comp *compiler, t *ast.Type, args []*ast.Type, base prog.IntTypeCommon) prog.Type {
+		base.TypeSize = 16
+		return &prog.IntType{
+			IntTypeCommon: base,
+			Kind:          prog.IntPlain,
+		}
+	},
+}
+
 var typePtr = &typeDesc{
 	Names:    []string{"ptr", "ptr64"},
 	CanBeArg: true,
@@ -299,6 +311,14 @@ var typeCsum = &typeDesc{
 		if len(args) > 2 && genCsumKind(args[1]) != prog.CsumPseudo {
 			comp.error(args[2].Pos, "only pseudo csum can have proto")
 		}
+		if kind := genCsumKind(args[1]); kind == prog.CsumCrc32 || kind == prog.CsumCrc32c {
+			// Executor stores CRC values in little-endian byte order.
+			if base.TypeSize != 4 {
+				comp.error(args[1].Pos, "%v csum must be 4 bytes", args[1].Ident)
+			} else if base.BigEndian {
+				comp.error(args[1].Pos, "%v csum must be little-endian", args[1].Ident)
+			}
+		}
 	},
 	Gen: func(comp *compiler, t *ast.Type, args []*ast.Type, base prog.IntTypeCommon) prog.Type {
 		var proto uint64
@@ -316,7 +336,7 @@ var typeCsum = &typeDesc{
 
 var typeArgCsumType = &typeArg{
 	Kind:  kindIdent,
-	Names: []string{"inet", "pseudo"},
+	Names: []string{"inet", "pseudo", "tcp", "udp", "crc32", "crc32c"},
 }
 
 func genCsumKind(t *ast.Type) prog.CsumKind {
@@ -325,6 +345,14 @@ func genCsumKind(t *ast.Type) prog.CsumKind {
 		return prog.CsumInet
 	case "pseudo":
 		return prog.CsumPseudo
+	case "tcp":
+		return prog.CsumTcp
+	case "udp":
+		return prog.CsumUdp
+	case "crc32":
+		return prog.CsumCrc32
+	case "crc32c":
+		return prog.CsumCrc32c
 	default:
 		panic(fmt.Sprintf("unknown csum kind %q", t.Ident))
 	}
@@ -652,6 +680,7 @@ var (
 func init() {
 	builtins := []*typeDesc{
 		typeInt,
+		typeInt128,
 		typePtr,
 		typeArray,
 		typeLen,
@@ -51,6 +51,9 @@ func defineList(p *prog.Prog, opts Options) ([]string, error) {
 	if prog.RequiresChecksums(p) {
 		defines = append(defines, "SYZ_USE_CHECKSUMS")
 	}
+	if prog.RequiresCrc32Checksums(p) {
+		defines = append(defines, "SYZ_USE_CRC32_CHECKSUMS")
+	}
 	switch opts.Sandbox {
 	case "":
 		// No sandbox, do nothing.
@@ -271,7 +271,10 @@ func (ctx *context) generateCalls(p prog.ExecProg) ([]string, uint64) {
 		for _, copyin := range call.Copyin {
 			switch arg := copyin.Arg.(type) {
 			case prog.ExecArgConst:
-				if arg.BitfieldOffset == 0 && arg.BitfieldLength == 0 {
+				if arg.Size == 16 {
+					fmt.Fprintf(w, "\tNONFAILING(*(uint64_t*)0x%x = 0x%x);\n", copyin.Addr, arg.Value)
+					fmt.Fprintf(w, "\tNONFAILING(*(uint64_t*)0x%x = 0x%x);\n", copyin.Addr+8, arg.ValueHigh)
+				} else if arg.BitfieldOffset == 0 && arg.BitfieldLength == 0 {
 					fmt.Fprintf(w, "\tNONFAILING(*(uint%v_t*)0x%x = (uint%v_t)0x%x);\n",
 						arg.Size*8, copyin.Addr, arg.Size*8, arg.Value)
 				} else {
@@ -284,6 +287,11 @@ func (ctx *context) generateCalls(p prog.ExecProg) ([]string, uint64) {
 			case prog.ExecArgData:
 				fmt.Fprintf(w, "\tNONFAILING(memcpy((void*)0x%x, \"%s\", %v));\n",
 					copyin.Addr, toCString(arg.Data), len(arg.Data))
+			case prog.ExecArgUnionOption:
+				// Only informational, does not change memory.
+			case prog.ExecArgFill:
+				fmt.Fprintf(w, "\tNONFAILING(memset((void*)0x%x, 0x%x, %v));\n",
+					copyin.Addr, arg.Value, arg.Size)
 			case prog.ExecArgCsum:
 				switch arg.Kind {
 				case prog.ExecArgCsumInet:
@@ -302,6 +310,10 @@ func (ctx *context) generateCalls(p prog.ExecProg) ([]string, uint64) {
 						}
 					}
 					fmt.Fprintf(w, "\tNONFAILING(*(uint16_t*)0x%x = csum_inet_digest(&csum_%d));\n", copyin.Addr, csumSeq)
+				case prog.ExecArgCsumCrc32:
+					chunk := arg.Chunks[0]
+					fmt.Fprintf(w, "\tNONFAILING(*(uint32_t*)0x%x = csum_crc32((const uint8_t*)0x%x, %d, 0x%x));\n",
+						copyin.Addr, chunk.Value, chunk.Size, arg.Poly)
 				default:
 					panic(fmt.Sprintf("unknown csum kind %v", arg.Kind))
 				}
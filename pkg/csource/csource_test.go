@@ -5,15 +5,18 @@ package csource
 
 import (
 	"fmt"
+	"hash/crc32"
 	"math/rand"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/google/syzkaller/prog"
 	_ "github.com/google/syzkaller/sys"
+	"github.com/google/syzkaller/sys/targets"
 )
 
 func initTest(t *testing.T) (*prog.Target, rand.Source, int) {
@@ -101,6 +104,111 @@ func TestGenerateOptions(t *testing.T) {
 	}
 }
 
+func TestGenerateCsumCrc32(t *testing.T) {
+	target, err := prog.GetTarget("linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &context{
+		target:    target,
+		sysTarget: targets.List["linux"]["amd64"],
+	}
+	p := prog.ExecProg{Calls: []prog.ExecCall{{
+		Meta:  target.SyscallMap["getpid"],
+		Index: prog.ExecNoCopyout,
+		Copyin: []prog.ExecCopyin{{
+			Addr: 0x20000000,
+			Arg: prog.ExecArgCsum{
+				Size:   4,
+				Kind:   prog.ExecArgCsumCrc32,
+				Chunks: []prog.ExecCsumChunk{{Kind: prog.ExecArgCsumChunkData, Value: 0x20000004, Size: 12}},
+				Poly:   crc32.IEEE,
+			},
+		}},
+	}}}
+	calls, _ := ctx.generateCalls(p)
+	want := "\tNONFAILING(*(uint32_t*)0x20000000 = csum_crc32((const uint8_t*)0x20000004, 12, 0xedb88320));\n"
+	if !strings.Contains(calls[0], want) {
+		t.Fatalf("no crc32 checksum calculation in:\n%s\nwant:\n%s", calls[0], want)
+	}
+	for _, os := range []string{"linux", "akaros", "freebsd", "netbsd"} {
+		header, err := getCommonHeader(os)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(header, "static uint32_t csum_crc32(") {
+			t.Errorf("no csum_crc32 in %v common header", os)
+		}
+	}
+}
+
+func TestGenerateCsumCrc32c(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := target.Deserialize([]byte(`syz_test$csum_crc32c(&(0x7f0000000000)={0x0, "0102"})`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := make([]byte, prog.ExecBufferSize)
+	n, err := p.SerializeForExec(exec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := target.DeserializeExec(exec[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &context{
+		target:    target,
+		sysTarget: targets.List["test"]["64"],
+	}
+	calls, _ := ctx.generateCalls(decoded)
+	want := fmt.Sprintf("\tNONFAILING(*(uint32_t*)0x%x = csum_crc32((const uint8_t*)0x%x, 6, 0x%x));\n",
+		target.DataOffset, target.DataOffset, crc32.Castagnoli)
+	if !strings.Contains(calls[0], want) {
+		t.Fatalf("no crc32c checksum calculation in:\n%s\nwant:\n%s", calls[0], want)
+	}
+}
+
+func TestChecksumDefines(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unused static functions break compilation with -Werror,
+	// so each checksum kind enables only the functions it needs.
+	tests := []struct {
+		prog  string
+		inet  bool
+		crc32 bool
+	}{
+		{"syz_test$csum_ipv4(&(0x7f0000000000)={0x0, 0x1, 0x2})", true, false},
+		{"syz_test$csum_crc32c(&(0x7f0000000000)={0x0, \"0102\"})", false, true},
+		{"syz_test$int(0x0, 0x0, 0x0, 0x0, 0x0)", false, false},
+	}
+	for _, test := range tests {
+		p, err := target.Deserialize([]byte(test.prog))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defines, err := defineList(p, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		inet, crc32 := false, false
+		for _, def := range defines {
+			inet = inet || def == "SYZ_USE_CHECKSUMS"
+			crc32 = crc32 || def == "SYZ_USE_CRC32_CHECKSUMS"
+		}
+		if inet != test.inet || crc32 != test.crc32 {
+			t.Errorf("%v: got inet=%v crc32=%v, want inet=%v crc32=%v",
+				test.prog, inet, crc32, test.inet, test.crc32)
+		}
+	}
+}
+
 func testOne(t *testing.T, p *prog.Prog, opts Options) {
 	src, err := Write(p, opts)
 	if err != nil {
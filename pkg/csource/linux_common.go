@@ -284,6 +284,21 @@ static uint16_t csum_inet_digest(struct csum_inet* csum)
 }
 #endif
 
+#if defined(SYZ_EXECUTOR) || defined(SYZ_USE_CRC32_CHECKSUMS)
+static uint32_t csum_crc32(const uint8_t* data, size_t length, uint32_t poly)
+{
+	uint32_t crc = 0xffffffff;
+	size_t i;
+	for (i = 0; i < length; i++) {
+		crc ^= data[i];
+		int bit;
+		for (bit = 0; bit < 8; bit++)
+			crc = (crc & 1) ? (crc >> 1) ^ poly : crc >> 1;
+	}
+	return ~crc;
+}
+#endif
+
 #if defined(SYZ_EXECUTOR) || defined(SYZ_HANDLE_SEGV)
 static __thread int skip_segv;
 static __thread jmp_buf segv_env;
@@ -176,6 +176,8 @@ type Env struct {
 	bin     []string
 	pid     int
 	config  *Config
+	// execOpts, if set, overrides options used to serialize programs (used in tests).
+	execOpts *prog.ExecOpts
 
 	StatExecs    uint64
 	StatRestarts uint64
@@ -305,7 +307,13 @@ func (env *Env) Exec(opts *ExecOpts, p *prog.Prog) (output []byte, info []CallIn
 		})
 	}
 	// Copy-in serialized program.
-	progSize, err := p.SerializeForExec(env.in, env.pid)
+	var serializeOpts prog.ExecOpts
+	if env.execOpts != nil {
+		serializeOpts = *env.execOpts
+	} else if p.Target != nil {
+		serializeOpts = p.Target.ExecutorOpts()
+	}
+	progSize, err := p.SerializeForExecOpts(env.in, env.pid, serializeOpts)
 	if err != nil {
 		err0 = fmt.Errorf("executor %v: failed to serialize: %v", env.pid, err)
 		return
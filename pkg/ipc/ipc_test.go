@@ -130,3 +130,123 @@ func TestExecute(t *testing.T) {
 		}
 	}
 }
+
+func TestExecuteEncodings(t *testing.T) {
+	target, rs, iters, configFlags := initTest(t)
+	if target.OS != "linux" {
+		t.Skip("the test program uses linux syscalls")
+	}
+
+	bin := buildExecutor(t, target)
+	defer os.Remove(bin)
+
+	// The write succeeds only if the pipe fds are copied out and data is decoded correctly.
+	const text = `mmap(&(0x7f0000000000/0x3000)=nil, 0x3000, 0x3, 0x32, 0xffffffffffffffff, 0x0)
+pipe(&(0x7f0000000000)={<r0=>0xffffffffffffffff, <r1=>0xffffffffffffffff})
+write(r1, &(0x7f0000001000)="0102030405", 0x5)
+read(r0, &(0x7f0000002000)=""/5, 0x5) (repeat: 2, collide_group: 1, sandbox: 1)
+close(r0)
+close(r1)
+`
+	// Executor must accept programs in any encoding, regardless of Target.ExecVarint.
+	encodings := []prog.ExecOpts{
+		{},
+		{EmitHeader: true},
+		{EmitHeader: true, Varint: true},
+		{EmitHeader: true, Varint: true, EmitCallProps: true},
+	}
+	flags := []ExecFlags{0, FlagThreaded, FlagThreaded | FlagCollide}
+	for e := range encodings {
+		enc := &encodings[e]
+		for _, flag := range flags {
+			cfg := &Config{
+				Executor: bin,
+				Flags:    configFlags,
+				Timeout:  timeout,
+			}
+			env, err := MakeEnv(cfg, 0)
+			if err != nil {
+				t.Fatalf("failed to create env: %v", err)
+			}
+			defer env.Close()
+			env.execOpts = enc
+
+			p, err := target.Deserialize([]byte(text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := &ExecOpts{
+				Flags: flag,
+			}
+			output, info, _, _, err := env.Exec(opts, p)
+			if err != nil {
+				t.Fatalf("encoding #%v, flags 0x%x: failed to run executor: %v\n%s", e, flag, err, output)
+			}
+			if flag&FlagCollide == 0 && env.out != nil {
+				if len(info) != len(p.Calls) {
+					t.Fatalf("encoding #%v, flags 0x%x: got info for %v calls, want %v", e, flag, len(info), len(p.Calls))
+				}
+				for i, inf := range info {
+					if inf.Errno != 0 {
+						t.Fatalf("encoding #%v, flags 0x%x: call %v failed with errno %v", e, flag, i, inf.Errno)
+					}
+				}
+			}
+			for i := 0; i < iters/len(flags)/len(encodings)+1; i++ {
+				p := target.Generate(rs, 10, nil)
+				output, _, _, _, err := env.Exec(opts, p)
+				if err != nil {
+					t.Logf("program:\n%s\n", p.Serialize())
+					t.Fatalf("encoding #%v, flags 0x%x: failed to run executor: %v\n%s", e, flag, err, output)
+				}
+			}
+		}
+	}
+}
+
+func TestExecuteCallTimeout(t *testing.T) {
+	target, _, _, configFlags := initTest(t)
+	if target.OS != "linux" {
+		t.Skip("the test program uses linux syscalls")
+	}
+	if configFlags&FlagUseShmem == 0 {
+		t.Skip("call info is not available without shmem")
+	}
+
+	bin := buildExecutor(t, target)
+	defer os.Remove(bin)
+
+	cfg := &Config{
+		Executor: bin,
+		Flags:    configFlags,
+		Timeout:  timeout,
+	}
+	env, err := MakeEnv(cfg, 0)
+	if err != nil {
+		t.Fatalf("failed to create env: %v", err)
+	}
+	defer env.Close()
+	env.execOpts = &prog.ExecOpts{EmitCallTimeout: true}
+
+	// The call sleeps for 100ms, so it does not complete within the default 20ms
+	// unless executor waits for it according to its timeout.
+	p, err := target.Deserialize([]byte(`mmap(&(0x7f0000000000/0x1000)=nil, 0x1000, 0x3, 0x32, 0xffffffffffffffff, 0x0)
+nanosleep(&(0x7f0000000000)={0x0, 0x5f5e100}, 0x0)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, callTimeout := range []uint64{0, 1000} {
+		// Don't modify the shared syscall descriptions.
+		meta := *p.Calls[1].Meta
+		meta.Timeout = callTimeout
+		p.Calls[1].Meta = &meta
+		output, info, _, _, err := env.Exec(&ExecOpts{Flags: FlagThreaded}, p)
+		if err != nil {
+			t.Fatalf("failed to run executor: %v\n%s", err, output)
+		}
+		if executed := info[1].Errno != -1; executed != (callTimeout != 0) {
+			t.Fatalf("timeout %v: call executed=%v (errno %v)", callTimeout, executed, info[1].Errno)
+		}
+	}
+}
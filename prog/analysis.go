@@ -167,11 +167,25 @@ func RequiresBitmasks(p *Prog) bool {
 	return result
 }
 
+// RequiresChecksums returns whether p has internet checksums (csum_inet in executor).
 func RequiresChecksums(p *Prog) bool {
+	return hasCsumKind(p, func(kind CsumKind) bool { return !isCrc32Kind(kind) })
+}
+
+// RequiresCrc32Checksums returns whether p has crc32 checksums (csum_crc32 in executor).
+func RequiresCrc32Checksums(p *Prog) bool {
+	return hasCsumKind(p, isCrc32Kind)
+}
+
+func isCrc32Kind(kind CsumKind) bool {
+	return kind == CsumCrc32 || kind == CsumCrc32c
+}
+
+func hasCsumKind(p *Prog, pred func(kind CsumKind) bool) bool {
 	result := false
 	for _, c := range p.Calls {
 		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
-			if _, ok := arg.Type().(*CsumType); ok {
+			if typ, ok := arg.Type().(*CsumType); ok && pred(typ.Kind) {
 				result = true
 			}
 		})
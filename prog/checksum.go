@@ -12,6 +12,16 @@ type CsumChunkKind int
 const (
 	CsumChunkArg CsumChunkKind = iota
 	CsumChunkConst
+	// CsumChunkLen is size of Arg in network byte order of Size bytes.
+	// It is calculated during serialization, so it matches the final layout
+	// of variable-length args.
+	CsumChunkLen
+)
+
+// IP protocol numbers of pseudo-header checksums with CsumTcp and CsumUdp kinds.
+const (
+	ipProtoTCP = 6
+	ipProtoUDP = 17
 )
 
 type CsumInfo struct {
@@ -21,9 +31,21 @@ type CsumInfo struct {
 
 type CsumChunk struct {
 	Kind  CsumChunkKind
-	Arg   Arg    // for CsumChunkArg
+	Arg   Arg    // for CsumChunkArg and CsumChunkLen
 	Value uint64 // for CsumChunkConst
-	Size  uint64 // for CsumChunkConst
+	Size  uint64 // for CsumChunkConst and CsumChunkLen
+}
+
+// lenValue returns value of CsumChunkLen chunk.
+func (chunk CsumChunk) lenValue() uint64 {
+	switch chunk.Size {
+	case 2:
+		return uint64(swap16(uint16(chunk.Arg.Size())))
+	case 4:
+		return uint64(swap32(uint32(chunk.Arg.Size())))
+	default:
+		panic(fmt.Sprintf("bad csum len chunk size %v", chunk.Size))
+	}
 }
 
 func getFieldByName(arg Arg, name string) Arg {
@@ -64,7 +86,7 @@ func composePseudoCsumIPv4(tcpPacket, srcAddr, dstAddr Arg, protocol uint8, pid
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkArg, srcAddr, 0, 0})
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkArg, dstAddr, 0, 0})
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkConst, nil, uint64(swap16(uint16(protocol))), 2})
-	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkConst, nil, uint64(swap16(uint16(tcpPacket.Size()))), 2})
+	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkLen, tcpPacket, 0, 2})
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkArg, tcpPacket, 0, 0})
 	return info
 }
@@ -73,31 +95,120 @@ func composePseudoCsumIPv6(tcpPacket, srcAddr, dstAddr Arg, protocol uint8, pid
 	info := CsumInfo{Kind: CsumInet}
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkArg, srcAddr, 0, 0})
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkArg, dstAddr, 0, 0})
-	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkConst, nil, uint64(swap32(uint32(tcpPacket.Size()))), 4})
+	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkLen, tcpPacket, 0, 4})
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkConst, nil, uint64(swap32(uint32(protocol))), 4})
 	info.Chunks = append(info.Chunks, CsumChunk{CsumChunkArg, tcpPacket, 0, 0})
 	return info
 }
 
 func findCsummedArg(arg Arg, typ *CsumType, parentsMap map[Arg]Arg) Arg {
+	csummedArg, err := lookupCsummedArg(arg, typ, parentsMap)
+	if err != nil {
+		panic(err.Error())
+	}
+	return csummedArg
+}
+
+func lookupCsummedArg(arg Arg, typ *CsumType, parentsMap map[Arg]Arg) (Arg, error) {
 	if typ.Buf == "parent" {
 		if csummedArg, ok := parentsMap[arg]; ok {
-			return csummedArg
+			return csummedArg, nil
 		}
-		panic(fmt.Sprintf("parent for %v is not in parents map", typ.Name()))
+		return nil, fmt.Errorf("parent for %v is not in parents map", typ.Name())
 	} else {
 		for parent := parentsMap[arg]; parent != nil; parent = parentsMap[parent] {
 			if typ.Buf == parent.Type().Name() {
-				return parent
+				return parent, nil
+			}
+		}
+		// Similar to len, the checksum can also cover a sibling field (e.g. an iovec array).
+		if parent, ok := parentsMap[arg]; ok {
+			for _, field := range parent.(*GroupArg).Inner {
+				if typ.Buf == field.Type().FieldName() {
+					return field, nil
+				}
 			}
 		}
 	}
-	panic(fmt.Sprintf("csum field '%v' references non existent field '%v'", typ.FieldName(), typ.Buf))
+	return nil, fmt.Errorf("csum field '%v' references non existent field '%v'", typ.FieldName(), typ.Buf)
+}
+
+// csumArgChunks returns chunks of an inet checksum over arg.
+// If arg references buffers (e.g. it is an iovec array), the checksum covers
+// the referenced buffers in order, as if they were concatenated, rather than
+// the memory of arg itself, which contains only addresses and lengths.
+func csumArgChunks(arg Arg) []CsumChunk {
+	var chunks []CsumChunk
+	var walk func(arg Arg)
+	walk = func(arg Arg) {
+		switch a := arg.(type) {
+		case *GroupArg:
+			for _, inner := range a.Inner {
+				walk(inner)
+			}
+		case *UnionArg:
+			walk(a.Option)
+		case *PointerArg:
+			if a.Res != nil {
+				chunks = append(chunks, CsumChunk{CsumChunkArg, a.Res, 0, 0})
+			}
+		}
+	}
+	walk(arg)
+	if chunks == nil {
+		chunks = []CsumChunk{{CsumChunkArg, arg, 0, 0}}
+	}
+	return chunks
+}
+
+// csumParents maps args of the call to their parent structs.
+func csumParents(c *Call) map[Arg]Arg {
+	parentsMap := make(map[Arg]Arg)
+	foreachArgArray(&c.Args, nil, func(arg, base Arg, _ *[]Arg) {
+		if _, ok := arg.Type().(*StructType); ok {
+			for _, field := range arg.(*GroupArg).Inner {
+				parentsMap[InnerArg(field)] = arg
+			}
+		}
+	})
+	return parentsMap
+}
+
+// ChecksumLayout returns checksums of call c of program p as calculated
+// for serialization for execution by process pid: map from checksum args
+// to chunks of data they cover.
+func (p *Prog) ChecksumLayout(c *Call, pid int) map[Arg]CsumInfo {
+	for _, c1 := range p.Calls {
+		if c1 == c {
+			return calcChecksumsCall(c, pid)
+		}
+	}
+	panic(fmt.Sprintf("call %v does not belong to the program", c.Meta.Name))
+}
+
+// hasCsums returns whether arguments of syscall meta can contain checksums.
+// Most syscalls don't have them, so this allows to skip calcChecksumsCall.
+// Syscalls that are not part of the target (e.g. synthesized in tests) may have them.
+func (target *Target) hasCsums(meta *Syscall) bool {
+	target.csumCallsOnce.Do(func() {
+		target.csumCalls = make(map[*Syscall]bool)
+		for _, c := range target.Syscalls {
+			target.csumCalls[c] = false
+			ForeachType(c, func(t Type) {
+				if _, ok := t.(*CsumType); ok {
+					target.csumCalls[c] = true
+				}
+			})
+		}
+	})
+	has, known := target.csumCalls[meta]
+	return has || !known
 }
 
 func calcChecksumsCall(c *Call, pid int) map[Arg]CsumInfo {
 	var inetCsumFields []Arg
 	var pseudoCsumFields []Arg
+	var crc32CsumFields []Arg
 
 	// Find all csum fields.
 	foreachArgArray(&c.Args, nil, func(arg, base Arg, _ *[]Arg) {
@@ -105,8 +216,10 @@ func calcChecksumsCall(c *Call, pid int) map[Arg]CsumInfo {
 			switch typ.Kind {
 			case CsumInet:
 				inetCsumFields = append(inetCsumFields, arg)
-			case CsumPseudo:
+			case CsumPseudo, CsumTcp, CsumUdp:
 				pseudoCsumFields = append(pseudoCsumFields, arg)
+			case CsumCrc32, CsumCrc32c:
+				crc32CsumFields = append(crc32CsumFields, arg)
 			default:
 				panic(fmt.Sprintf("unknown csum kind %v\n", typ.Kind))
 			}
@@ -114,19 +227,12 @@ func calcChecksumsCall(c *Call, pid int) map[Arg]CsumInfo {
 	})
 
 	// Return if no csum fields found.
-	if len(inetCsumFields) == 0 && len(pseudoCsumFields) == 0 {
+	if len(inetCsumFields) == 0 && len(pseudoCsumFields) == 0 && len(crc32CsumFields) == 0 {
 		return nil
 	}
 
 	// Build map of each field to its parent struct.
-	parentsMap := make(map[Arg]Arg)
-	foreachArgArray(&c.Args, nil, func(arg, base Arg, _ *[]Arg) {
-		if _, ok := arg.Type().(*StructType); ok {
-			for _, field := range arg.(*GroupArg).Inner {
-				parentsMap[InnerArg(field)] = arg
-			}
-		}
-	})
+	parentsMap := csumParents(c)
 
 	csumMap := make(map[Arg]CsumInfo)
 
@@ -134,9 +240,15 @@ func calcChecksumsCall(c *Call, pid int) map[Arg]CsumInfo {
 	for _, arg := range inetCsumFields {
 		typ, _ := arg.Type().(*CsumType)
 		csummedArg := findCsummedArg(arg, typ, parentsMap)
-		chunk := CsumChunk{CsumChunkArg, csummedArg, 0, 0}
-		info := CsumInfo{Kind: CsumInet, Chunks: make([]CsumChunk, 0)}
-		info.Chunks = append(info.Chunks, chunk)
+		csumMap[arg] = CsumInfo{Kind: CsumInet, Chunks: csumArgChunks(csummedArg)}
+	}
+
+	// Calculate CRC32 and CRC32c checksums, they cover a single contiguous range.
+	for _, arg := range crc32CsumFields {
+		typ, _ := arg.Type().(*CsumType)
+		csummedArg := findCsummedArg(arg, typ, parentsMap)
+		info := CsumInfo{Kind: typ.Kind}
+		info.Chunks = append(info.Chunks, CsumChunk{CsumChunkArg, csummedArg, 0, 0})
 		csumMap[arg] = info
 	}
 
@@ -170,6 +282,12 @@ func calcChecksumsCall(c *Call, pid int) map[Arg]CsumInfo {
 		typ, _ := arg.Type().(*CsumType)
 		csummedArg := findCsummedArg(arg, typ, parentsMap)
 		protocol := uint8(typ.Protocol)
+		switch typ.Kind {
+		case CsumTcp:
+			protocol = ipProtoTCP
+		case CsumUdp:
+			protocol = ipProtoUDP
+		}
 		var info CsumInfo
 		if ipv4HeaderParsed {
 			info = composePseudoCsumIPv4(csummedArg, ipSrcAddr, ipDstAddr, protocol, pid)
@@ -4,6 +4,7 @@
 package prog_test
 
 import (
+	"reflect"
 	"testing"
 
 	. "github.com/google/syzkaller/prog"
@@ -25,3 +26,176 @@ func TestChecksumCalcRandom(t *testing.T) {
 		}
 	}
 }
+
+func TestChecksumLayout(t *testing.T) {
+	target, err := GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := target.Deserialize([]byte("syz_test$csum_ipv4_udp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {0x0, \"abcd\"}})"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := p.Calls[0].Args[0].(*PointerArg).Res.(*GroupArg)
+	ipv4 := packet.Inner[0].(*GroupArg)
+	udp := packet.Inner[1].(*GroupArg)
+	want := map[Arg]CsumInfo{
+		ipv4.Inner[0]: {
+			Kind:   CsumInet,
+			Chunks: []CsumChunk{{Kind: CsumChunkArg, Arg: ipv4}},
+		},
+		udp.Inner[0]: {
+			Kind: CsumInet,
+			Chunks: []CsumChunk{
+				{Kind: CsumChunkArg, Arg: ipv4.Inner[1]},
+				{Kind: CsumChunkArg, Arg: ipv4.Inner[2]},
+				{Kind: CsumChunkConst, Value: 0x1100, Size: 2}, // IPPROTO_UDP
+				{Kind: CsumChunkLen, Arg: udp, Size: 2},
+				{Kind: CsumChunkArg, Arg: udp},
+			},
+		},
+	}
+	got := p.ChecksumLayout(p.Calls[0], 0)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got layout:\n%+v\nwant:\n%+v", got, want)
+	}
+}
+
+func TestChecksumPseudoKinds(t *testing.T) {
+	target, err := GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tcp and udp kinds must produce the same checksums as pseudo with the protocol.
+	ip6 := `"000102030405060708090a0b0c0d0e0f"`
+	tests := [][2]string{
+		{
+			`syz_test$csum_ipv4_tcp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {{0x0}, "abcd"}})`,
+			`syz_test$csum_ipv4_tcp_kind(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {0x0, "abcd"}})`,
+		},
+		{
+			`syz_test$csum_ipv6_udp(&(0x7f0000000000)={{` + ip6 + `, ` + ip6 + `}, {0x0, "abcd"}})`,
+			`syz_test$csum_ipv6_udp_kind(&(0x7f0000000000)={{` + ip6 + `, ` + ip6 + `}, {0x0, "abcd"}})`,
+		},
+	}
+	for _, test := range tests {
+		var copyins [2][]ExecCopyin
+		for i, data := range test {
+			p, err := target.Deserialize([]byte(data))
+			if err != nil {
+				t.Fatalf("failed to deserialize %v: %v", data, err)
+			}
+			buf := make([]byte, ExecBufferSize)
+			n, err := p.SerializeForExec(buf, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exec, err := target.DeserializeExec(buf[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			copyins[i] = exec.Calls[0].Copyin
+		}
+		if !reflect.DeepEqual(copyins[0], copyins[1]) {
+			t.Fatalf("copyins differ:\n%+v\n%+v", copyins[0], copyins[1])
+		}
+	}
+}
+
+func TestChecksumIovec(t *testing.T) {
+	target, err := GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Synthesize struct msg { csum csum[iov, inet, int16]; iov array[iovec, 3] },
+	// there are no such syscalls in descriptions.
+	intType := func(name string, size uint64) IntTypeCommon {
+		return IntTypeCommon{TypeCommon: TypeCommon{TypeName: name, FldName: name, TypeSize: size}}
+	}
+	bufType := &BufferType{TypeCommon: TypeCommon{TypeName: "buf"}}
+	lenType := &LenType{IntTypeCommon: intType("len", 8), Buf: "base"}
+	iovecType := &StructType{
+		Key: StructKey{Name: "iovec"},
+		StructDesc: &StructDesc{
+			TypeCommon: TypeCommon{TypeName: "iovec", TypeSize: 16},
+			Fields: []Type{
+				&PtrType{TypeCommon: TypeCommon{TypeName: "ptr", FldName: "base", TypeSize: 8}, Type: bufType},
+				lenType,
+			},
+		},
+	}
+	arrType := &ArrayType{
+		TypeCommon: TypeCommon{TypeName: "array", FldName: "iov"},
+		Type:       iovecType,
+		Kind:       ArrayRangeLen,
+		RangeBegin: 3,
+		RangeEnd:   3,
+	}
+	csumType := &CsumType{IntTypeCommon: intType("csum", 2), Kind: CsumInet, Buf: "iov"}
+	msgType := &StructType{
+		Key: StructKey{Name: "msg"},
+		StructDesc: &StructDesc{
+			TypeCommon: TypeCommon{TypeName: "msg"},
+			Fields:     []Type{csumType, arrType},
+		},
+	}
+	msgPtrType := &PtrType{TypeCommon: TypeCommon{TypeName: "ptr", FldName: "msg", TypeSize: 8}, Type: msgType}
+	meta := *target.SyscallMap["syz_test$opt1"]
+	meta.Args = []Type{msgPtrType}
+
+	var bufs []Arg
+	var iovecs []Arg
+	for i, data := range []string{"\x01\x02", "\x03\x04\x05\x06", "\x07"} {
+		buf := MakeDataArg(bufType, []byte(data))
+		bufs = append(bufs, buf)
+		iovecs = append(iovecs, MakeGroupArg(iovecType, []Arg{
+			MakePointerArg(iovecType.Fields[0], uint64(i+1), 0, 0, buf),
+			MakeConstArg(lenType, uint64(len(data))),
+		}))
+	}
+	csum := MakeConstArg(csumType, 0)
+	msg := MakeGroupArg(msgType, []Arg{csum, MakeGroupArg(arrType, iovecs)})
+	c := &Call{
+		Meta: &meta,
+		Args: []Arg{MakePointerArg(msgPtrType, 0, 0, 0, msg)},
+		Ret:  MakeReturnArg(nil),
+	}
+	p := &Prog{Target: target, Calls: []*Call{c}}
+
+	want := map[Arg]CsumInfo{
+		csum: {
+			Kind: CsumInet,
+			Chunks: []CsumChunk{
+				{Kind: CsumChunkArg, Arg: bufs[0]},
+				{Kind: CsumChunkArg, Arg: bufs[1]},
+				{Kind: CsumChunkArg, Arg: bufs[2]},
+			},
+		},
+	}
+	if got := p.ChecksumLayout(c, 0); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got layout:\n%+v\nwant:\n%+v", got, want)
+	}
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec, err := target.DeserializeExec(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []ExecCsumChunk
+	for _, copyin := range exec.Calls[0].Copyin {
+		if arg, ok := copyin.Arg.(ExecArgCsum); ok {
+			chunks = arg.Chunks
+		}
+	}
+	wantChunks := []ExecCsumChunk{
+		{Kind: ExecArgCsumChunkData, Value: target.DataOffset + 1*target.PageSize, Size: 2},
+		{Kind: ExecArgCsumChunkData, Value: target.DataOffset + 2*target.PageSize, Size: 4},
+		{Kind: ExecArgCsumChunkData, Value: target.DataOffset + 3*target.PageSize, Size: 1},
+	}
+	if !reflect.DeepEqual(chunks, wantChunks) {
+		t.Fatalf("got csum chunks %+v, want %+v", chunks, wantChunks)
+	}
+}
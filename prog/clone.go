@@ -12,6 +12,10 @@ func (p *Prog) Clone() *Prog {
 	for ci, c := range p.Calls {
 		c1 := new(Call)
 		c1.Meta = c.Meta
+		c1.Repeat = c.Repeat
+		c1.Async = c.Async
+		c1.FailNth = c.FailNth
+		c1.Props = c.Props
 		c1.Ret = clone(c.Ret, newargs)
 		c1.Args = make([]Arg, len(c.Args))
 		for ai, arg := range c.Args {
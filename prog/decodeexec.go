@@ -4,20 +4,62 @@
 package prog
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 )
 
+// ExecProg is a structured representation of a program in the exec format
+// (see DeserializeExec), e.g. for round-trip tests and debugging of executors.
+// Copyins and checksums are attached to the call they precede.
 type ExecProg struct {
 	Calls   []ExecCall
 	NumVars uint64
+	ProgID  uint64 // ExecInstrProgID value, or 0 if there is none
+	Reset   bool   // the program starts with ExecInstrReset
+	Version uint64 // format version from ExecInstrHeader, or 0 if there is none
+	Flags   uint64 // ExecFlag* flags from ExecInstrHeader
+
+	bigEndian bool // the program is for a big-endian target
+	varint    bool // the program uses varint encoding (ExecOpts.Varint)
 }
 
 type ExecCall struct {
 	Meta    *Syscall
 	Index   uint64
+	Repeat  uint64
 	Args    []ExecArg
 	Copyin  []ExecCopyin
 	Copyout []ExecCopyout
+	// CopyoutData are ExecInstrCopyoutData instructions following Copyout.
+	CopyoutData []ExecCopyout
+
+	// ExpectedRet is the expected return value if HasExpectedRet is set (ExecInstrExpectReturn).
+	HasExpectedRet bool
+	ExpectedRet    uint64
+
+	// Hash is ExecInstrCallHash value if HasHash is set.
+	HasHash bool
+	Hash    uint64
+
+	// Timeout is ExecInstrCallTimeout value, 0 if the call has no timeout.
+	Timeout uint64
+	// Async is set if the call is preceded by ExecInstrAsync.
+	Async bool
+	// FailNth is ExecInstrFailNth value, 0 if fault injection is not enabled for the call.
+	FailNth uint64
+	// Props are ExecInstrCallProps properties in increasing order of keys,
+	// including the ones with unknown keys.
+	Props []ExecCallProp
+}
+
+type ExecCallProp struct {
+	Key   uint64 // ExecCallProp*
+	Value uint64
 }
 
 type ExecCopyin struct {
@@ -29,6 +71,8 @@ type ExecCopyout struct {
 	Index uint64
 	Addr  uint64
 	Size  uint64
+	// OnSuccess is set if the size has ExecCopyoutFlagOnSuccess (never for CopyoutData).
+	OnSuccess bool
 }
 
 type ExecArg interface{} // one of ExecArg*
@@ -36,6 +80,7 @@ type ExecArg interface{} // one of ExecArg*
 type ExecArgConst struct {
 	Size           uint64
 	Value          uint64
+	ValueHigh      uint64 // upper 64 bits of 16-byte values
 	BitfieldOffset uint64
 	BitfieldLength uint64
 }
@@ -45,16 +90,51 @@ type ExecArgResult struct {
 	Index uint64
 	DivOp uint64
 	AddOp uint64
+	// Default is the value used if the result was not copied out,
+	// present only with ExecFlagCopyoutOnSuccess.
+	Default uint64
+
+	// Producer is name of the call and arg that produce the result, if known
+	// (see ExecProg.AnnotateResults). It is not part of the exec format.
+	Producer string
+}
+
+func (arg ExecArgResult) String() string {
+	if arg.Producer == "" {
+		return fmt.Sprintf("ref(idx=%v)", arg.Index)
+	}
+	return fmt.Sprintf("ref(idx=%v <- %v)", arg.Index, arg.Producer)
+}
+
+// ExecArgBlock is the last call arg that points to a memory block
+// with values of the rest of args (ExecArgTypeArgBlock).
+type ExecArgBlock struct {
+	Args []ExecArg
 }
 
 type ExecArgData struct {
 	Data []byte
+	// Compressed is zlib-compressed Data for ExecArgTypeDataCompressed, or nil.
+	Compressed []byte
+}
+
+// ExecArgUnionOption is option index of the union at the copyin address (ExecInstrUnionOption).
+// It does not change memory.
+type ExecArgUnionOption struct {
+	Index uint64
+}
+
+// ExecArgFill is a memory range filled with a byte value (ExecInstrCopyinFill).
+type ExecArgFill struct {
+	Size  uint64
+	Value uint64
 }
 
 type ExecArgCsum struct {
 	Size   uint64
 	Kind   uint64
 	Chunks []ExecCsumChunk
+	Poly   uint64 // for ExecArgCsumCrc32, which has a single ExecArgCsumChunkData chunk
 }
 
 type ExecCsumChunk struct {
@@ -63,19 +143,33 @@ type ExecCsumChunk struct {
 	Size  uint64
 }
 
+// DeserializeExec parses a program produced by SerializeForExec.
+// A stream consisting of only ExecInstrEOF yields a program without calls.
+// Varint encoding (ExecOpts.Varint) is detected by ExecFlagVarint in the header.
 func (target *Target) DeserializeExec(exec []byte) (ExecProg, error) {
-	dec := &execDecoder{target: target, data: exec}
+	dec := &execDecoder{target: target, data: exec, bigEndian: target.BigEndian}
 	dec.parse()
 	if dec.err != nil {
 		return ExecProg{}, dec.err
 	}
-	p := ExecProg{
-		Calls:   dec.calls,
-		NumVars: dec.numVars,
+	return dec.prog(), nil
+}
+
+// DeserializeBatchExec parses a stream produced by SerializeBatchForExec.
+func (target *Target) DeserializeBatchExec(exec []byte) ([]ExecProg, error) {
+	dec := &execDecoder{target: target, data: exec, batch: true, bigEndian: target.BigEndian}
+	dec.parse()
+	if dec.err != nil {
+		return nil, dec.err
 	}
-	return p, nil
+	return dec.progs, nil
 }
 
+const (
+	execMinArgSize    = 2 * 8 // type and size of a data arg
+	execCsumChunkSize = 3 * 8
+)
+
 type execDecoder struct {
 	target  *Target
 	data    []byte
@@ -83,42 +177,272 @@ type execDecoder struct {
 	numVars uint64
 	call    ExecCall
 	calls   []ExecCall
+	batch   bool
+	progs   []ExecProg
+
+	dataAlign   uint64
+	sizeWidth   uint64 // ExecInstrSizeWidth value, or 0 if there is none
+	varint      bool   // words are encoded as varints (ExecFlagVarint in the header)
+	progID      uint64 // ExecInstrProgID value of the current program
+	progStarted bool   // any instructions of the current program were parsed
+	reset       bool   // the current program has ExecInstrReset
+	version     uint64 // ExecInstrHeader version of the current program
+	flags       uint64 // ExecInstrHeader flags of the current program
+	bigEndian   bool   // words are big-endian (Target.BigEndian)
+}
+
+// prog returns the parsed program.
+func (dec *execDecoder) prog() ExecProg {
+	return ExecProg{
+		Calls:   dec.calls,
+		NumVars: dec.numVars,
+		ProgID:  dec.progID,
+		Reset:   dec.reset,
+		Version: dec.version,
+		Flags:   dec.flags,
+
+		bigEndian: dec.bigEndian,
+		varint:    dec.varint,
+	}
 }
 
 func (dec *execDecoder) parse() {
 	for dec.err == nil {
-		switch instr := dec.read(); instr {
-		case execInstrCopyin:
+		instr := dec.read()
+		started := dec.progStarted
+		dec.progStarted = true
+		switch instr {
+		case ExecInstrCopyin:
 			dec.commitCall()
-			dec.call.Copyin = append(dec.call.Copyin, ExecCopyin{
+			copyin := ExecCopyin{
 				Addr: dec.read(),
 				Arg:  dec.readArg(),
+			}
+			dec.call.Copyin = append(dec.call.Copyin, copyin)
+		case ExecInstrCopyinFill:
+			dec.commitCall()
+			copyin := ExecCopyin{
+				Addr: dec.read(),
+				Arg: ExecArgFill{
+					Size:  dec.readSize(),
+					Value: dec.read(),
+				},
+			}
+			dec.call.Copyin = append(dec.call.Copyin, copyin)
+		case ExecInstrUnionOption:
+			dec.commitCall()
+			dec.call.Copyin = append(dec.call.Copyin, ExecCopyin{
+				Addr: dec.read(),
+				Arg: ExecArgUnionOption{
+					Index: dec.read(),
+				},
 			})
-		case execInstrCopyout:
-			dec.call.Copyout = append(dec.call.Copyout, ExecCopyout{
+		case ExecInstrDataAlign:
+			align := dec.read()
+			if align == 0 || align&(align-1) != 0 || align > execMaxDataAlign {
+				dec.setErr(fmt.Errorf("bad data alignment %v", align))
+				return
+			}
+			dec.dataAlign = align
+		case ExecInstrSizeWidth:
+			width := dec.read()
+			if width != 2 && width != 4 && width != execDefaultSizeWidth {
+				dec.setErr(fmt.Errorf("bad size width %v", width))
+				return
+			}
+			dec.sizeWidth = width
+		case ExecInstrBatchSep:
+			if !dec.batch {
+				dec.setErr(fmt.Errorf("batch separator in a non-batch program"))
+				return
+			}
+			dec.commitCall()
+			dec.progs = append(dec.progs, dec.prog())
+			dec.calls = nil
+			dec.numVars = 0
+			dec.progID = 0
+			dec.progStarted = false
+			dec.reset = false
+			dec.version = 0
+			dec.flags = 0
+			// The next program starts with fixed-size words, its header may switch to varints.
+			dec.varint = false
+		case ExecInstrRepeat:
+			dec.commitCall()
+			dec.call.Repeat = dec.read()
+			if dec.call.Repeat == 0 && dec.err == nil {
+				dec.setErr(fmt.Errorf("zero repeat count"))
+				return
+			}
+		case ExecInstrHeader:
+			if started {
+				dec.setErr(fmt.Errorf("header is not the first instruction"))
+				return
+			}
+			dec.progStarted = false
+			header := dec.read()
+			if dec.err != nil {
+				return
+			}
+			if magic := header >> 32; magic != ExecFormatMagic {
+				dec.setErr(fmt.Errorf("bad header magic 0x%x", magic))
+				return
+			}
+			dec.version = header >> 16 & 0xffff
+			dec.flags = header & 0xffff
+			if dec.version != ExecFormatVersion {
+				dec.setErr(fmt.Errorf("unsupported exec format version %v, want %v",
+					dec.version, ExecFormatVersion))
+				return
+			}
+			if dec.flags&^execFlagsAll != 0 {
+				dec.setErr(fmt.Errorf("unknown header flags 0x%x", dec.flags))
+				return
+			}
+			if dec.flags&ExecFlagBigEndian != 0 != dec.bigEndian {
+				dec.setErr(fmt.Errorf("header byte order does not match the target"))
+				return
+			}
+			dec.varint = dec.flags&ExecFlagVarint != 0
+		case ExecInstrProgID:
+			if started {
+				dec.setErr(fmt.Errorf("program ID is not the first instruction"))
+				return
+			}
+			dec.progID = dec.read()
+			if dec.progID == 0 && dec.err == nil {
+				dec.setErr(fmt.Errorf("zero program ID"))
+				return
+			}
+		case ExecInstrReset:
+			if dec.reset || dec.call.Meta != nil || len(dec.call.Copyin) != 0 || len(dec.calls) != 0 {
+				dec.setErr(fmt.Errorf("memory reset is not at the beginning of the program"))
+				return
+			}
+			dec.reset = true
+		case ExecInstrNop:
+		case ExecInstrCallHash:
+			dec.commitCall()
+			if dec.call.HasHash {
+				dec.setErr(fmt.Errorf("duplicate call hash"))
+				return
+			}
+			dec.call.HasHash = true
+			dec.call.Hash = dec.read()
+		case ExecInstrAsync:
+			dec.commitCall()
+			if dec.call.Async {
+				dec.setErr(fmt.Errorf("duplicate async instruction"))
+				return
+			}
+			dec.call.Async = true
+		case ExecInstrFailNth:
+			dec.commitCall()
+			if dec.call.FailNth != 0 {
+				dec.setErr(fmt.Errorf("duplicate fail nth"))
+				return
+			}
+			dec.call.FailNth = dec.read()
+			if dec.call.FailNth == 0 && dec.err == nil {
+				dec.setErr(fmt.Errorf("zero fail nth"))
+				return
+			}
+		case ExecInstrCallProps:
+			dec.commitCall()
+			if dec.call.Props != nil {
+				dec.setErr(fmt.Errorf("duplicate call props"))
+				return
+			}
+			dec.call.Props = make([]ExecCallProp, dec.readCount(16))
+			for i := range dec.call.Props {
+				prop := ExecCallProp{Key: dec.read(), Value: dec.read()}
+				if i != 0 && prop.Key <= dec.call.Props[i-1].Key && dec.err == nil {
+					dec.setErr(fmt.Errorf("call prop keys are not in increasing order"))
+					return
+				}
+				dec.call.Props[i] = prop
+			}
+		case ExecInstrCallTimeout:
+			dec.commitCall()
+			if dec.call.Timeout != 0 {
+				dec.setErr(fmt.Errorf("duplicate call timeout"))
+				return
+			}
+			dec.call.Timeout = dec.read()
+			if dec.call.Timeout == 0 && dec.err == nil {
+				dec.setErr(fmt.Errorf("zero call timeout"))
+				return
+			}
+		case ExecInstrExpectReturn:
+			if dec.call.Meta == nil || dec.call.HasExpectedRet || len(dec.call.Copyout) != 0 ||
+				len(dec.call.CopyoutData) != 0 {
+				dec.setErr(fmt.Errorf("expected return does not follow a call"))
+				return
+			}
+			dec.call.HasExpectedRet = true
+			dec.call.ExpectedRet = dec.read()
+		case ExecInstrCopyout:
+			if len(dec.call.CopyoutData) != 0 {
+				dec.setErr(fmt.Errorf("copyout follows data copyout"))
+				return
+			}
+			copyout := ExecCopyout{
+				Index: dec.read(),
+				Addr:  dec.read(),
+				Size:  dec.readSize(),
+			}
+			if copyout.Size&ExecCopyoutFlagOnSuccess != 0 {
+				if dec.flags&ExecFlagCopyoutOnSuccess == 0 {
+					dec.setErr(fmt.Errorf("copyout on success without the header flag"))
+					return
+				}
+				copyout.Size &^= ExecCopyoutFlagOnSuccess
+				copyout.OnSuccess = true
+			}
+			dec.call.Copyout = append(dec.call.Copyout, copyout)
+		case ExecInstrCopyoutData:
+			if dec.call.Meta == nil {
+				dec.setErr(fmt.Errorf("data copyout does not follow a call"))
+				return
+			}
+			dec.call.CopyoutData = append(dec.call.CopyoutData, ExecCopyout{
 				Index: dec.read(),
 				Addr:  dec.read(),
-				Size:  dec.read(),
+				Size:  dec.readSize(),
 			})
 		default:
 			dec.commitCall()
-			if instr >= uint64(len(dec.target.Syscalls)) {
+			switch {
+			case dec.target == nil:
+				// Calls are not known without target (see ExecDump).
+				dec.call.Meta = &Syscall{ID: int(instr), Name: fmt.Sprintf("#%v", instr)}
+			case instr >= uint64(len(dec.target.Syscalls)):
 				dec.setErr(fmt.Errorf("bad syscall %v", instr))
 				return
+			default:
+				dec.call.Meta = dec.target.Syscalls[instr]
 			}
-			dec.call.Meta = dec.target.Syscalls[instr]
 			dec.call.Index = dec.read()
-			for i := dec.read(); i > 0; i-- {
+			for i := dec.readCount(execMinArgSize); i > 0 && dec.err == nil; i-- {
 				switch arg := dec.readArg(); arg.(type) {
 				case ExecArgConst, ExecArgResult:
 					dec.call.Args = append(dec.call.Args, arg)
+				case ExecArgBlock:
+					if i != 1 {
+						dec.setErr(fmt.Errorf("arg block is not the last call arg"))
+						return
+					}
+					dec.call.Args = append(dec.call.Args, arg)
 				default:
 					dec.setErr(fmt.Errorf("bad call arg %+v", arg))
 					return
 				}
 			}
-		case execInstrEOF:
+		case ExecInstrEOF:
 			dec.commitCall()
+			if dec.batch && len(dec.calls) != 0 {
+				dec.setErr(fmt.Errorf("no batch separator after last program"))
+			}
 			return
 		}
 	}
@@ -126,34 +450,72 @@ func (dec *execDecoder) parse() {
 
 func (dec *execDecoder) readArg() ExecArg {
 	switch typ := dec.read(); typ {
-	case execArgConst:
-		return ExecArgConst{
-			Size:           dec.read(),
-			Value:          dec.read(),
-			BitfieldOffset: dec.read(),
-			BitfieldLength: dec.read(),
-		}
-	case execArgResult:
-		return ExecArgResult{
-			Size:  dec.read(),
+	case ExecArgTypeConst:
+		arg := ExecArgConst{
+			Size:  dec.readSize(),
+			Value: dec.read(),
+		}
+		if arg.Size&^(ExecArgFlagBigEndian|ExecArgFlagPointer) == 16 {
+			arg.ValueHigh = dec.read()
+		}
+		arg.BitfieldOffset = dec.readSize()
+		arg.BitfieldLength = dec.readSize()
+		return arg
+	case ExecArgTypeResult:
+		arg := ExecArgResult{
+			Size:  dec.readSize(),
 			Index: dec.read(),
 			DivOp: dec.read(),
 			AddOp: dec.read(),
 		}
-	case execArgData:
+		if dec.flags&ExecFlagCopyoutOnSuccess != 0 {
+			arg.Default = dec.read()
+		}
+		return arg
+	case ExecArgTypeArgBlock:
+		block := ExecArgBlock{
+			Args: make([]ExecArg, dec.readCount(execMinArgSize)),
+		}
+		for i := range block.Args {
+			switch arg := dec.readArg(); arg.(type) {
+			case ExecArgConst, ExecArgResult:
+				block.Args[i] = arg
+			default:
+				dec.setErr(fmt.Errorf("bad arg block arg %+v", arg))
+				return nil
+			}
+		}
+		return block
+	case ExecArgTypeData:
+		return ExecArgData{
+			Data: dec.readBlob(dec.readSize()),
+		}
+	case ExecArgTypeDataCompressed:
+		size := dec.readSize()
+		uncompressed := dec.readSize()
+		compressed := dec.readBlob(size)
+		if dec.err != nil {
+			return nil
+		}
+		data, err := decompressExecData(compressed, uncompressed)
+		if err != nil {
+			dec.setErr(err)
+			return nil
+		}
 		return ExecArgData{
-			Data: dec.readBlob(dec.read()),
+			Data:       data,
+			Compressed: compressed,
 		}
-	case execArgCsum:
-		size := dec.read()
+	case ExecArgTypeCsum:
+		size := dec.readSize()
 		switch kind := dec.read(); kind {
 		case ExecArgCsumInet:
-			chunks := make([]ExecCsumChunk, dec.read())
+			chunks := make([]ExecCsumChunk, dec.readCount(execCsumChunkSize))
 			for i := range chunks {
 				chunks[i] = ExecCsumChunk{
 					Kind:  dec.read(),
 					Value: dec.read(),
-					Size:  dec.read(),
+					Size:  dec.readSize(),
 				}
 			}
 			return ExecArgCsum{
@@ -161,6 +523,18 @@ func (dec *execDecoder) readArg() ExecArg {
 				Kind:   kind,
 				Chunks: chunks,
 			}
+		case ExecArgCsumCrc32:
+			chunk := ExecCsumChunk{
+				Kind:  ExecArgCsumChunkData,
+				Value: dec.read(),
+				Size:  dec.readSize(),
+			}
+			return ExecArgCsum{
+				Size:   size,
+				Kind:   kind,
+				Chunks: []ExecCsumChunk{chunk},
+				Poly:   dec.read(),
+			}
 		default:
 			dec.setErr(fmt.Errorf("unknown csum kind %v", kind))
 			return nil
@@ -172,6 +546,18 @@ func (dec *execDecoder) readArg() ExecArg {
 }
 
 func (dec *execDecoder) read() uint64 {
+	if dec.varint {
+		if dec.err != nil {
+			return 0
+		}
+		v, n := binary.Varint(dec.data)
+		if n <= 0 {
+			dec.setErr(fmt.Errorf("exec program overflow"))
+			return 0
+		}
+		dec.data = dec.data[n:]
+		return uint64(v)
+	}
 	if len(dec.data) < 8 {
 		dec.setErr(fmt.Errorf("exec program overflow"))
 	}
@@ -180,25 +566,105 @@ func (dec *execDecoder) read() uint64 {
 	}
 	var v uint64
 	for i := 0; i < 8; i++ {
-		v |= uint64(dec.data[i]) << uint(i*8)
+		if dec.bigEndian {
+			v = v<<8 | uint64(dec.data[i])
+		} else {
+			v |= uint64(dec.data[i]) << uint(i*8)
+		}
 	}
 	dec.data = dec.data[8:]
 	return v
 }
 
+// readSize reads a size word (see ExecInstrSizeWidth).
+func (dec *execDecoder) readSize() uint64 {
+	width := dec.sizeWidth
+	if width == 0 || width == execDefaultSizeWidth {
+		return dec.read()
+	}
+	if uint64(len(dec.data)) < width {
+		dec.setErr(fmt.Errorf("exec program overflow"))
+	}
+	if dec.err != nil {
+		return 0
+	}
+	var v uint64
+	for i := uint64(0); i < width; i++ {
+		if dec.bigEndian {
+			v = v<<8 | uint64(dec.data[i])
+		} else {
+			v |= uint64(dec.data[i]) << (i * 8)
+		}
+	}
+	dec.data = dec.data[width:]
+	return v
+}
+
+// readCount reads number of elements that follow and checks that the rest
+// of the program can hold that many elements of at least minSize bytes each.
+// This prevents huge allocations and long loops on corrupted input.
+func (dec *execDecoder) readCount(minSize uint64) uint64 {
+	n := dec.read()
+	if dec.varint {
+		// Varints take at least 1 byte rather than 8.
+		minSize /= 8
+	} else if dec.sizeWidth != 0 {
+		// Elements contain at least one size word.
+		minSize -= execDefaultSizeWidth - dec.sizeWidth
+	}
+	if n > uint64(len(dec.data))/minSize {
+		dec.setErr(fmt.Errorf("exec program overflow: %v elements", n))
+		return 0
+	}
+	return n
+}
+
 func (dec *execDecoder) readBlob(size uint64) []byte {
-	padded := (size + 7) / 8 * 8
-	if uint64(len(dec.data)) < padded {
+	if uint64(len(dec.data)) < size {
 		dec.setErr(fmt.Errorf("exec program overflow"))
 	}
 	if dec.err != nil {
 		return nil
 	}
+	align := dec.dataAlign
+	if align == 0 {
+		align = execDefaultDataAlign
+	}
+	if dec.varint {
+		align = 1
+	}
+	padded := (size + align - 1) / align * align
+	if padded < size {
+		dec.setErr(fmt.Errorf("exec program overflow"))
+		return nil
+	}
+	if uint64(len(dec.data)) < padded {
+		dec.setErr(fmt.Errorf("exec program overflow"))
+		return nil
+	}
 	data := dec.data[:size]
 	dec.data = dec.data[padded:]
 	return data
 }
 
+// decompressExecData decompresses data of ExecArgTypeDataCompressed
+// and checks that it has the declared size.
+func decompressExecData(compressed []byte, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("bad compressed data: %v", err)
+	}
+	// Don't trust the declared size for allocation.
+	data, err := ioutil.ReadAll(io.LimitReader(zr, int64(size&math.MaxInt64)+1))
+	if err != nil {
+		return nil, fmt.Errorf("bad compressed data: %v", err)
+	}
+	if uint64(len(data)) != size {
+		return nil, fmt.Errorf("compressed data has size %v, declared %v", len(data), size)
+	}
+	return data, nil
+}
+
 func (dec *execDecoder) setErr(err error) {
 	if dec.err == nil {
 		dec.err = err
@@ -217,6 +683,223 @@ func (dec *execDecoder) commitCall() {
 			dec.numVars = copyout.Index + 1
 		}
 	}
+	for _, copyout := range dec.call.CopyoutData {
+		if dec.numVars < copyout.Index+1 {
+			dec.numVars = copyout.Index + 1
+		}
+	}
 	dec.calls = append(dec.calls, dec.call)
 	dec.call = ExecCall{}
 }
+
+// AnnotateResults sets Producer of all result args of the program
+// according to names of copyout indices (see Prog.CopyoutNames).
+func (p ExecProg) AnnotateResults(names map[uint64]string) {
+	var annotate func(args []ExecArg)
+	annotate = func(args []ExecArg) {
+		for i, arg := range args {
+			switch a := arg.(type) {
+			case ExecArgResult:
+				a.Producer = names[a.Index]
+				args[i] = a
+			case ExecArgBlock:
+				annotate(a.Args)
+			}
+		}
+	}
+	for _, call := range p.Calls {
+		annotate(call.Args)
+		for i := range call.Copyin {
+			if a, ok := call.Copyin[i].Arg.(ExecArgResult); ok {
+				a.Producer = names[a.Index]
+				call.Copyin[i].Arg = a
+			}
+		}
+	}
+}
+
+// encode serializes the program back into the exec format.
+func (p ExecProg) encode() []byte {
+	e := &execEncoder{
+		order:          binary.LittleEndian,
+		resultDefaults: p.Flags&ExecFlagCopyoutOnSuccess != 0,
+	}
+	if p.bigEndian {
+		e.order = binary.BigEndian
+	}
+	if p.Version != 0 {
+		e.write(ExecInstrHeader, ExecFormatMagic<<32|p.Version<<16|p.Flags)
+	}
+	e.varint = p.varint
+	if p.ProgID != 0 {
+		e.write(ExecInstrProgID, p.ProgID)
+	}
+	if p.Reset {
+		e.write(ExecInstrReset)
+	}
+	for _, call := range p.Calls {
+		for _, copyin := range call.Copyin {
+			switch a := copyin.Arg.(type) {
+			case ExecArgFill:
+				e.write(ExecInstrCopyinFill, copyin.Addr, a.Size, a.Value)
+				continue
+			case ExecArgUnionOption:
+				e.write(ExecInstrUnionOption, copyin.Addr, a.Index)
+				continue
+			}
+			e.write(ExecInstrCopyin, copyin.Addr)
+			e.writeArg(copyin.Arg)
+		}
+		if call.Repeat != 0 {
+			e.write(ExecInstrRepeat, call.Repeat)
+		}
+		if call.HasHash {
+			e.write(ExecInstrCallHash, call.Hash)
+		}
+		if call.Timeout != 0 {
+			e.write(ExecInstrCallTimeout, call.Timeout)
+		}
+		if call.Async {
+			e.write(ExecInstrAsync)
+		}
+		if call.FailNth != 0 {
+			e.write(ExecInstrFailNth, call.FailNth)
+		}
+		if call.Props != nil {
+			e.write(ExecInstrCallProps, uint64(len(call.Props)))
+			for _, prop := range call.Props {
+				e.write(prop.Key, prop.Value)
+			}
+		}
+		e.write(uint64(call.Meta.ID), call.Index, uint64(len(call.Args)))
+		for _, arg := range call.Args {
+			e.writeArg(arg)
+		}
+		if call.HasExpectedRet {
+			e.write(ExecInstrExpectReturn, call.ExpectedRet)
+		}
+		for _, copyout := range call.Copyout {
+			size := copyout.Size
+			if copyout.OnSuccess {
+				size |= ExecCopyoutFlagOnSuccess
+			}
+			e.write(ExecInstrCopyout, copyout.Index, copyout.Addr, size)
+		}
+		for _, copyout := range call.CopyoutData {
+			e.write(ExecInstrCopyoutData, copyout.Index, copyout.Addr, copyout.Size)
+		}
+	}
+	e.write(ExecInstrEOF)
+	return e.buf
+}
+
+// execEncoder writes the exec format for ExecProg.encode.
+type execEncoder struct {
+	buf            []byte
+	order          binary.ByteOrder
+	varint         bool // words are varints and data is not padded (ExecOpts.Varint)
+	resultDefaults bool // result args have ExecArgResult.Default (ExecFlagCopyoutOnSuccess)
+	word           [binary.MaxVarintLen64]byte
+}
+
+func (e *execEncoder) write(words ...uint64) {
+	for _, v := range words {
+		if e.varint {
+			n := binary.PutVarint(e.word[:], int64(v))
+			e.buf = append(e.buf, e.word[:n]...)
+			continue
+		}
+		e.order.PutUint64(e.word[:], v)
+		e.buf = append(e.buf, e.word[:8]...)
+	}
+}
+
+// writeBlob writes data padded to 8 bytes (not padded with varints).
+func (e *execEncoder) writeBlob(data []byte) {
+	e.buf = append(e.buf, data...)
+	for !e.varint && len(e.buf)%8 != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *execEncoder) writeArg(arg ExecArg) {
+	switch a := arg.(type) {
+	case ExecArgConst:
+		if a.Size&^(ExecArgFlagBigEndian|ExecArgFlagPointer) == 16 {
+			e.write(ExecArgTypeConst, a.Size, a.Value, a.ValueHigh, a.BitfieldOffset, a.BitfieldLength)
+			return
+		}
+		e.write(ExecArgTypeConst, a.Size, a.Value, a.BitfieldOffset, a.BitfieldLength)
+	case ExecArgResult:
+		e.write(ExecArgTypeResult, a.Size, a.Index, a.DivOp, a.AddOp)
+		if e.resultDefaults {
+			e.write(a.Default)
+		}
+	case ExecArgBlock:
+		e.write(ExecArgTypeArgBlock, uint64(len(a.Args)))
+		for _, arg := range a.Args {
+			e.writeArg(arg)
+		}
+	case ExecArgData:
+		if a.Compressed != nil {
+			e.write(ExecArgTypeDataCompressed, uint64(len(a.Compressed)), uint64(len(a.Data)))
+			e.writeBlob(a.Compressed)
+			return
+		}
+		e.write(ExecArgTypeData, uint64(len(a.Data)))
+		e.writeBlob(a.Data)
+	case ExecArgCsum:
+		if a.Kind == ExecArgCsumCrc32 {
+			e.write(ExecArgTypeCsum, a.Size, a.Kind, a.Chunks[0].Value, a.Chunks[0].Size, a.Poly)
+			return
+		}
+		e.write(ExecArgTypeCsum, a.Size, a.Kind, uint64(len(a.Chunks)))
+		for _, chunk := range a.Chunks {
+			e.write(chunk.Kind, chunk.Value, chunk.Size)
+		}
+	default:
+		panic(fmt.Sprintf("unknown exec arg %#v", arg))
+	}
+}
+
+// CheckExecRoundTrip checks that serialized program p is decoded and encoded again
+// into the same byte stream. A failure means a bug in the encoder or in the decoder.
+func (p *Prog) CheckExecRoundTrip(pid int) error {
+	size, err := p.ExecByteSize(pid)
+	if err != nil {
+		return err
+	}
+	exec := make([]byte, size)
+	if _, err := p.SerializeForExec(exec, pid); err != nil {
+		return err
+	}
+	return p.Target.checkExecRoundTrip(exec)
+}
+
+func (target *Target) checkExecRoundTrip(exec []byte) error {
+	decoded, err := target.DeserializeExec(exec)
+	if err != nil {
+		return fmt.Errorf("failed to decode: %v", err)
+	}
+	encoded := decoded.encode()
+	if decoded.varint {
+		// Varint words are not aligned, so only whole programs can be compared.
+		if !bytes.Equal(exec, encoded) {
+			return fmt.Errorf("re-encoded program differs")
+		}
+		return nil
+	}
+	for i := 0; i < len(exec) || i < len(encoded); i += 8 {
+		if i >= len(exec) || i >= len(encoded) {
+			return fmt.Errorf("re-encoded program has %v bytes, original has %v bytes",
+				len(encoded), len(exec))
+		}
+		orig := target.execByteOrder().Uint64(exec[i:])
+		got := target.execByteOrder().Uint64(encoded[i:])
+		if orig != got {
+			return fmt.Errorf("re-encoded program differs at word %v (offset 0x%x): 0x%x, original 0x%x",
+				i/8, i, got, orig)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func FuzzDeserializeExec(f *testing.F) {
+	target, err := GetTarget("linux", "amd64")
+	if err != nil {
+		f.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	buf := make([]byte, ExecBufferSize)
+	for i := 0; i < 20; i++ {
+		p := target.Generate(rs, 10, nil)
+		n, err := p.SerializeForExec(buf, i%16)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(append([]byte{}, buf[:n]...))
+		// Truncated programs exercise overflow checks.
+		f.Add(append([]byte{}, buf[:n/2]...))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The only requirement is that decoding terminates without panics
+		// and huge allocations regardless of the input.
+		target.DeserializeExec(data)
+	})
+}
+
+func TestDeserializeExecHugeCount(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	callID := uint64(target.SyscallMap["syz_test$int"].ID)
+	dataOffset := target.DataOffset
+	tests := [][]uint64{
+		// Number of call args.
+		{callID, ExecNoCopyout, 1 << 60, ExecInstrEOF},
+		// Number of csum chunks.
+		{ExecInstrCopyin, dataOffset, ExecArgTypeCsum, 2, ExecArgCsumInet, 1 << 60, ExecInstrEOF},
+		// Size of data arg.
+		{ExecInstrCopyin, dataOffset, ExecArgTypeData, 1 << 60, ExecInstrEOF},
+		{ExecInstrCopyin, dataOffset, ExecArgTypeData, ^uint64(0), ExecInstrEOF},
+	}
+	for i, test := range tests {
+		data := new(bytes.Buffer)
+		binary.Write(data, binary.LittleEndian, test)
+		_, err := target.DeserializeExec(data.Bytes())
+		if err == nil || !strings.Contains(err.Error(), "overflow") {
+			t.Errorf("test %v: got error %v, want overflow", i, err)
+		}
+	}
+}
+
+func TestDeserializeExecCsumOrder(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte("syz_test$csum_ipv4_tcp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {{0x0}, \"abcd\"}})"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := target.DeserializeExec(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ncsum := 0
+	for _, copyin := range decoded.Calls[0].Copyin {
+		if _, ok := copyin.Arg.(ExecArgCsum); ok {
+			ncsum++
+		}
+	}
+	if ncsum != 2 {
+		t.Fatalf("got %v checksum copyins, want 2", ncsum)
+	}
+}
+
+func TestCheckExecRoundTrip(t *testing.T) {
+	target, rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		if err := p.CheckExecRoundTrip(i % 16); err != nil {
+			t.Fatalf("%v\n%s", err, p.Serialize())
+		}
+	}
+}
+
+func TestCheckExecRoundTripCorrupted(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte("syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CheckExecRoundTrip(0); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate an encoder that leaves garbage in padding of data args.
+	exec := buf[:n]
+	pad := bytes.Index(exec, []byte{1, 2, 3, 4, 5}) + 5
+	exec[pad] = 0xff
+	err = target.checkExecRoundTrip(exec)
+	if err == nil {
+		t.Fatalf("corrupted program passed round trip check")
+	}
+	want := fmt.Sprintf("re-encoded program differs at word %v", pad/8)
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got error %q, want %q", err, want)
+	}
+}
+
+func TestExecAnnotateResults(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p, err := target.Deserialize([]byte(`r0 = openat(0xffffffffffffff9c, &(0x7f0000000000)='./file0\x00', 0x0, 0x0)
+pipe(&(0x7f0000001000)={<r1=>0xffffffffffffffff, <r2=>0xffffffffffffffff})
+dup2(r0, r2)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := target.DeserializeExec(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded.AnnotateResults(p.CopyoutNames(0))
+	want := []string{"ref(idx=0 <- openat.fd)", "ref(idx=1 <- pipe.wfd)"}
+	var got []string
+	for _, arg := range decoded.Calls[2].Args {
+		got = append(got, fmt.Sprint(arg))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got annotated args %q, want %q", got, want)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // String generates a very compact program description (mostly for debug output).
@@ -48,11 +49,37 @@ func (p *Prog) Serialize() []byte {
 			}
 			serialize(a, buf, vars, &varSeq)
 		}
-		fmt.Fprintf(buf, ")\n")
+		fmt.Fprintf(buf, ")")
+		serializeCallAttrs(buf, c)
+		fmt.Fprintf(buf, "\n")
 	}
 	return buf.Bytes()
 }
 
+// serializeCallAttrs writes attributes of call c that are not part of its arguments
+// (e.g. " (repeat: 3)"), nothing is written if all of them have default values.
+func serializeCallAttrs(buf *bytes.Buffer, c *Call) {
+	var attrs []string
+	if c.Repeat != 0 {
+		attrs = append(attrs, fmt.Sprintf("repeat: %v", c.Repeat))
+	}
+	if c.Async {
+		attrs = append(attrs, "async")
+	}
+	if c.FailNth != 0 {
+		attrs = append(attrs, fmt.Sprintf("fail_nth: %v", c.FailNth))
+	}
+	if c.Props.CollideGroup != 0 {
+		attrs = append(attrs, fmt.Sprintf("collide_group: %v", c.Props.CollideGroup))
+	}
+	if c.Props.Sandbox != 0 {
+		attrs = append(attrs, fmt.Sprintf("sandbox: %v", c.Props.Sandbox))
+	}
+	if len(attrs) != 0 {
+		fmt.Fprintf(buf, " (%v)", strings.Join(attrs, ", "))
+	}
+}
+
 func serialize(arg Arg, buf *bytes.Buffer, vars map[Arg]int, varSeq *int) {
 	if arg == nil {
 		fmt.Fprintf(buf, "nil")
@@ -65,8 +92,16 @@ func serialize(arg Arg, buf *bytes.Buffer, vars map[Arg]int, varSeq *int) {
 	}
 	switch a := arg.(type) {
 	case *ConstArg:
+		if a.ValHigh != 0 {
+			fmt.Fprintf(buf, "0x%x%016x", a.ValHigh, a.Val)
+			break
+		}
 		fmt.Fprintf(buf, "0x%x", a.Val)
 	case *PointerArg:
+		if a.IsNull {
+			fmt.Fprintf(buf, "nil")
+			break
+		}
 		if a.Res == nil && a.PagesNum == 0 {
 			fmt.Fprintf(buf, "0x0")
 			break
@@ -178,6 +213,11 @@ func (target *Target) Deserialize(data []byte) (prog *Prog, err error) {
 			}
 		}
 		p.Parse(')')
+		if !p.EOF() && p.Char() == '(' {
+			if err := parseCallAttrs(p, c); err != nil {
+				return nil, err
+			}
+		}
 		if !p.EOF() {
 			return nil, fmt.Errorf("tailing data (line #%v)", p.l)
 		}
@@ -205,6 +245,59 @@ func (target *Target) Deserialize(data []byte) (prog *Prog, err error) {
 	return
 }
 
+// parseCallAttrs parses attributes written by serializeCallAttrs into call c.
+func parseCallAttrs(p *parser, c *Call) error {
+	p.Parse('(')
+	for p.Err() == nil && p.Char() != ')' {
+		name := p.Ident()
+		switch name {
+		case "repeat":
+			v, err := parseCallAttrVal(p, name)
+			if err != nil {
+				return err
+			}
+			c.Repeat = v
+		case "async":
+			c.Async = true
+		case "fail_nth":
+			v, err := parseCallAttrVal(p, name)
+			if err != nil {
+				return err
+			}
+			c.FailNth = v
+		case "collide_group":
+			v, err := parseCallAttrVal(p, name)
+			if err != nil {
+				return err
+			}
+			c.Props.CollideGroup = v
+		case "sandbox":
+			v, err := parseCallAttrVal(p, name)
+			if err != nil {
+				return err
+			}
+			c.Props.Sandbox = v
+		default:
+			return fmt.Errorf("unknown call attribute %q (line #%v)", name, p.l)
+		}
+		if p.Char() != ')' {
+			p.Parse(',')
+		}
+	}
+	p.Parse(')')
+	return p.Err()
+}
+
+func parseCallAttrVal(p *parser, name string) (uint64, error) {
+	p.Parse(':')
+	val := p.Ident()
+	v, err := strconv.ParseUint(val, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("wrong call attribute %v value '%v': %v", name, val, err)
+	}
+	return v, nil
+}
+
 func (target *Target) parseArg(typ Type, p *parser, vars map[string]Arg) (Arg, error) {
 	r := ""
 	if p.Char() == '<' {
@@ -217,6 +310,15 @@ func (target *Target) parseArg(typ Type, p *parser, vars map[string]Arg) (Arg, e
 	switch p.Char() {
 	case '0':
 		val := p.Ident()
+		if t, ok := typ.(*IntType); ok && t.Size() == 16 {
+			lo, hi, err := parseValue128(val)
+			if err != nil {
+				return nil, fmt.Errorf("wrong arg value '%v': %v", val, err)
+			}
+			arg = MakeConstArg(typ, lo)
+			arg.(*ConstArg).ValHigh = hi
+			break
+		}
 		v, err := strconv.ParseUint(val, 0, 64)
 		if err != nil {
 			return nil, fmt.Errorf("wrong arg value '%v': %v", val, err)
@@ -399,6 +501,10 @@ func (target *Target) parseArg(typ Type, p *parser, vars map[string]Arg) (Arg, e
 		if r != "" {
 			return nil, fmt.Errorf("named nil argument")
 		}
+		switch typ.(type) {
+		case *PtrType, *VmaType:
+			arg = MakeNullPointerArg(typ)
+		}
 	default:
 		return nil, fmt.Errorf("failed to parse argument at %v (line #%v/%v: %v)", int(p.Char()), p.l, p.i, p.s)
 	}
@@ -445,6 +551,20 @@ func serializeAddr(arg Arg) string {
 	return fmt.Sprintf("(0x%x%v%v)", page, soff, ssize)
 }
 
+// parseValue128 parses value of a 16-byte int, hex values can have up to 32 digits.
+func parseValue128(val string) (lo, hi uint64, err error) {
+	if len(val) <= 2+16 || !strings.HasPrefix(val, "0x") {
+		lo, err = strconv.ParseUint(val, 0, 64)
+		return
+	}
+	digits := val[2:]
+	if hi, err = strconv.ParseUint(digits[:len(digits)-16], 16, 64); err != nil {
+		return
+	}
+	lo, err = strconv.ParseUint(digits[len(digits)-16:], 16, 64)
+	return
+}
+
 func parseAddr(p *parser, base bool) (uint64, int, uint64, error) {
 	p.Parse('(')
 	pstr := p.Ident()
@@ -175,6 +175,10 @@ func TestSerializeDeserialize(t *testing.T) {
 			`serialize1(&(0x7f0000000000)="0000000000000000", 0x8)`,
 			`serialize1(&(0x7f0000000000)=""/8, 0x8)`,
 		},
+		{
+			`syz_test$opt1(nil)`,
+			`syz_test$opt1(nil)`,
+		},
 	}
 	for _, test := range tests {
 		p, err := target.Deserialize([]byte(test[0]))
@@ -188,3 +192,57 @@ func TestSerializeDeserialize(t *testing.T) {
 		}
 	}
 }
+
+func TestSerializeCallAttrs(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		data    string
+		repeat  uint64
+		async   bool
+		failNth uint64
+		props   CallProps
+	}{
+		{`syz_test$opt1(nil)`, 0, false, 0, CallProps{}},
+		{`syz_test$opt1(nil) (repeat: 3)`, 3, false, 0, CallProps{}},
+		{`r0 = syz_test$res0()
+syz_test$res1(r0) (repeat: 100)`, 100, false, 0, CallProps{}},
+		{`syz_test$opt1(nil) (async)`, 0, true, 0, CallProps{}},
+		{`syz_test$opt1(nil) (repeat: 2, async)`, 2, true, 0, CallProps{}},
+		{`syz_test$opt1(nil) (fail_nth: 5)`, 0, false, 5, CallProps{}},
+		{`syz_test$opt1(nil) (repeat: 2, async, fail_nth: 1)`, 2, true, 1, CallProps{}},
+		{`syz_test$opt1(nil) (collide_group: 1)`, 0, false, 0, CallProps{CollideGroup: 1}},
+		{`syz_test$opt1(nil) (async, collide_group: 2, sandbox: 3)`, 0, true, 0,
+			CallProps{CollideGroup: 2, Sandbox: ExecSandboxNamespace}},
+	}
+	for _, test := range tests {
+		p, err := target.Deserialize([]byte(test.data))
+		if err != nil {
+			t.Fatalf("failed to deserialize: %v\n%s", err, test.data)
+		}
+		if c := p.Calls[len(p.Calls)-1]; c.Repeat != test.repeat || c.Async != test.async ||
+			c.FailNth != test.failNth || c.Props != test.props {
+			t.Fatalf("got repeat %v, async %v, fail nth %v, props %+v, want %v, %v, %v, %+v\n%s",
+				c.Repeat, c.Async, c.FailNth, c.Props,
+				test.repeat, test.async, test.failNth, test.props, test.data)
+		}
+		if data := string(p.Serialize()); data != test.data+"\n" {
+			t.Fatalf("\ngot : %s\nwant: %s", data, test.data)
+		}
+		if data := string(p.Clone().Serialize()); data != test.data+"\n" {
+			t.Fatalf("clone lost attributes:\ngot : %s\nwant: %s", data, test.data)
+		}
+	}
+	for _, data := range []string{
+		`syz_test$opt1(nil) (repeat: x)`,
+		`syz_test$opt1(nil) (foo: 1)`,
+		`syz_test$opt1(nil) (repeat: 1`,
+		`syz_test$opt1(nil) (repeat: 1) 1`,
+		`syz_test$opt1(nil) (async: 1)`,
+		`syz_test$opt1(nil) (fail_nth: -1)`,
+		`syz_test$opt1(nil) (sandbox)`,
+	} {
+		if _, err := target.Deserialize([]byte(data)); err == nil {
+			t.Fatalf("deserialization should have failed:\n%s", data)
+		}
+	}
+}
@@ -5,52 +5,282 @@
 // The format aims at simple parsing: binary and irreversible.
 
 // Exec format is an sequence of uint64's which encodes a sequence of calls.
-// The sequence is terminated by a speciall call execInstrEOF.
-// Each call is (call ID, copyout index, number of arguments, arguments...).
+// The sequence is terminated by a special call ExecInstrEOF.
+// Words are little-endian, or big-endian for targets with Target.BigEndian.
+// With ExecOpts.Varint all words after ExecInstrHeader
+// are zigzag varint-encoded and data is not padded.
+// With ExecOpts.AppendChecksum ExecInstrEOF is followed by CRC32 of the preceding bytes.
+// With ExecOpts.RelativePointers all addresses are offsets from the data region base.
+// With ExecOpts.SizeWidth size words (sizes of args, copyouts, fills and checksum chunks,
+// lengths of data args) and bitfield offsets and lengths are narrowed to 2 or 4 bytes.
+// Each call is (call ID, copyout index, number of arguments, arguments...),
+// with ExecOpts.EmitSyscallNR call ID is replaced with the kernel syscall number.
+// Arguments are ordered according to Target.ExecArgOrder, if the target defines it.
+// Arguments beyond Target.ExecRegArgs are passed in a memory block (ExecArgTypeArgBlock).
 // Each argument is (type, size, value).
-// There are 4 types of arguments:
-//  - execArgConst: value is const value
-//  - execArgResult: value is copyout index we want to reference
-//  - execArgData: value is a binary blob (represented as ]size/8[ uint64's)
-//  - execArgCsum: runtime checksum calculation
-// There are 2 other special calls:
-//  - execInstrCopyin: copies its second argument into address specified by first argument
-//  - execInstrCopyout: reads value at address specified by first argument (result can be referenced by execArgResult)
+// If ExecOpts.EmitTypeIDs is set, each argument is preceded by Target.TypeID of its type.
+// There are 6 types of arguments:
+//  - ExecArgTypeConst: value is const value, bitfields sharing a storage unit
+//    are combined into a single copyin; 16-byte values are two words (low, high)
+//  - ExecArgTypeResult: value is (copyout index we want to reference, div, add),
+//    with ExecOpts.CopyoutOnSuccess followed by the default value used if the result
+//    was not copied out
+//  - ExecArgTypeData: value is a binary blob (represented as ]size/8[ uint64's,
+//    or padded to ExecOpts.DataAlign bytes)
+//  - ExecArgTypeCsum: runtime checksum calculation, (type, size, kind, kind-specific words):
+//    ExecArgCsumInet is followed by number of chunks and the chunks,
+//    ExecArgCsumCrc32 is followed by (address, size, polynomial) of the checksummed range,
+//    the polynomial is in reversed form (crc32.IEEE for crc32, crc32.Castagnoli for crc32c)
+//  - ExecArgTypeArgBlock: (type, number of args, args...), the last arg of calls with args
+//    that are not passed in registers, executor places values of the args into a memory block
+//    of 8-byte slots and passes address of the block instead
+//  - ExecArgTypeDataCompressed: (type, size, uncompressed size, blob) is ExecArgTypeData
+//    with zlib-compressed blob, used for large data args only with ExecOpts.CompressData
+// There are 19 other special calls:
+//  - ExecInstrCopyin: copies its second argument into address specified by first argument
+//  - ExecInstrCopyout: reads value at address specified by first argument (result can be referenced by ExecArgTypeResult),
+//    (index, address, size), with ExecCopyoutFlagOnSuccess in size the value is read only if the call succeeded
+//  - ExecInstrBatchSep: separates programs in a batch, copyout results are reset after it
+//  - ExecInstrRepeat: executes the next call the number of times specified by its argument,
+//    copyout results are captured after the last iteration
+//  - ExecInstrCopyinFill: fills (address, size) memory range with a byte value,
+//    used instead of ExecInstrCopyin for large uniform data
+//  - ExecInstrUnionOption: (address, option index) of a union selected by the call,
+//    emitted only with ExecOpts.EmitUnionOptions
+//  - ExecInstrDataAlign: sets padding of the following data args to its argument,
+//    emitted at the beginning of the program only with non-default ExecOpts.DataAlign
+//  - ExecInstrExpectReturn: expected return value of the preceding call,
+//    emitted only for calls in ExecOpts.ExpectedReturns
+//  - ExecInstrProgID: caller-supplied program ID for correlation of executor logs,
+//    emitted as the first instruction of the program only with non-zero ExecOpts.ProgID
+//  - ExecInstrSizeWidth: sets width of the following size words to its argument,
+//    emitted at the beginning of the program only with non-default ExecOpts.SizeWidth
+//  - ExecInstrReset: zeroes the data region before the program, emitted as the first
+//    instruction (following ExecInstrProgID, if any) only with ExecOpts.ResetMemory
+//  - ExecInstrNop: does nothing, emitted before calls only with ExecOpts.AlignCalls
+//  - ExecInstrCallHash: hash of the shape of the next call (see CallHash) that executor
+//    reports with coverage of the call, emitted only with ExecOpts.EmitCallHash
+//  - ExecInstrHeader: ExecFormatMagic<<32 | ExecFormatVersion<<16 | ExecFlag* flags,
+//    emitted as the very first instruction of the program only with ExecOpts.EmitHeader,
+//    so that executor can refuse programs in a format it does not support;
+//    the instruction and its value are always 8-byte words, even with ExecOpts.Varint
+//  - ExecInstrCallTimeout: timeout of the next call in milliseconds (see Syscall.Timeout),
+//    so that executor can abort just the hanging call instead of the whole program,
+//    emitted only with ExecOpts.EmitCallTimeout for calls with a timeout
+//  - ExecInstrAsync: the next call is issued on a separate thread without waiting
+//    for its completion, executor waits for all async calls at the end of the program
+//    before reading their copyouts, emitted only with ExecOpts.AsyncCalls for Call.Async
+//  - ExecInstrFailNth: executor enables fault injection (as in /proc/thread-self/fail-nth)
+//    for the next call to fail the operation with the given 1-based number,
+//    emitted only with ExecOpts.EmitFailNth for calls with non-zero Call.FailNth
+//  - ExecInstrCopyoutData: (copyout index, address, size) of an out data arg of the preceding
+//    call that executor reads after the call and reports as a whole (rather than as a result
+//    that can be referenced by ExecArgTypeResult), emitted only with ExecOpts.CopyoutData
+//  - ExecInstrCallProps: (number of properties, (ExecCallProp* key, value)...) of the next call
+//    with keys in increasing order, executor ignores properties it does not know,
+//    emitted only with ExecOpts.EmitCallProps for calls with non-zero Call.Props
 
 package prog
 
 import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Values of the constants below are part of the contract with executor
+// implementations and are not changed once released. Alternative executors
+// can obtain them programmatically with ExecFormatConstants.
+
+// Instructions. Any other instruction value is a call ID.
+const (
+	ExecInstrEOF = ^uint64(iota)
+	ExecInstrCopyin
+	ExecInstrCopyout
+	ExecInstrBatchSep
+	ExecInstrRepeat
+	ExecInstrCopyinFill
+	ExecInstrUnionOption
+	ExecInstrDataAlign
+	ExecInstrExpectReturn
+	ExecInstrProgID
+	ExecInstrSizeWidth
+	ExecInstrReset
+	ExecInstrNop
+	ExecInstrCallHash
+	ExecInstrHeader
+	ExecInstrCallTimeout
+	ExecInstrAsync
+	ExecInstrFailNth
+	ExecInstrCopyoutData
+	ExecInstrCallProps
+)
+
+// execInstrMin is the smallest instruction value, smaller values are call IDs.
+const execInstrMin = ExecInstrCallProps
+
+// Exec format identification for ExecInstrHeader.
+const (
+	ExecFormatMagic = uint64(0x53595a45) // "SYZE"
+	// ExecFormatVersion is incremented on incompatible changes of the format.
+	// Version 0 means the format without ExecInstrHeader.
+	ExecFormatVersion = uint64(1)
+)
+
+// Flags in ExecInstrHeader that describe options that change interpretation of the program.
 const (
-	execInstrEOF = ^uint64(iota)
-	execInstrCopyin
-	execInstrCopyout
+	ExecFlagArgByteOrder     = uint64(1) << 0 // ExecOpts.ArgByteOrder
+	ExecFlagRelativePointers = uint64(1) << 1 // ExecOpts.RelativePointers
+	ExecFlagTypeIDs          = uint64(1) << 2 // ExecOpts.EmitTypeIDs
+	ExecFlagSyscallNR        = uint64(1) << 3 // ExecOpts.EmitSyscallNR
+	ExecFlagBigEndian        = uint64(1) << 4 // Target.BigEndian
+	ExecFlagCopyoutOnSuccess = uint64(1) << 5 // ExecOpts.CopyoutOnSuccess
+	ExecFlagVarint           = uint64(1) << 6 // ExecOpts.Varint
+
+	execFlagsAll = ExecFlagArgByteOrder | ExecFlagRelativePointers | ExecFlagTypeIDs | ExecFlagSyscallNR |
+		ExecFlagBigEndian | ExecFlagCopyoutOnSuccess | ExecFlagVarint
+)
+
+// Keys of ExecInstrCallProps, see CallProps.
+const (
+	ExecCallPropCollideGroup = uint64(iota)
+	ExecCallPropSandbox
+	ExecCallPropRerun // Call.Repeat
 )
 
+// Values of ExecCallPropSandbox.
 const (
-	execArgConst = uint64(iota)
-	execArgResult
-	execArgData
-	execArgCsum
+	ExecSandboxNone = uint64(iota + 1)
+	ExecSandboxSetuid
+	ExecSandboxNamespace
 )
 
+// Argument types.
+const (
+	ExecArgTypeConst = uint64(iota)
+	ExecArgTypeResult
+	ExecArgTypeData
+	ExecArgTypeCsum
+	ExecArgTypeArgBlock
+	ExecArgTypeDataCompressed
+)
+
+// Checksum kinds for ExecArgTypeCsum.
 const (
 	ExecArgCsumInet = uint64(iota)
+	ExecArgCsumCrc32
 )
 
+// Checksum chunk kinds for ExecArgCsumInet.
 const (
 	ExecArgCsumChunkData = uint64(iota)
 	ExecArgCsumChunkConst
 )
 
+// ExecArgFlagBigEndian is set in the size of const and result args
+// if ExecOpts.ArgByteOrder is enabled and the arg is big-endian on a little-endian target.
+// The value of such arg is in host byte order and executor needs to swap it.
+const ExecArgFlagBigEndian = uint64(1) << 15
+
+// ExecArgFlagPointer is set in the size of const args that point into the data region
+// if ExecOpts.RelativePointers is enabled. The value of such arg is an offset
+// from the data region base and executor needs to add the base to it.
+const ExecArgFlagPointer = uint64(1) << 14
+
+// ExecCopyoutFlagOnSuccess is set in the size of ExecInstrCopyout if ExecOpts.CopyoutOnSuccess
+// is enabled. Executor skips such copyout if the call failed, so that result args
+// referencing it use their default value instead of garbage left in memory.
+const ExecCopyoutFlagOnSuccess = uint64(1) << 15
+
 const (
 	ExecBufferSize = 2 << 20
 	ExecNoCopyout  = ^uint64(0)
+
+	// ExecMaxInstrs is the default limit on the number of instructions in a program.
+	// Programs with more instructions take too long to execute and look like hangs.
+	ExecMaxInstrs = 32 << 10
+	// ExecMaxBlobLen is the default limit on the length of data args,
+	// so that a single blob can't consume the whole buffer.
+	ExecMaxBlobLen = 1 << 20
+
+	// Uniform data args of at least this size are emitted as ExecInstrCopyinFill.
+	execMinFillSize = 64
+	// Data args of at least this size are compressed with ExecOpts.CompressData.
+	execMinCompressSize = 4 << 10
+
+	execDefaultDataAlign = 8
+	execMaxDataAlign     = 4 << 10
+	execDefaultSizeWidth = 8
 )
 
+// ExecFormatConstants returns names and values of all exec format constants.
+// It is intended for generation of bindings for executors written in other languages.
+func ExecFormatConstants() map[string]uint64 {
+	return map[string]uint64{
+		"ExecInstrEOF":              ExecInstrEOF,
+		"ExecInstrCopyin":           ExecInstrCopyin,
+		"ExecInstrCopyout":          ExecInstrCopyout,
+		"ExecInstrBatchSep":         ExecInstrBatchSep,
+		"ExecInstrRepeat":           ExecInstrRepeat,
+		"ExecInstrCopyinFill":       ExecInstrCopyinFill,
+		"ExecInstrUnionOption":      ExecInstrUnionOption,
+		"ExecInstrDataAlign":        ExecInstrDataAlign,
+		"ExecInstrExpectReturn":     ExecInstrExpectReturn,
+		"ExecInstrProgID":           ExecInstrProgID,
+		"ExecInstrSizeWidth":        ExecInstrSizeWidth,
+		"ExecInstrReset":            ExecInstrReset,
+		"ExecInstrNop":              ExecInstrNop,
+		"ExecInstrCallHash":         ExecInstrCallHash,
+		"ExecInstrHeader":           ExecInstrHeader,
+		"ExecInstrCallTimeout":      ExecInstrCallTimeout,
+		"ExecInstrAsync":            ExecInstrAsync,
+		"ExecInstrFailNth":          ExecInstrFailNth,
+		"ExecInstrCopyoutData":      ExecInstrCopyoutData,
+		"ExecInstrCallProps":        ExecInstrCallProps,
+		"ExecCallPropCollideGroup":  ExecCallPropCollideGroup,
+		"ExecCallPropSandbox":       ExecCallPropSandbox,
+		"ExecCallPropRerun":         ExecCallPropRerun,
+		"ExecSandboxNone":           ExecSandboxNone,
+		"ExecSandboxSetuid":         ExecSandboxSetuid,
+		"ExecSandboxNamespace":      ExecSandboxNamespace,
+		"ExecFormatMagic":           ExecFormatMagic,
+		"ExecFormatVersion":         ExecFormatVersion,
+		"ExecFlagArgByteOrder":      ExecFlagArgByteOrder,
+		"ExecFlagRelativePointers":  ExecFlagRelativePointers,
+		"ExecFlagTypeIDs":           ExecFlagTypeIDs,
+		"ExecFlagSyscallNR":         ExecFlagSyscallNR,
+		"ExecFlagBigEndian":         ExecFlagBigEndian,
+		"ExecFlagCopyoutOnSuccess":  ExecFlagCopyoutOnSuccess,
+		"ExecFlagVarint":            ExecFlagVarint,
+		"ExecCopyoutFlagOnSuccess":  ExecCopyoutFlagOnSuccess,
+		"ExecArgTypeConst":          ExecArgTypeConst,
+		"ExecArgTypeResult":         ExecArgTypeResult,
+		"ExecArgTypeData":           ExecArgTypeData,
+		"ExecArgTypeCsum":           ExecArgTypeCsum,
+		"ExecArgTypeArgBlock":       ExecArgTypeArgBlock,
+		"ExecArgTypeDataCompressed": ExecArgTypeDataCompressed,
+		"ExecArgCsumInet":           ExecArgCsumInet,
+		"ExecArgCsumCrc32":          ExecArgCsumCrc32,
+		"ExecArgCsumChunkData":      ExecArgCsumChunkData,
+		"ExecArgCsumChunkConst":     ExecArgCsumChunkConst,
+		"ExecArgFlagBigEndian":      ExecArgFlagBigEndian,
+		"ExecArgFlagPointer":        ExecArgFlagPointer,
+		"ExecNoCopyout":             ExecNoCopyout,
+	}
+}
+
 type Args []Arg
 
 func (s Args) Len() int {
@@ -61,249 +291,2561 @@ func (s Args) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+// ByPhysicalAddr sorts args by their physical addresses.
+// Args with equal addresses (e.g. union options) are not ordered,
+// so sort.Stable must be used to get deterministic results.
 type ByPhysicalAddr struct {
 	Args
 	Context *execContext
 }
 
 func (s ByPhysicalAddr) Less(i, j int) bool {
-	return s.Context.args[s.Args[i]].Addr < s.Context.args[s.Args[j]].Addr
+	return s.Context.argAddr(s.Args[i]) < s.Context.argAddr(s.Args[j])
+}
+
+// ExecOpts contains optional parameters of exec serialization.
+// Zero value corresponds to the default serialization.
+type ExecOpts struct {
+	// DataOffset overrides Target.DataOffset as the base address of the data region,
+	// e.g. for sandbox configurations that map the data region at a different address.
+	DataOffset uint64
+	// ArgByteOrder makes big-endian const and result args carry ExecArgFlagBigEndian
+	// instead of being byte-swapped during serialization. This is required for
+	// big-endian result args, since their values are known only to executor.
+	ArgByteOrder bool
+	// RepeatCalls makes calls with Call.Repeat > 1 emit ExecInstrRepeat,
+	// so that executor repeats the call instead of executing it once.
+	RepeatCalls bool
+	// AsyncCalls makes calls with Call.Async emit ExecInstrAsync.
+	// Results of async calls can't be used by the following calls,
+	// since they are not known until the end of the program.
+	AsyncCalls bool
+	// EmitFailNth makes calls with non-zero Call.FailNth emit ExecInstrFailNth,
+	// so that fault injection is controlled per call by the program itself.
+	EmitFailNth bool
+	// EmitCallProps makes calls with non-zero Call.Props or with Call.Repeat > 1
+	// emit ExecInstrCallProps, the latter is passed as ExecCallPropRerun
+	// (regardless of ExecInstrRepeat emitted with RepeatCalls).
+	EmitCallProps bool
+	// CopyoutData makes calls followed by ExecInstrCopyoutData for each non-empty
+	// out (and inout) data arg, so that executor reports contents of output buffers,
+	// e.g. for comparison of outputs and hints. See Prog.CopyoutDataArgs.
+	CopyoutData bool
+	// CopyoutOnSuccess makes copyouts carry ExecCopyoutFlagOnSuccess, so that executor
+	// skips them if the call failed, and result args followed by their default value,
+	// which executor uses if the referenced result was not copied out.
+	// Since this changes layout of result args, it requires EmitHeader.
+	CopyoutOnSuccess bool
+	// OnInstr is called for every written instruction with the instruction
+	// (call ID for calls) and all words of the instruction including the first one.
+	// words must not be retained after the callback returns.
+	OnInstr func(kind uint64, words []uint64)
+	// StrictResults makes serialization fail if an input resource arg
+	// does not reference a result of a previous call and a special value is used instead.
+	// This is useful for checking correctness of program generation.
+	StrictResults bool
+	// EmitUnionOptions makes calls emit ExecInstrUnionOption for every union they use,
+	// so that executor knows the effective layout of the call arguments.
+	EmitUnionOptions bool
+	// DataAlign is the size data args are padded to (8 by default).
+	// Must be a power of 2. 1 means no padding, note that the following words
+	// are not aligned then.
+	DataAlign uint64
+	// EmitTypeIDs makes each arg start with Target.TypeID of its type,
+	// so that executor can check that the program matches its descriptions.
+	EmitTypeIDs bool
+	// EmitSyscallNR makes calls start with the kernel syscall number (Syscall.NR)
+	// instead of syzkaller call ID, for executors that don't have syzkaller call table.
+	// Pseudo-syscalls have no syscall number and fail serialization.
+	// Such programs can't be parsed with DeserializeExec.
+	EmitSyscallNR bool
+	// EnabledCalls, if set, contains syscalls available on the target.
+	// Other calls are skipped, and args that reference their results use default values.
+	EnabledCalls map[*Syscall]bool
+	// ExpectedReturns maps indices of calls in Prog.Calls to their expected return values.
+	// Such calls are followed by ExecInstrExpectReturn, so that executor can report
+	// divergences, e.g. for differential testing of kernels.
+	ExpectedReturns map[int]uint64
+	// CaptureAllReturns assigns copyout index to return values of all calls,
+	// rather than only to the ones used by other calls, so that executor reports all of them.
+	CaptureAllReturns bool
+	// AppendChecksum makes serialization append CRC32 of the program after ExecInstrEOF
+	// to detect corruption in transfer, see VerifyExecChecksum.
+	AppendChecksum bool
+	// Varint makes all words after the header encoded as signed varints
+	// (zigzag LEB128, see binary.PutVarint) instead of 8-byte values,
+	// and data args are not padded. This considerably reduces size of programs.
+	// Zigzag is used rather than plain LEB128 because instructions and ExecNoCopyout
+	// are small negative values, which take 1 byte rather than 10.
+	// Requires EmitHeader, decoders switch to varints after a header with ExecFlagVarint.
+	// Executor decodes varints, of the other header flags it accepts only ExecFlagBigEndian.
+	Varint bool
+	// Metrics, if set, accumulates time spent in different parts of serialization.
+	Metrics *ExecMetrics
+	// ProgID, if non-zero, is emitted with ExecInstrProgID at the beginning of the program,
+	// so that executor can mention it in logs. It does not affect execution.
+	ProgID uint64
+	// ReverseCalls makes calls emitted in the reverse order.
+	// Serialization fails if a call uses a result of a call that precedes it in the program.
+	ReverseCalls bool
+	// MaxInstrs overrides ExecMaxInstrs as the limit on the number of instructions
+	// in a program, serialization of programs exceeding it fails.
+	MaxInstrs int
+	// MaxBlobLen overrides ExecMaxBlobLen as the limit on the length of data args,
+	// serialization of programs exceeding it fails.
+	MaxBlobLen int
+	// RelativePointers makes all addresses in the data region (pointer args,
+	// copyin, copyout and checksum addresses) offsets from the data region base,
+	// so that executor can place the data region at any address.
+	// Pointer args carry ExecArgFlagPointer. DataOffset is ignored.
+	RelativePointers bool
+	// CsumCache, if set, makes SerializeForExecOpts skip checksum instructions
+	// (and initial zero copyins of checksum fields) whose inputs are the same
+	// as in the previous program serialized with the same cache.
+	// The executor then keeps the previously calculated values in memory.
+	// This is correct only if the previous program was executed in the same
+	// data region and nothing has overwritten the checksum fields since then.
+	CsumCache *ExecCsumCache
+	// SizeWidth is the width of size words in bytes (2, 4 or 8, 8 by default),
+	// for constrained executors that read sizes as narrower integers.
+	// Serialization fails if a size does not fit into the width.
+	// Note that the following words are not aligned then.
+	SizeWidth uint64
+	// ResetMemory makes the program start with ExecInstrReset, so that executor
+	// zeroes the data region and data left by previous programs executed
+	// in the same process does not leak into the program.
+	ResetMemory bool
+	// AlignCalls, if non-zero, makes each call (or its ExecInstrRepeat) start at an offset
+	// in the buffer that is a multiple of AlignCalls, padding with ExecInstrNop,
+	// e.g. for executors that transfer the program in fixed-size chunks.
+	// Must be a power of 2 and at least 8 without Varint, serialization fails if calls
+	// can't be aligned with 8-byte nops (e.g. because of narrow DataAlign).
+	AlignCalls uint64
+	// AssumeZeroedArena makes serialization skip copyins of all-zero const and data args
+	// to memory that was not used by previous calls of the program, since it is zero already.
+	// This must be used only if executor guarantees that the data region is zeroed
+	// at the beginning of the program (e.g. with ResetMemory or in a fresh process).
+	AssumeZeroedArena bool
+	// EmitCallHash makes each call preceded by ExecInstrCallHash with CallHash of the call,
+	// so that coverage reported by executor can be bucketed by shape of calls.
+	EmitCallHash bool
+	// EmitCallTimeout makes calls with a timeout in descriptions preceded by
+	// ExecInstrCallTimeout, so that executor can abort a hanging call alone.
+	EmitCallTimeout bool
+	// TruncateOnOverflow makes SerializeForExecOpts return a valid prefix of the program
+	// with the calls that fit into the buffer (and ErrExecTruncated) instead of
+	// ExecBufferTooSmallError. The partially written call is dropped. Note that OnInstr
+	// is still called for instructions of the dropped call.
+	TruncateOnOverflow bool
+	// PersistentPointers contains pointer args whose pointees are shared by several calls
+	// (e.g. to test TOCTOU races). Copyins of the pointee of such pointer are emitted
+	// only for the first call that uses the address, the following calls with persistent
+	// pointers to the same address see the memory as left by the previous calls.
+	PersistentPointers map[Arg]bool
+	// StrictArena makes serialization fail if a copyin does not fit into the data region.
+	// Generated programs point slightly outside of the data region on purpose
+	// (executor tolerates faults on copyins), but for some executors memory outside
+	// of the data region belongs to the executor itself. This also catches
+	// misconfiguration of Target.DataOffset or ExecOpts.DataOffset.
+	StrictArena bool
+	// EmitHeader makes the program start with ExecInstrHeader with the format version
+	// and flags, see NegotiateExecFormat.
+	EmitHeader bool
+	// CompressData makes large data args (e.g. filesystem images) emitted
+	// as ExecArgTypeDataCompressed if this makes them smaller.
+	CompressData bool
+	// Validate makes serialization check memory layout of the program:
+	// copyins of a call don't overlap each other with different data (except for
+	// bitfields sharing a storage unit), all copyins fit into the data region,
+	// and copyout indices of the program are dense. It also enables the checks
+	// of validateExec that are otherwise done only in debug mode. Problems are reported
+	// with *ExecValidationError. This is intended for testing of program generation
+	// and new targets, since the checks are not free.
+	Validate bool
+}
+
+// NegotiateExecFormat returns options for executor that supports exec format version
+// (0 for old executors that don't know about versions, which are sent programs without
+// ExecInstrHeader). Returns an error if programs for executor can't be produced.
+func NegotiateExecFormat(version uint64) (ExecOpts, error) {
+	switch version {
+	case 0:
+		return ExecOpts{}, nil
+	case ExecFormatVersion:
+		return ExecOpts{EmitHeader: true}, nil
+	default:
+		return ExecOpts{}, fmt.Errorf("executor exec format version %v is not supported, want 0 or %v",
+			version, ExecFormatVersion)
+	}
+}
+
+// execHeader returns value of ExecInstrHeader for opts.
+func execHeader(opts ExecOpts, bigEndian bool) uint64 {
+	var flags uint64
+	if bigEndian {
+		flags |= ExecFlagBigEndian
+	}
+	if opts.ArgByteOrder {
+		flags |= ExecFlagArgByteOrder
+	}
+	if opts.RelativePointers {
+		flags |= ExecFlagRelativePointers
+	}
+	if opts.EmitTypeIDs {
+		flags |= ExecFlagTypeIDs
+	}
+	if opts.EmitSyscallNR {
+		flags |= ExecFlagSyscallNR
+	}
+	if opts.CopyoutOnSuccess {
+		flags |= ExecFlagCopyoutOnSuccess
+	}
+	if opts.Varint {
+		flags |= ExecFlagVarint
+	}
+	return ExecFormatMagic<<32 | ExecFormatVersion<<16 | flags
+}
+
+// ErrExecTruncated is returned by SerializeForExecOpts with ExecOpts.TruncateOnOverflow
+// if not all calls of the program fit into the buffer.
+var ErrExecTruncated = errors.New("program is truncated to fit into the buffer")
+
+// ExecMetrics is time spent in different parts of serialization (see ExecOpts.Metrics).
+// Values are accumulated over all serialized programs.
+type ExecMetrics struct {
+	Programs  int
+	Calls     int
+	Checksums time.Duration // calculation of checksums
+	Copyins   time.Duration // copyin and checksum instructions
+	Args      time.Duration // calls and their args
+	Copyouts  time.Duration // copyout instructions
+}
+
+// since adds time elapsed since start to *d and returns the current time.
+func (m *ExecMetrics) since(d *time.Duration, start time.Time) time.Time {
+	now := time.Now()
+	*d += now.Sub(start)
+	return now
+}
+
+// ExecBufferTooSmallError is returned by SerializeForExec if the provided buffer
+// is too small for the program. Size is the required buffer size.
+type ExecBufferTooSmallError struct {
+	Size int
+}
+
+func (err *ExecBufferTooSmallError) Error() string {
+	return fmt.Sprintf("provided buffer is too small: need %v bytes", err.Size)
+}
+
+// ExecValidationError is returned by SerializeForExecOpts with ExecOpts.Validate
+// if the program fails validation.
+type ExecValidationError struct {
+	Call    int    // index of the offending call in Prog.Calls
+	Syscall string // name of the offending call
+	Arg     string // type name of the offending arg
+	Reason  string
+}
+
+func (err *ExecValidationError) Error() string {
+	return fmt.Sprintf("call #%v %v: arg %v: %v", err.Call, err.Syscall, err.Arg, err.Reason)
 }
 
 // SerializeForExec serializes program p for execution by process pid into the provided buffer.
 // Returns number of bytes written to the buffer.
-// If the provided buffer is too small for the program an error is returned.
+// If the provided buffer is too small for the program *ExecBufferTooSmallError is returned.
+// A program without calls (e.g. after minimization removed all calls) is serialized
+// as a single ExecInstrEOF word.
 func (p *Prog) SerializeForExec(buffer []byte, pid int) (int, error) {
-	if debug {
-		if err := p.validate(); err != nil {
-			panic(fmt.Errorf("serializing invalid program: %v", err))
-		}
+	return p.SerializeForExecOpts(buffer, pid, ExecOpts{})
+}
+
+// ExecutorOpts returns options for serialization of programs passed to executor of the target.
+// For targets with ExecVarint programs start with ExecInstrHeader and use varint encoding.
+func (target *Target) ExecutorOpts() ExecOpts {
+	return ExecOpts{
+		EmitHeader: target.ExecVarint,
+		Varint:     target.ExecVarint,
 	}
-	var copyoutSeq uint64
-	w := &execContext{
-		target: p.Target,
-		buf:    buffer,
-		eof:    false,
-		args:   make(map[Arg]argInfo),
+}
+
+// SerializeForExecOpts is SerializeForExec with non-default serialization options.
+func (p *Prog) SerializeForExecOpts(buffer []byte, pid int, opts ExecOpts) (int, error) {
+	w := getExecContext(p.Target, buffer, opts)
+	defer putExecContext(w)
+	if err := w.serializeProg(p, pid); err != nil {
+		return 0, err
 	}
-	for _, c := range p.Calls {
-		// Calculate checksums.
-		csumMap := calcChecksumsCall(c, pid)
-		var csumUses map[Arg]bool
-		if csumMap != nil {
-			csumUses = make(map[Arg]bool)
-			for arg, info := range csumMap {
-				csumUses[arg] = true
-				if info.Kind == CsumInet {
-					for _, chunk := range info.Chunks {
-						if chunk.Kind == CsumChunkArg {
-							csumUses[chunk.Arg] = true
-						}
-					}
-				}
+	w.writeEOF()
+	if opts.AppendChecksum && !w.eof {
+		w.write(uint64(crc32.ChecksumIEEE(buffer[:len(buffer)-len(w.buf)])))
+	}
+	if w.eof && opts.TruncateOnOverflow {
+		if n, ok := w.truncate(buffer); ok {
+			if opts.CsumCache != nil {
+				// Memory of cached checksums could be overwritten by the calls that fit.
+				opts.CsumCache.hashes = nil
 			}
+			return n, ErrExecTruncated
+		}
+	}
+	if w.eof {
+		size, err := p.execByteSize(pid, opts)
+		if err != nil {
+			return 0, err
+		}
+		return 0, &ExecBufferTooSmallError{size}
+	}
+	if opts.CsumCache != nil {
+		w.commitCsums()
+	}
+	return len(buffer) - len(w.buf), nil
+}
+
+// SerializeAndHashForExec is SerializeForExec that also returns FNV-1a hash
+// of the serialized program (the same as hash/fnv.New64a of the returned bytes).
+// The hash is calculated during serialization, which saves a second pass
+// over the program, e.g. for deduplication of programs.
+func (p *Prog) SerializeAndHashForExec(buffer []byte, pid int) (int, uint64, error) {
+	w := newExecContext(p.Target, buffer, ExecOpts{})
+	w.hashing = true
+	if err := w.serializeProg(p, pid); err != nil {
+		return 0, 0, err
+	}
+	w.writeEOF()
+	if w.eof {
+		size, err := p.execByteSize(pid, ExecOpts{})
+		if err != nil {
+			return 0, 0, err
+		}
+		return 0, 0, &ExecBufferTooSmallError{size}
+	}
+	return len(buffer) - len(w.buf), w.hash, nil
+}
+
+// SerializeForExecWithAddrs is SerializeForExec that also returns addresses
+// of all args located in the data region (pointees of pointer args and their inner args).
+func (p *Prog) SerializeForExecWithAddrs(buffer []byte, pid int) (int, map[Arg]uint64, error) {
+	w := newExecContext(p.Target, buffer, ExecOpts{})
+	w.addrs = make(map[Arg]uint64)
+	if err := w.serializeProg(p, pid); err != nil {
+		return 0, nil, err
+	}
+	w.writeEOF()
+	if w.eof {
+		size, err := p.ExecByteSize(pid)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, &ExecBufferTooSmallError{size}
+	}
+	return len(buffer) - len(w.buf), w.addrs, nil
+}
+
+// CopyoutSource returns index of the call in p.Calls and the arg that produce
+// the copyout index idx of program p serialized with SerializeForExec for process pid,
+// e.g. to interpret results reported by executor. ok is false if there is no such copyout.
+func (p *Prog) CopyoutSource(pid int, idx uint64) (callIndex int, arg Arg, ok bool) {
+	src, ok := p.copyoutSources(pid)[idx]
+	return src.call, src.arg, ok
+}
+
+// CopyoutNames returns names of producers of all copyout indices of program p
+// serialized with SerializeForExec for process pid, e.g. "openat.fd" for return
+// value of openat or "pipe.rfd" for rfd field of pipe out arg (see ExecProg.AnnotateResults).
+func (p *Prog) CopyoutNames(pid int) map[uint64]string {
+	names := make(map[uint64]string)
+	for idx, src := range p.copyoutSources(pid) {
+		name := src.arg.Type().FieldName()
+		if _, ok := src.arg.(*ReturnArg); ok {
+			name = src.arg.Type().Name()
+		}
+		names[idx] = p.Calls[src.call].Meta.Name + "." + name
+	}
+	return names
+}
+
+type copyoutSource struct {
+	call int
+	arg  Arg
+}
+
+// copyoutSources maps copyout indices of program p serialized with SerializeForExec
+// for process pid to their producers. Returns nil if p can't be serialized.
+func (p *Prog) copyoutSources(pid int) map[uint64]copyoutSource {
+	w := newExecContext(p.Target, nil, ExecOpts{})
+	w.out = ioutil.Discard
+	if err := w.serializeProg(p, pid); err != nil {
+		return nil
+	}
+	sources := make(map[uint64]copyoutSource)
+	for ci, c := range p.Calls {
+		// Return values get copyout indices before out args of the call (see writeCall).
+		if w.isUsed(c.Ret) {
+			sources[w.argInfo(c.Ret).Idx] = copyoutSource{ci, c.Ret}
 		}
-		// Calculate arg offsets within structs.
-		// Generate copyin instructions that fill in data into pointer arguments.
 		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
-			if a, ok := arg.(*PointerArg); ok && a.Res != nil {
-				foreachSubargOffset(a.Res, func(arg1 Arg, offset uint64) {
-					addr := p.Target.physicalAddr(arg) + offset
-					if isUsed(arg1) || csumUses[arg1] {
-						w.args[arg1] = argInfo{Addr: addr}
-					}
-					if _, ok := arg1.(*GroupArg); ok {
-						return
-					}
-					if _, ok := arg1.(*UnionArg); ok {
-						return
-					}
-					if a1, ok := arg1.(*DataArg); ok &&
-						(a1.Type().Dir() == DirOut || len(a1.Data()) == 0) {
-						return
-					}
-					if !IsPad(arg1.Type()) && arg1.Type().Dir() != DirOut {
-						w.write(execInstrCopyin)
-						w.write(addr)
-						w.writeArg(arg1, pid)
-					}
-				})
+			if w.isUsed(arg) {
+				sources[w.argInfo(arg).Idx] = copyoutSource{ci, arg}
 			}
 		})
-		// Generate checksum calculation instructions starting from the last one,
-		// since checksum values can depend on values of the latter ones
-		if csumMap != nil {
-			var csumArgs []Arg
-			for arg := range csumMap {
-				csumArgs = append(csumArgs, arg)
-			}
-			sort.Sort(ByPhysicalAddr{Args: csumArgs, Context: w})
-			for i := len(csumArgs) - 1; i >= 0; i-- {
-				arg := csumArgs[i]
-				if _, ok := arg.Type().(*CsumType); !ok {
-					panic("csum arg is not csum type")
-				}
-				w.write(execInstrCopyin)
-				w.write(w.args[arg].Addr)
-				w.write(execArgCsum)
-				w.write(arg.Size())
-				switch csumMap[arg].Kind {
-				case CsumInet:
-					w.write(ExecArgCsumInet)
-					w.write(uint64(len(csumMap[arg].Chunks)))
-					for _, chunk := range csumMap[arg].Chunks {
-						switch chunk.Kind {
-						case CsumChunkArg:
-							w.write(ExecArgCsumChunkData)
-							w.write(w.args[chunk.Arg].Addr)
-							w.write(chunk.Arg.Size())
-						case CsumChunkConst:
-							w.write(ExecArgCsumChunkConst)
-							w.write(chunk.Value)
-							w.write(chunk.Size)
-						default:
-							panic(fmt.Sprintf("csum chunk has unknown kind %v", chunk.Kind))
-						}
-					}
-				default:
-					panic(fmt.Sprintf("csum arg has unknown kind %v", csumMap[arg].Kind))
-				}
+	}
+	return sources
+}
+
+// SerializeForExecCanonical serializes program p with a fixed pid, so that the result
+// does not depend on the process that executes the program. It is intended for hashing
+// and deduplication of programs only, not for execution.
+func (p *Prog) SerializeForExecCanonical(buffer []byte) (int, error) {
+	return p.SerializeForExec(buffer, 0)
+}
+
+// SerializeForExecRedacted is SerializeForExec that replaces contents of all data args
+// with zeros of the same length. Sizes, padding and offsets are the same as in the normal
+// stream, so the result preserves program structure without revealing data.
+func (p *Prog) SerializeForExecRedacted(buffer []byte, pid int) (int, error) {
+	return p.serializeWith(buffer, pid, func(w *execContext) {
+		w.redact = true
+	})
+}
+
+// SerializeSetupForExec serializes only memory setup part of program p,
+// that is, copyin and checksum instructions without calls and copyouts.
+// The resulting program populates data region the same way p does.
+// Result args are replaced with their default values.
+func (p *Prog) SerializeSetupForExec(buffer []byte, pid int) (int, error) {
+	return p.serializeWith(buffer, pid, func(w *execContext) {
+		w.setupOnly = true
+		// Copyins of different calls are not separated by calls, so the order can't be checked.
+		w.checkOrder = false
+	})
+}
+
+// serializeWith is SerializeForExec with the context additionally configured by setup.
+func (p *Prog) serializeWith(buffer []byte, pid int, setup func(w *execContext)) (int, error) {
+	w := getExecContext(p.Target, buffer, ExecOpts{})
+	defer putExecContext(w)
+	setup(w)
+	if err := w.serializeProg(p, pid); err != nil {
+		return 0, err
+	}
+	w.writeEOF()
+	if w.eof {
+		size, err := p.execByteSizeWith(pid, ExecOpts{}, setup)
+		if err != nil {
+			return 0, err
+		}
+		return 0, &ExecBufferTooSmallError{size}
+	}
+	return len(buffer) - len(w.buf), nil
+}
+
+// ExecInstr is a single instruction of the exec stream.
+type ExecInstr struct {
+	Kind  uint64   // ExecInstr* constant or call ID
+	Words []uint64 // all words of the instruction in the wire format, starting with Kind
+	// Widths are encoded sizes of Words in bytes: 0 for regular words,
+	// or size of narrowed size words (ExecOpts.SizeWidth) and data chunks
+	// (Words in byte order of the target with data in the first bytes).
+	// Nil Widths means that all words are regular.
+	Widths []int
+	// Varint is set if regular words are varints (ExecOpts.Varint), otherwise they take 8 bytes.
+	Varint bool
+}
+
+// SerializeForExecInstrs serializes program p for execution by process pid
+// into a list of instructions ending with ExecInstrEOF. The instructions can be
+// changed (reordered, instrumented, etc) and then encoded with EncodeInstrs.
+// Without changes EncodeInstrs produces the same bytes as SerializeForExec.
+func (p *Prog) SerializeForExecInstrs(pid int) ([]ExecInstr, error) {
+	return p.SerializeForExecInstrsOpts(pid, ExecOpts{})
+}
+
+// SerializeForExecInstrsOpts is SerializeForExecInstrs with the given options.
+// Without changes EncodeInstrs produces the same bytes as SerializeForExecOpts with opts.
+func (p *Prog) SerializeForExecInstrsOpts(pid int, opts ExecOpts) ([]ExecInstr, error) {
+	if opts.AppendChecksum {
+		return nil, fmt.Errorf("AppendChecksum can't be used with instructions")
+	}
+	var instrs []ExecInstr
+	var w *execContext
+	onInstr := opts.OnInstr
+	opts.OnInstr = func(kind uint64, words []uint64) {
+		instr := ExecInstr{
+			Kind:   kind,
+			Words:  append([]uint64{}, words...),
+			Varint: w.instrVarint,
+		}
+		for _, width := range w.instrWidths {
+			if width != 0 {
+				instr.Widths = append([]int{}, w.instrWidths...)
+				break
 			}
 		}
-		// Generate the call itself.
-		w.write(uint64(c.Meta.ID))
-		if isUsed(c.Ret) {
-			w.args[c.Ret] = argInfo{Idx: copyoutSeq}
-			w.write(copyoutSeq)
-			copyoutSeq++
-		} else {
-			w.write(ExecNoCopyout)
+		instrs = append(instrs, instr)
+		if onInstr != nil {
+			onInstr(kind, words)
 		}
-		w.write(uint64(len(c.Args)))
-		for _, arg := range c.Args {
-			w.writeArg(arg, pid)
+	}
+	w = newExecContext(p.Target, nil, opts)
+	w.out = ioutil.Discard
+	if err := w.serializeProg(p, pid); err != nil {
+		return nil, err
+	}
+	w.writeEOF()
+	return instrs, nil
+}
+
+// execByteOrder returns byte order of words of the exec format for the target.
+// Programs without target (e.g. empty ones) are little-endian.
+func (target *Target) execByteOrder() binary.ByteOrder {
+	if target != nil && target.BigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// EncodeInstrs writes instrs into buffer in the wire format
+// and returns number of bytes written.
+func (target *Target) EncodeInstrs(instrs []ExecInstr, buffer []byte) (int, error) {
+	w := newExecContext(target, buffer, ExecOpts{})
+	w.countOverflow = true
+	order := target.execByteOrder()
+	var word [8]byte
+	for _, instr := range instrs {
+		if instr.Widths != nil && len(instr.Widths) != len(instr.Words) {
+			return 0, fmt.Errorf("instruction 0x%x has %v words and %v widths",
+				instr.Kind, len(instr.Words), len(instr.Widths))
 		}
-		// Generate copyout instructions that persist interesting return values.
-		foreachArg(c, func(arg, base Arg, _ *[]Arg) {
-			if !isUsed(arg) {
-				return
+		w.opts.Varint = instr.Varint
+		for i, v := range instr.Words {
+			if instr.Widths == nil || instr.Widths[i] == 0 {
+				w.write(v)
+				continue
 			}
-			switch arg.(type) {
-			case *ReturnArg:
-				// Idx is already assigned above.
-			case *ConstArg, *ResultArg:
-				// Create a separate copyout instruction that has own Idx.
-				if _, ok := base.(*PointerArg); !ok {
-					panic("arg base is not a pointer")
-				}
-				info := w.args[arg]
-				info.Idx = copyoutSeq
-				copyoutSeq++
-				w.args[arg] = info
-				w.write(execInstrCopyout)
-				w.write(info.Idx)
-				w.write(info.Addr)
-				w.write(arg.Size())
-			default:
-				panic("bad arg kind in copyout")
+			width := instr.Widths[i]
+			if width < 0 || width > 8 {
+				return 0, fmt.Errorf("instruction 0x%x has bad word width %v", instr.Kind, width)
 			}
-		})
+			order.PutUint64(word[:], v)
+			w.writeData(word[:width], width)
+		}
+	}
+	if w.overflow {
+		return 0, &ExecBufferTooSmallError{int(w.pos)}
+	}
+	return len(buffer) - len(w.buf), nil
+}
+
+// ExecByteSize returns size of program p serialized with SerializeForExec.
+func (p *Prog) ExecByteSize(pid int) (int, error) {
+	return p.execByteSize(pid, ExecOpts{})
+}
+
+func (p *Prog) execByteSize(pid int, opts ExecOpts) (int, error) {
+	return p.execByteSizeWith(pid, opts, nil)
+}
+
+// execByteSizeWith is execByteSize with the context additionally configured by setup (if not nil).
+func (p *Prog) execByteSizeWith(pid int, opts ExecOpts, setup func(w *execContext)) (int, error) {
+	// Don't account the size calculation in metrics of the actual serialization.
+	opts.Metrics = nil
+	cw := &countingWriter{w: ioutil.Discard}
+	w := getExecContext(p.Target, nil, opts)
+	defer putExecContext(w)
+	if setup != nil {
+		setup(w)
+	}
+	w.out = cw
+	if err := w.serializeProg(p, pid); err != nil {
+		return 0, err
+	}
+	w.writeEOF()
+	if opts.AppendChecksum {
+		w.write(0) // only size matters here
+	}
+	return int(cw.n), nil
+}
+
+// VerifyExecChecksum checks the checksum appended to program exec
+// with ExecOpts.AppendChecksum and returns the program without the checksum.
+func (target *Target) VerifyExecChecksum(exec []byte) ([]byte, error) {
+	if len(exec) < 16 || len(exec)%8 != 0 {
+		return nil, fmt.Errorf("bad exec program size %v", len(exec))
+	}
+	order := target.execByteOrder()
+	n := len(exec) - 8
+	if order.Uint64(exec[n-8:]) != ExecInstrEOF {
+		return nil, fmt.Errorf("no EOF before checksum")
+	}
+	sum := order.Uint64(exec[n:])
+	if want := uint64(crc32.ChecksumIEEE(exec[:n])); sum != want {
+		return nil, fmt.Errorf("bad exec program checksum 0x%x, want 0x%x", sum, want)
+	}
+	return exec[:n], nil
+}
+
+// SerializeBatchForExec serializes several programs for sequential execution
+// by process pid into the provided buffer. Programs are separated with
+// ExecInstrBatchSep, copyout indices of each program start from 0.
+// Returns number of bytes written to the buffer.
+func SerializeBatchForExec(buffer []byte, progs []*Prog, pid int) (int, error) {
+	if len(progs) == 0 {
+		return 0, fmt.Errorf("no programs to serialize")
+	}
+	w := newExecContext(progs[0].Target, buffer, ExecOpts{})
+	if err := w.serializeBatch(progs, pid); err != nil {
+		return 0, err
 	}
-	w.write(execInstrEOF)
 	if w.eof {
-		return 0, fmt.Errorf("provided buffer is too small")
+		cw := &countingWriter{w: ioutil.Discard}
+		w = newExecContext(progs[0].Target, nil, ExecOpts{})
+		w.out = cw
+		if err := w.serializeBatch(progs, pid); err != nil {
+			return 0, err
+		}
+		return 0, &ExecBufferTooSmallError{int(cw.n)}
 	}
 	return len(buffer) - len(w.buf), nil
 }
 
-func (target *Target) physicalAddr(arg Arg) uint64 {
-	a, ok := arg.(*PointerArg)
-	if !ok {
-		panic("physicalAddr: bad arg kind")
+// MergeForExec serializes programs a and b for sequential execution by process pid
+// as a single program. Data of b is relocated to the pages following the last page
+// used by a, and copyout indices of b follow the ones of a, so that the programs
+// don't interfere. Result args reference only results of the same program.
+// Returns number of bytes written to the buffer.
+func MergeForExec(buffer []byte, a, b *Prog, pid int) (int, error) {
+	if a.Target != b.Target {
+		return 0, fmt.Errorf("programs have different targets %v/%v and %v/%v",
+			a.Target.OS, a.Target.Arch, b.Target.OS, b.Target.Arch)
 	}
-	addr := a.PageIndex*target.PageSize + target.DataOffset
-	if a.PageOffset >= 0 {
-		addr += uint64(a.PageOffset)
-	} else {
-		addr += target.PageSize - uint64(-a.PageOffset)
+	w := newExecContext(a.Target, buffer, ExecOpts{})
+	if err := w.serializeMerged(a, b, pid); err != nil {
+		return 0, err
 	}
-	return addr
+	if w.eof {
+		cw := &countingWriter{w: ioutil.Discard}
+		w = newExecContext(a.Target, nil, ExecOpts{})
+		w.out = cw
+		if err := w.serializeMerged(a, b, pid); err != nil {
+			return 0, err
+		}
+		return 0, &ExecBufferTooSmallError{int(cw.n)}
+	}
+	return len(buffer) - len(w.buf), nil
 }
 
-type execContext struct {
-	target *Target
-	buf    []byte
-	eof    bool
-	args   map[Arg]argInfo
+func (w *execContext) serializeMerged(a, b *Prog, pid int) error {
+	aPages, err := a.dataPages()
+	if err != nil {
+		return err
+	}
+	bPages, err := b.dataPages()
+	if err != nil {
+		return err
+	}
+	if aPages+bPages > w.target.NumPages {
+		return fmt.Errorf("merged programs need %v+%v pages, data region has %v pages",
+			aPages, bPages, w.target.NumPages)
+	}
+	if err := w.serializeProg(a, pid); err != nil {
+		return fmt.Errorf("program 0: %v", err)
+	}
+	w.dataOffset += aPages * w.target.PageSize
+	w.copyoutBase = w.copyoutSeq
+	if err := w.serializeProg(b, pid); err != nil {
+		return fmt.Errorf("program 1: %v", err)
+	}
+	w.writeEOF()
+	return nil
 }
 
-type argInfo struct {
-	Addr uint64 // physical addr
-	Idx  uint64 // copyout instruction index
+// dataPages returns number of pages at the beginning of the data region
+// that cover all memory referenced by pointer args of p.
+func (p *Prog) dataPages() (uint64, error) {
+	target := p.Target
+	var pages uint64
+	var err error
+	for _, c := range p.Calls {
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			a, ok := arg.(*PointerArg)
+			if !ok || a.IsNull || err != nil {
+				return
+			}
+			var off uint64
+			if off, err = target.physicalAddr(arg, 0); err != nil {
+				return
+			}
+			size := a.PagesNum * target.PageSize
+			if a.Res != nil {
+				size = a.Res.Size()
+			}
+			if end := (off + size + target.PageSize - 1) / target.PageSize; end > pages {
+				pages = end
+			}
+		})
+	}
+	return pages, err
 }
 
-func (w *execContext) write(v uint64) {
-	if len(w.buf) < 8 {
-		w.eof = true
-		return
+func (w *execContext) serializeBatch(progs []*Prog, pid int) error {
+	for i, p := range progs {
+		if p.Target != w.target {
+			return fmt.Errorf("program %v has target %v/%v, want %v/%v",
+				i, p.Target.OS, p.Target.Arch, w.target.OS, w.target.Arch)
+		}
+		if err := w.serializeProg(p, pid); err != nil {
+			return fmt.Errorf("program %v: %v", i, err)
+		}
+		w.writeInstr(ExecInstrBatchSep)
 	}
-	w.buf[0] = byte(v >> 0)
-	w.buf[1] = byte(v >> 8)
-	w.buf[2] = byte(v >> 16)
-	w.buf[3] = byte(v >> 24)
-	w.buf[4] = byte(v >> 32)
-	w.buf[5] = byte(v >> 40)
-	w.buf[6] = byte(v >> 48)
-	w.buf[7] = byte(v >> 56)
-	w.buf = w.buf[8:]
+	w.writeEOF()
+	return nil
 }
 
-func (w *execContext) writeArg(arg Arg, pid int) {
-	switch a := arg.(type) {
-	case *ConstArg:
-		w.write(execArgConst)
-		w.write(a.Size())
-		w.write(a.Value(pid))
-		w.write(a.Type().BitfieldOffset())
-		w.write(a.Type().BitfieldLength())
-	case *ResultArg:
-		if a.Res == nil {
-			w.write(execArgConst)
-			w.write(a.Size())
-			w.write(a.Val)
-			w.write(0) // bit field offset
-			w.write(0) // bit field length
-		} else {
-			info, ok := w.args[a.Res]
-			if !ok {
-				panic("no copyout index")
+// ExecProgram is a program prepared for execution by process Pid.
+// It implements io.WriterTo that produces the same bytes as SerializeForExec.
+type ExecProgram struct {
+	*Prog
+	Pid int
+}
+
+// WriteTo streams the serialized program into out
+// without materializing it in an intermediate buffer.
+func (ep *ExecProgram) WriteTo(out io.Writer) (int64, error) {
+	cw := &countingWriter{w: out}
+	bw := bufio.NewWriter(cw)
+	w := newExecContext(ep.Target, nil, ExecOpts{})
+	w.out = bw
+	if err := w.serializeProg(ep.Prog, ep.Pid); err != nil {
+		return 0, err
+	}
+	w.writeEOF()
+	if w.outErr != nil {
+		return cw.n, w.outErr
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// WriteExec streams program p serialized for execution by process pid into out.
+// Unlike SerializeForExec, it does not need a buffer large enough for the whole program.
+func (p *Prog) WriteExec(out io.Writer, pid int) error {
+	_, err := (&ExecProgram{Prog: p, Pid: pid}).WriteTo(out)
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(data []byte) (int, error) {
+	n, err := cw.w.Write(data)
+	cw.n += int64(n)
+	return n, err
+}
+
+// serializeProg writes instructions of program p without the terminating ExecInstrEOF.
+// Serialization stops as soon as the buffer overflows.
+func (w *execContext) serializeProg(p *Prog, pid int) error {
+	if debug || w.opts.Validate {
+		if err := p.validateExec(w.dataOffset); err != nil {
+			return err
+		}
+	}
+	if debug {
+		if err := p.validate(); err != nil {
+			panic(fmt.Errorf("serializing invalid program: %v", err))
+		}
+	}
+	if w.opts.StrictResults {
+		if err := checkStrictResults(p); err != nil {
+			return err
+		}
+	}
+	if w.opts.Validate {
+		if err := w.validateCopyins(p, pid); err != nil {
+			return err
+		}
+	}
+	if w.opts.EmitSyscallNR {
+		for _, c := range p.Calls {
+			if strings.HasPrefix(c.Meta.CallName, "syz_") {
+				return fmt.Errorf("pseudo-syscall %v has no syscall number", c.Meta.Name)
 			}
-			w.write(execArgResult)
-			w.write(a.Size())
-			w.write(info.Idx)
-			w.write(a.OpDiv)
-			w.write(a.OpAdd)
 		}
-	case *PointerArg:
-		w.write(execArgConst)
-		w.write(a.Size())
-		w.write(w.target.physicalAddr(arg))
-		w.write(0) // bit field offset
-		w.write(0) // bit field length
-	case *DataArg:
-		data := a.Data()
-		w.write(execArgData)
-		w.write(uint64(len(data)))
-		padded := len(data)
-		if pad := 8 - len(data)%8; pad != 8 {
-			padded += pad
+	}
+	if w.opts.Varint && (w.opts.DataAlign != 0 || w.opts.AppendChecksum || w.opts.SizeWidth != 0) {
+		return fmt.Errorf("varint encoding can't be used with DataAlign, AppendChecksum or SizeWidth")
+	}
+	if w.opts.CopyoutOnSuccess && !w.opts.EmitHeader {
+		return fmt.Errorf("CopyoutOnSuccess requires EmitHeader")
+	}
+	if w.opts.Varint && !w.opts.EmitHeader {
+		return fmt.Errorf("varint encoding requires EmitHeader")
+	}
+	if w.opts.EmitHeader {
+		// The header is always written with fixed-size words,
+		// the rest of the program is parsed according to its flags.
+		header := execHeader(w.opts, w.bigEndian)
+		w.opts.Varint = false
+		w.writeInstr(ExecInstrHeader)
+		w.write(header)
+		w.opts.Varint = header&ExecFlagVarint != 0
+	}
+	if w.opts.ProgID != 0 {
+		w.writeInstr(ExecInstrProgID)
+		w.write(w.opts.ProgID)
+	}
+	if w.opts.ResetMemory {
+		w.writeInstr(ExecInstrReset)
+		w.dirty = w.dirty[:0]
+	}
+	if align := w.opts.AlignCalls; align != 0 {
+		if align&(align-1) != 0 || align > execMaxDataAlign || align < 8 && !w.opts.Varint {
+			return fmt.Errorf("bad call alignment %v", align)
 		}
-		if len(w.buf) < padded {
-			w.eof = true
-		} else {
-			copy(w.buf, data)
-			w.buf = w.buf[padded:]
+	}
+	if align := w.opts.DataAlign; align != 0 && align != execDefaultDataAlign {
+		if align&(align-1) != 0 || align > execMaxDataAlign {
+			return fmt.Errorf("bad data alignment %v", align)
+		}
+		w.writeInstr(ExecInstrDataAlign)
+		w.write(align)
+	}
+	if width := w.opts.SizeWidth; width != 0 && width != execDefaultSizeWidth {
+		if width != 2 && width != 4 {
+			return fmt.Errorf("bad size width %v", width)
+		}
+		w.writeInstr(ExecInstrSizeWidth)
+		w.write(width)
+	}
+	w.copyoutSeq = w.copyoutBase
+	w.ninstrs = 0
+	w.limitErr = nil
+	w.resetArgs()
+	for addr := range w.persisted {
+		delete(w.persisted, addr)
+	}
+	w.markUsed(p)
+	if w.opts.ReverseCalls {
+		if err := w.checkReversedResults(p); err != nil {
+			return err
+		}
+	}
+	w.markCallEnd()
+	if w.opts.Metrics != nil {
+		w.opts.Metrics.Programs++
+	}
+	err := w.serializeCalls(p, pid)
+	if err == nil && w.opts.Validate && !w.eof {
+		err = w.validateCopyouts(p)
+	}
+	return err
+}
+
+// serializeCalls writes calls of program p.
+// Time is measured only if ExecOpts.Metrics is set, so that the default path does not read the clock.
+func (w *execContext) serializeCalls(p *Prog, pid int) error {
+	m := w.opts.Metrics
+	var start time.Time
+	for i := range p.Calls {
+		ci := w.callIndex(p, i)
+		c := p.Calls[ci]
+		if w.eof {
+			return nil
+		}
+		if !w.callEnabled(c) {
+			continue
+		}
+		if err := w.checkLimits(); err != nil {
+			return err
+		}
+		if m != nil {
+			m.Calls++
+			start = time.Now()
+		}
+		csumMap := w.calcChecksums(c, pid)
+		if m != nil {
+			start = m.since(&m.Checksums, start)
+		}
+		w.writeCopyins(c, pid, csumMap)
+		w.writeChecksums(c, csumMap)
+		if m != nil {
+			start = m.since(&m.Copyins, start)
+		}
+		if w.setupOnly {
+			continue
+		}
+		w.writeCall(c, pid)
+		w.writeExpectedReturn(ci)
+		if m != nil {
+			start = m.since(&m.Args, start)
+		}
+		w.writeCopyouts(c)
+		if m != nil {
+			m.since(&m.Copyouts, start)
+		}
+		w.markCallEnd()
+	}
+	return w.checkLimits()
+}
+
+// markCallEnd remembers the current position as the end of the last complete call
+// (or of the program header), see ExecOpts.TruncateOnOverflow.
+func (w *execContext) markCallEnd() {
+	if w.opts.TruncateOnOverflow && !w.eof {
+		w.callEnds = append(w.callEnds, len(w.buf))
+	}
+}
+
+// truncate finishes the program at the end of the last complete call after which
+// ExecInstrEOF (and the checksum) still fit into buffer. Returns the size of the program
+// or false if even the program header does not fit.
+func (w *execContext) truncate(buffer []byte) (int, bool) {
+	for i := len(w.callEnds) - 1; i >= 0; i-- {
+		w.buf = buffer[len(buffer)-w.callEnds[i]:]
+		w.eof = false
+		w.writeEOF()
+		if w.opts.AppendChecksum && !w.eof {
+			w.write(uint64(crc32.ChecksumIEEE(buffer[:len(buffer)-len(w.buf)])))
+		}
+		if !w.eof {
+			return len(buffer) - len(w.buf), true
+		}
+	}
+	return 0, false
+}
+
+// checkLimits checks that the number of written instructions
+// and lengths of data args don't exceed the limits.
+func (w *execContext) checkLimits() error {
+	if w.limitErr != nil {
+		return w.limitErr
+	}
+	max := w.opts.MaxInstrs
+	if max == 0 {
+		max = ExecMaxInstrs
+	}
+	if w.ninstrs > max {
+		return fmt.Errorf("program has more than %v instructions", max)
+	}
+	return nil
+}
+
+// checkBlobLen checks that length of data arg a does not exceed the limit.
+func (w *execContext) checkBlobLen(a *DataArg) {
+	max := w.opts.MaxBlobLen
+	if max == 0 {
+		max = ExecMaxBlobLen
+	}
+	if n := len(a.Data()); n > max && w.limitErr == nil {
+		w.limitErr = fmt.Errorf("data arg %v has %v bytes, max %v", a.Type().Name(), n, max)
+	}
+}
+
+// checkStrictResults checks that all input resource args reference results.
+func checkStrictResults(p *Prog) error {
+	for _, c := range p.Calls {
+		var err error
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			a, ok := arg.(*ResultArg)
+			if !ok || a.Res != nil || a.Type().Dir() == DirOut || err != nil {
+				return
+			}
+			err = fmt.Errorf("syscall %v: resource arg %v does not reference a result, uses value 0x%x",
+				c.Meta.Name, a.Type().Name(), a.Val)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callIndex returns index of the i-th call to be written according to ExecOpts.ReverseCalls.
+func (w *execContext) callIndex(p *Prog, i int) int {
+	if w.opts.ReverseCalls {
+		return len(p.Calls) - 1 - i
+	}
+	return i
+}
+
+// checkReversedResults checks that all results used by p are produced
+// by calls executed before the consumers with ExecOpts.ReverseCalls.
+func (w *execContext) checkReversedResults(p *Prog) error {
+	producers := make(map[Arg]int)
+	for ci, c := range p.Calls {
+		producers[c.Ret] = ci
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			if w.isUsed(arg) {
+				producers[arg] = ci
+			}
+		})
+	}
+	for ci, c := range p.Calls {
+		if !w.callEnabled(c) {
+			continue
+		}
+		var err error
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			a, ok := arg.(*ResultArg)
+			if !ok || a.Res == nil || !w.isUsed(a.Res) || err != nil {
+				return
+			}
+			if producer := producers[a.Res]; producer <= ci {
+				err = fmt.Errorf("syscall %v: result arg %v references result of call %v"+
+					" that is executed later in reverse order", c.Meta.Name, a.Type().Name(), producer)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markUsed marks args that are referenced by result args of p.
+// Uses of args can be stale (e.g. after the consumer was removed during minimization),
+// copyouts are emitted only for args that are actually referenced.
+// Arg infos must be reset with resetArgs before.
+func (w *execContext) markUsed(p *Prog) {
+	for _, c := range p.Calls {
+		if !w.callEnabled(c) {
+			continue
+		}
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			if a, ok := arg.(*ResultArg); ok && a.Res != nil {
+				w.addArgInfo(a.Res).used = true
+			}
+		})
+	}
+	// Results can be read only from resource return values and out args of enabled calls
+	// that are present in the program (e.g. not from inactive options of unions).
+	// References to other args use the default value.
+	for _, c := range p.Calls {
+		if !w.callEnabled(c) {
+			continue
+		}
+		// Only resources are copied out of return values, references to returns
+		// of other calls (e.g. left by mutations) would waste copyout indices.
+		if _, ok := c.Meta.Ret.(*ResourceType); ok {
+			w.addArgInfo(c.Ret).readable = true
+		}
+		foreachArg(c, func(arg, base Arg, _ *[]Arg) {
+			if w.isUsed(arg) && arg.Type().Dir() != DirIn {
+				if _, ok := base.(*PointerArg); ok {
+					w.argInfo(arg).readable = true
+				}
+			}
+		})
+	}
+	for i := range w.infos {
+		if !w.infos[i].readable {
+			w.infos[i].used = false
+		}
+	}
+}
+
+// calcChecksums is calcChecksumsCall that avoids walking args of calls without checksums.
+func (w *execContext) calcChecksums(c *Call, pid int) map[Arg]CsumInfo {
+	if !w.target.hasCsums(c.Meta) {
+		return nil
+	}
+	return calcChecksumsCall(c, pid)
+}
+
+// callEnabled returns whether the call is available according to ExecOpts.EnabledCalls.
+func (w *execContext) callEnabled(c *Call) bool {
+	return w.opts.EnabledCalls == nil || w.opts.EnabledCalls[c.Meta]
+}
+
+// writeCopyins generates copyin instructions that fill in data into pointer arguments.
+func (w *execContext) writeCopyins(c *Call, pid int, csumMap map[Arg]CsumInfo) {
+	// Addresses are recorded for all args with infos, so add infos for checksum args
+	// and args they cover.
+	for arg, info := range csumMap {
+		w.addArgInfo(arg)
+		for _, chunk := range info.Chunks {
+			if chunk.Kind == CsumChunkArg {
+				w.addArgInfo(chunk.Arg)
+			}
+		}
+	}
+	w.copyins.reset()
+	w.skipCsums = nil
+	if w.opts.CsumCache != nil && len(csumMap) != 0 {
+		w.skipCsums = w.cachedCsums(c, pid, csumMap)
+	}
+	// Calculate arg offsets within structs.
+	foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+		if w.eof {
+			return
+		}
+		if a, ok := arg.(*PointerArg); ok && a.Res != nil {
+			var bitfields []*ConstArg
+			persisted := w.opts.PersistentPointers[arg] && w.persist(a)
+			foreachSubargOffset(a.Res, func(arg1 Arg, offset uint64) {
+				addr := w.physicalAddr(arg) + offset
+				if w.addrs != nil {
+					w.addrs[arg1] = addr
+				}
+				info := w.argInfo(arg1)
+				if info == nil && w.opts.CopyoutData && isCopyoutData(arg1) {
+					info = w.addArgInfo(arg1)
+				}
+				if info != nil {
+					info.Addr = addr
+				}
+				if _, ok := arg1.(*GroupArg); ok {
+					return
+				}
+				if a1, ok := arg1.(*UnionArg); ok {
+					if w.opts.EmitUnionOptions {
+						w.writeInstr(ExecInstrUnionOption)
+						w.write(addr)
+						w.write(unionOptionIndex(a1))
+					}
+					return
+				}
+				if persisted {
+					return
+				}
+				if w.opts.StrictArena && !IsPad(arg1.Type()) && arg1.Type().Dir() != DirOut {
+					w.checkArena(c, addr, arg1)
+				}
+				if a1, ok := arg1.(*DataArg); ok {
+					if a1.Type().Dir() == DirOut || len(a1.Data()) == 0 {
+						return
+					}
+					w.checkBlobLen(a1)
+				}
+				if !IsPad(arg1.Type()) && arg1.Type().Dir() != DirOut {
+					if w.opts.AssumeZeroedArena && w.zeroCopyin(addr, arg1, pid) {
+						return
+					}
+					if w.skipCsums[arg1] || !w.copyins.add(addr, arg1, pid) {
+						return
+					}
+					if a1, ok := arg1.(*DataArg); ok {
+						if v, ok := uniformData(a1.Data()); ok {
+							w.writeInstr(ExecInstrCopyinFill)
+							w.write(addr)
+							w.writeSize(uint64(len(a1.Data())))
+							if w.redact {
+								v = 0
+							}
+							w.write(uint64(v))
+							return
+						}
+					}
+					if a1, ok := arg1.(*ConstArg); ok && a1.Type().BitfieldLength() != 0 {
+						bitfields = append(bitfields, a1)
+						if !a1.Type().BitfieldMiddle() {
+							w.writeBitfields(addr, bitfields, pid)
+							bitfields = bitfields[:0]
+						}
+						return
+					}
+					w.writeInstr(ExecInstrCopyin)
+					w.write(addr)
+					w.writeArg(arg1, pid)
+				}
+			})
+		}
+	})
+	if w.opts.AssumeZeroedArena {
+		w.addDirty(c)
+	}
+}
+
+// checkArena checks that copyin of arg to addr fits into the data region, see ExecOpts.StrictArena.
+func (w *execContext) checkArena(c *Call, addr uint64, arg Arg) {
+	if w.inArena(addr, arg.Size()) {
+		return
+	}
+	if w.limitErr == nil {
+		w.limitErr = fmt.Errorf("syscall %v: copyin of %v to [0x%x, +%v) is outside of data region [0x%x, +0x%x)",
+			c.Meta.Name, arg.Type().Name(), addr, arg.Size(), w.dataOffset, w.target.NumPages*w.target.PageSize)
+	}
+}
+
+// inArena returns whether [addr, addr+size) is within the data region.
+func (w *execContext) inArena(addr, size uint64) bool {
+	region := w.target.NumPages * w.target.PageSize
+	return addr >= w.dataOffset && addr-w.dataOffset <= region && size <= region-(addr-w.dataOffset)
+}
+
+// validatedCopyin is a copyin of arg to [addr, addr+size) checked by validateCopyins.
+type validatedCopyin struct {
+	addr uint64
+	size uint64
+	arg  Arg
+}
+
+// validateCopyins checks that copyins of each call of p fit into the data region
+// and don't overlap each other with different data, see ExecOpts.Validate.
+func (w *execContext) validateCopyins(p *Prog, pid int) error {
+	var copyins []validatedCopyin
+	for ci, c := range p.Calls {
+		if !w.callEnabled(c) {
+			continue
+		}
+		copyins = copyins[:0]
+		var err error
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			a, ok := arg.(*PointerArg)
+			if !ok || a.Res == nil || err != nil {
+				return
+			}
+			foreachSubargOffset(a.Res, func(arg1 Arg, offset uint64) {
+				switch arg1.(type) {
+				case *GroupArg, *UnionArg:
+					return
+				}
+				size := arg1.Size()
+				if IsPad(arg1.Type()) || arg1.Type().Dir() == DirOut || size == 0 || err != nil {
+					return
+				}
+				addr := w.physicalAddr(arg) + offset
+				if !w.inArena(addr, size) {
+					err = &ExecValidationError{ci, c.Meta.Name, arg1.Type().Name(),
+						fmt.Sprintf("copyin to [0x%x, +%v) is outside of data region [0x%x, +0x%x)",
+							addr, size, w.dataOffset, w.target.NumPages*w.target.PageSize)}
+					return
+				}
+				copyins = append(copyins, validatedCopyin{addr, size, arg1})
+			})
+		})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(copyins, func(i, j int) bool {
+			return copyins[i].addr < copyins[j].addr
+		})
+		// last is the copyin that ends last among the already checked ones,
+		// so every copyin that overlaps any of them overlaps it.
+		for i, last := 1, 0; i < len(copyins); i++ {
+			prev, cur := copyins[last], copyins[i]
+			if cur.addr < prev.addr+prev.size && !sameCopyin(prev, cur, pid) {
+				return &ExecValidationError{ci, c.Meta.Name, cur.arg.Type().Name(),
+					fmt.Sprintf("copyin to [0x%x, +%v) overlaps copyin of %v to [0x%x, +%v)",
+						cur.addr, cur.size, prev.arg.Type().Name(), prev.addr, prev.size)}
+			}
+			if cur.addr+cur.size > prev.addr+prev.size {
+				last = i
+			}
+		}
+	}
+	return nil
+}
+
+// sameCopyin returns whether overlapping copyins a and b don't conflict:
+// they are bitfields sharing a storage unit or write the same data.
+func sameCopyin(a, b validatedCopyin, pid int) bool {
+	if a.addr != b.addr || a.size != b.size {
+		return false
+	}
+	a1, ok1 := a.arg.(*ConstArg)
+	b1, ok2 := b.arg.(*ConstArg)
+	if ok1 && ok2 && a1.Type().BitfieldLength() != 0 && b1.Type().BitfieldLength() != 0 {
+		return true
+	}
+	keyA, refA, ok1 := makeCopyinKey(a.addr, a.arg, pid)
+	keyB, refB, ok2 := makeCopyinKey(b.addr, b.arg, pid)
+	return ok1 && ok2 && keyA == keyB && refA.sameValue(refB)
+}
+
+// validateCopyouts checks that copyout indices assigned to the program are dense,
+// i.e. every index from the first copyout index of the program was assigned
+// to exactly one result, see ExecOpts.Validate.
+func (w *execContext) validateCopyouts(p *Prog) error {
+	assigned := make([]bool, w.copyoutSeq-w.copyoutBase)
+	check := func(ci int, c *Call, arg Arg) error {
+		info := w.argInfo(arg)
+		if info == nil || !info.copiedOut {
+			return nil
+		}
+		reason := ""
+		switch {
+		case info.Idx < w.copyoutBase || info.Idx >= w.copyoutSeq:
+			reason = fmt.Sprintf("copyout index %v is outside of [%v, %v)", info.Idx, w.copyoutBase, w.copyoutSeq)
+		case assigned[info.Idx-w.copyoutBase]:
+			reason = fmt.Sprintf("copyout index %v is assigned several times", info.Idx)
+		default:
+			assigned[info.Idx-w.copyoutBase] = true
+			return nil
+		}
+		name := "ret"
+		if arg.Type() != nil {
+			name = arg.Type().Name()
+		}
+		return &ExecValidationError{ci, c.Meta.Name, name, reason}
+	}
+	for ci, c := range p.Calls {
+		if err := check(ci, c, c.Ret); err != nil {
+			return err
+		}
+		var err error
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			if err == nil {
+				err = check(ci, c, arg)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, ok := range assigned {
+		if !ok {
+			return fmt.Errorf("copyout index %v is not assigned to any result", w.copyoutBase+uint64(i))
+		}
+	}
+	return nil
+}
+
+// persist records that the pointee of persistent pointer a is written
+// and returns true if it was already written by a previous call.
+func (w *execContext) persist(a *PointerArg) bool {
+	if w.persisted == nil {
+		w.persisted = make(map[uint64]uint64)
+	}
+	addr, size := w.physicalAddr(a), a.Res.Size()
+	if prev, ok := w.persisted[addr]; ok && prev >= size {
+		return true
+	}
+	w.persisted[addr] = size
+	return false
+}
+
+// zeroCopyin returns true if copyin of arg to addr does not change memory
+// in a zeroed data region, see ExecOpts.AssumeZeroedArena.
+func (w *execContext) zeroCopyin(addr uint64, arg Arg, pid int) bool {
+	switch a := arg.(type) {
+	case *ConstArg:
+		// Bitfields are combined with neighbours in the same storage unit.
+		if a.Type().BitfieldLength() != 0 {
+			return false
+		}
+		if v, _ := a.hostValue(pid); v != 0 || a.ValHigh != 0 {
+			return false
+		}
+	case *DataArg:
+		for _, v := range a.Data() {
+			if v != 0 {
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	size := arg.Size()
+	for _, ranges := range [][]copyinRange{w.dirty, w.copyins.ranges} {
+		for _, r := range ranges {
+			if r.addr < addr+size && addr < r.addr+r.size {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// addDirty records memory referenced by pointer args of call c,
+// since it can be changed by the call or by its copyins.
+func (w *execContext) addDirty(c *Call) {
+	foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+		a, ok := arg.(*PointerArg)
+		if !ok || a.IsNull {
+			return
+		}
+		size := a.PagesNum * w.target.PageSize
+		if a.Res != nil {
+			size = a.Res.Size()
+		}
+		w.dirty = append(w.dirty, copyinRange{w.physicalAddr(arg), size})
+	})
+}
+
+// copyinSet tracks copyins of the current call, so that a copyin that writes
+// the same data to the same address as a previous one is not emitted again.
+// A copyin is a duplicate only if no copyin in between has overwritten its memory,
+// otherwise it must be emitted again to preserve the last-writer-wins semantics.
+// The set is reused across calls and programs to avoid allocations.
+type copyinSet struct {
+	ranges []copyinRange
+	last   map[copyinKey]copyinRef // the last copyin with the key
+}
+
+type copyinRange struct {
+	addr uint64
+	size uint64
+}
+
+// copyinKey identifies memory written by a copyin, values are compared separately.
+type copyinKey struct {
+	addr uint64
+	meta uint64 // size and byte order of const args, size and copyinKeyData for data args
+}
+
+const copyinKeyData = 1 << 63
+
+type copyinRef struct {
+	checked int // ranges before this index don't overlap the copyin
+	val     uint64
+	hi      uint64
+	data    []byte
+}
+
+func (ref copyinRef) sameValue(other copyinRef) bool {
+	return ref.val == other.val && ref.hi == other.hi && bytes.Equal(ref.data, other.data)
+}
+
+func (s *copyinSet) reset() {
+	s.ranges = s.ranges[:0]
+	for key := range s.last {
+		delete(s.last, key)
+	}
+}
+
+// add records a copyin of arg to addr and returns false if it duplicates a previous one.
+func (s *copyinSet) add(addr uint64, arg Arg, pid int) bool {
+	size := arg.Size()
+	key, ref, ok := makeCopyinKey(addr, arg, pid)
+	if ok {
+		if prev, found := s.last[key]; found && prev.sameValue(ref) && !s.overwritten(prev.checked, addr, size) {
+			// Ranges up to now are checked, the next check starts from the new ones.
+			prev.checked = len(s.ranges)
+			s.last[key] = prev
+			return false
+		}
+		if s.last == nil {
+			s.last = make(map[copyinKey]copyinRef)
+		}
+		ref.checked = len(s.ranges) + 1
+		s.last[key] = ref
+	}
+	s.ranges = append(s.ranges, copyinRange{addr, size})
+	return true
+}
+
+// overwritten returns true if any copyin starting from index idx overlaps [addr, addr+size).
+func (s *copyinSet) overwritten(idx int, addr, size uint64) bool {
+	for _, r := range s.ranges[idx:] {
+		if r.addr < addr+size && addr < r.addr+r.size {
+			return true
+		}
+	}
+	return false
+}
+
+// makeCopyinKey returns the key and the value of the data written by a copyin of arg.
+// Only plain const and data args can be deduplicated.
+func makeCopyinKey(addr uint64, arg Arg, pid int) (copyinKey, copyinRef, bool) {
+	switch a := arg.(type) {
+	case *ConstArg:
+		if a.Type().BitfieldLength() != 0 {
+			return copyinKey{}, copyinRef{}, false
+		}
+		val, bigEndian := a.hostValue(pid)
+		meta := a.Size()
+		if bigEndian {
+			meta |= ExecArgFlagBigEndian
+		}
+		return copyinKey{addr, meta}, copyinRef{val: val, hi: a.ValHigh}, true
+	case *DataArg:
+		return copyinKey{addr, a.Size() | copyinKeyData}, copyinRef{data: a.Data()}, true
+	}
+	return copyinKey{}, copyinRef{}, false
+}
+
+// writeBitfields writes a group of bitfields that share the storage unit at addr.
+// The group is coalesced into a single copyin of the combined value when possible,
+// so that executor does not need to read-modify-write the same memory several times.
+func (w *execContext) writeBitfields(addr uint64, group []*ConstArg, pid int) {
+	if len(group) > 1 && !w.opts.EmitTypeIDs {
+		size := group[0].Size()
+		var val uint64
+		ok := true
+		for _, arg := range group {
+			v, bigEndian := arg.hostValue(pid)
+			if bigEndian || arg.Size() != size {
+				ok = false
+				break
+			}
+			off, len := arg.Type().BitfieldOffset(), arg.Type().BitfieldLength()
+			val |= (v & (1<<len - 1)) << off
+		}
+		if ok {
+			w.writeInstr(ExecInstrCopyin)
+			w.write(addr)
+			w.write(ExecArgTypeConst)
+			w.writeSize(size)
+			w.write(val)
+			w.writeSize(0) // bit field offset
+			w.writeSize(0) // bit field length
+			return
+		}
+	}
+	for _, arg := range group {
+		w.writeInstr(ExecInstrCopyin)
+		w.write(addr)
+		w.writeArg(arg, pid)
+	}
+}
+
+// writeChecksums generates checksum calculation instructions starting from the last one,
+// since checksum values can depend on values of the latter ones.
+func (w *execContext) writeChecksums(c *Call, csumMap map[Arg]CsumInfo) {
+	if len(csumMap) == 0 {
+		return
+	}
+	// Collect the args in a deterministic order rather than iterating over the map.
+	var csumArgs []Arg
+	foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+		if _, ok := csumMap[arg]; ok {
+			csumArgs = append(csumArgs, arg)
+		}
+	})
+	sort.Stable(ByPhysicalAddr{Args: csumArgs, Context: w})
+	for i := len(csumArgs) - 1; i >= 0; i-- {
+		arg := csumArgs[i]
+		if _, ok := arg.Type().(*CsumType); !ok {
+			panic("csum arg is not csum type")
+		}
+		if w.skipCsums[arg] {
+			continue
+		}
+		// Don't emit a part of the instruction if the buffer overflows in the middle of it.
+		if w.out == nil && w.csumByteSize(arg, csumMap[arg]) > len(w.buf)+len(w.next) {
+			w.eof = true
+			return
+		}
+		w.writeInstr(ExecInstrCopyin)
+		w.write(w.argAddr(arg))
+		w.write(ExecArgTypeCsum)
+		w.writeSize(arg.Size())
+		switch csumMap[arg].Kind {
+		case CsumInet:
+			w.write(ExecArgCsumInet)
+			w.write(uint64(len(csumMap[arg].Chunks)))
+			for _, chunk := range csumMap[arg].Chunks {
+				switch chunk.Kind {
+				case CsumChunkArg:
+					w.write(ExecArgCsumChunkData)
+					w.write(w.argAddr(chunk.Arg))
+					// Size of variable-length args includes all nested args (e.g. IPv4 options).
+					w.writeSize(chunk.Arg.Size())
+				case CsumChunkConst:
+					w.write(ExecArgCsumChunkConst)
+					w.write(w.csumConst(chunk.Value, chunk.Size))
+					w.writeSize(chunk.Size)
+				case CsumChunkLen:
+					w.write(ExecArgCsumChunkConst)
+					w.write(w.csumConst(chunk.lenValue(), chunk.Size))
+					w.writeSize(chunk.Size)
+				default:
+					panic(fmt.Sprintf("csum chunk has unknown kind %v", chunk.Kind))
+				}
+			}
+		case CsumCrc32, CsumCrc32c:
+			chunk := csumMap[arg].Chunks[0]
+			w.write(ExecArgCsumCrc32)
+			w.write(w.argAddr(chunk.Arg))
+			w.writeSize(chunk.Arg.Size())
+			w.write(crc32Poly(csumMap[arg].Kind))
+		default:
+			panic(fmt.Sprintf("csum arg has unknown kind %v", csumMap[arg].Kind))
+		}
+	}
+}
+
+// csumByteSize returns size of the checksum copyin instruction for arg written by writeChecksums.
+func (w *execContext) csumByteSize(arg Arg, info CsumInfo) int {
+	size := w.wordByteSize(ExecInstrCopyin) + w.wordByteSize(w.argAddr(arg)) +
+		w.wordByteSize(ExecArgTypeCsum) + w.sizeByteSize(arg.Size())
+	switch info.Kind {
+	case CsumInet:
+		size += w.wordByteSize(ExecArgCsumInet) + w.wordByteSize(uint64(len(info.Chunks)))
+		for _, chunk := range info.Chunks {
+			switch chunk.Kind {
+			case CsumChunkArg:
+				size += w.wordByteSize(ExecArgCsumChunkData) + w.wordByteSize(w.argAddr(chunk.Arg)) +
+					w.sizeByteSize(chunk.Arg.Size())
+			case CsumChunkConst:
+				size += w.wordByteSize(ExecArgCsumChunkConst) + w.wordByteSize(w.csumConst(chunk.Value, chunk.Size)) +
+					w.sizeByteSize(chunk.Size)
+			case CsumChunkLen:
+				size += w.wordByteSize(ExecArgCsumChunkConst) +
+					w.wordByteSize(w.csumConst(chunk.lenValue(), chunk.Size)) +
+					w.sizeByteSize(chunk.Size)
+			}
+		}
+	case CsumCrc32, CsumCrc32c:
+		chunk := info.Chunks[0]
+		size += w.wordByteSize(ExecArgCsumCrc32) + w.wordByteSize(w.argAddr(chunk.Arg)) +
+			w.sizeByteSize(chunk.Arg.Size()) + w.wordByteSize(crc32Poly(info.Kind))
+	}
+	return size
+}
+
+// csumConst returns value of a const csum chunk of size bytes for the target.
+// Chunk values are in network byte order as stored on little-endian hosts,
+// so they are swapped back for big-endian targets.
+func (w *execContext) csumConst(v, size uint64) uint64 {
+	if w.bigEndian {
+		return encodeValue(v, size, true)
+	}
+	return v
+}
+
+// crc32Poly returns ExecArgCsumCrc32 polynomial of CRC32 csum kind.
+func crc32Poly(kind CsumKind) uint64 {
+	if kind == CsumCrc32c {
+		return crc32.Castagnoli
+	}
+	return crc32.IEEE
+}
+
+// wordByteSize returns number of bytes write uses for v.
+func (w *execContext) wordByteSize(v uint64) int {
+	if w.opts.Varint {
+		return binary.PutVarint(w.varint[:], int64(v))
+	}
+	return 8
+}
+
+// sizeByteSize returns number of bytes writeSize uses for v.
+func (w *execContext) sizeByteSize(v uint64) int {
+	if width := w.opts.SizeWidth; width != 0 && width != execDefaultSizeWidth {
+		return int(width)
+	}
+	return w.wordByteSize(v)
+}
+
+// writeCall generates the call itself.
+func (w *execContext) writeCall(c *Call, pid int) {
+	if w.opts.AlignCalls != 0 {
+		w.alignCall()
+	}
+	if w.opts.RepeatCalls && c.Repeat > 1 {
+		w.writeInstr(ExecInstrRepeat)
+		w.write(c.Repeat)
+	}
+	if w.opts.EmitCallHash {
+		w.writeInstr(ExecInstrCallHash)
+		w.write(CallHash(c))
+	}
+	if w.opts.EmitCallTimeout && c.Meta.Timeout != 0 {
+		w.writeInstr(ExecInstrCallTimeout)
+		w.write(c.Meta.Timeout)
+	}
+	if w.opts.AsyncCalls && c.Async {
+		w.writeInstr(ExecInstrAsync)
+	}
+	if w.opts.EmitFailNth && c.FailNth != 0 {
+		w.writeInstr(ExecInstrFailNth)
+		w.write(c.FailNth)
+	}
+	if w.opts.EmitCallProps && (c.Props != (CallProps{}) || c.Repeat > 1) {
+		w.writeCallProps(c)
+	}
+	if w.opts.EmitSyscallNR {
+		w.writeInstr(c.Meta.NR)
+	} else {
+		w.writeInstr(uint64(c.Meta.ID))
+	}
+	if w.isUsed(c.Ret) || w.opts.CaptureAllReturns {
+		info := w.addArgInfo(c.Ret)
+		info.Idx = w.copyoutSeq
+		info.Async = w.opts.AsyncCalls && c.Async
+		info.copiedOut = true
+		w.write(w.copyoutSeq)
+		w.copyoutSeq++
+	} else {
+		w.write(ExecNoCopyout)
+	}
+	args := w.execArgs(c)
+	regs := len(args)
+	if w.target.ExecRegArgs != nil {
+		if n := w.target.ExecRegArgs(c.Meta); n < regs {
+			regs = n
+		}
+	}
+	if regs == len(args) {
+		w.write(uint64(len(args)))
+	} else {
+		// The last register arg points to the memory block with the rest of args.
+		w.write(uint64(regs + 1))
+	}
+	for _, arg := range args[:regs] {
+		w.writeArg(arg, pid)
+	}
+	if regs != len(args) {
+		w.write(ExecArgTypeArgBlock)
+		w.write(uint64(len(args) - regs))
+		for _, arg := range args[regs:] {
+			w.writeArg(arg, pid)
+		}
+	}
+}
+
+// alignCall writes ExecInstrNop's until the current offset is aligned to ExecOpts.AlignCalls.
+// Nops take 1 byte with Varint and 8 bytes otherwise.
+func (w *execContext) alignCall() {
+	align := int64(w.opts.AlignCalls)
+	if !w.opts.Varint && w.pos%8 != 0 {
+		if w.limitErr == nil {
+			w.limitErr = fmt.Errorf("can't align call at unaligned offset %v", w.pos)
+		}
+		return
+	}
+	for w.pos%align != 0 && !w.eof {
+		w.writeInstr(ExecInstrNop)
+	}
+}
+
+// writeExpectedReturn writes ExecInstrExpectReturn for call ci if it's in ExecOpts.ExpectedReturns.
+func (w *execContext) writeExpectedReturn(ci int) {
+	if ret, ok := w.opts.ExpectedReturns[ci]; ok {
+		w.writeInstr(ExecInstrExpectReturn)
+		w.write(ret)
+	}
+}
+
+// execArgs returns args of the call in the order defined by Target.ExecArgOrder.
+func (w *execContext) execArgs(c *Call) []Arg {
+	if w.target.ExecArgOrder == nil {
+		return c.Args
+	}
+	order := w.target.ExecArgOrder(c.Meta)
+	if order == nil {
+		return c.Args
+	}
+	if len(order) != len(c.Args) {
+		panic(fmt.Sprintf("%v: arg order %v does not match %v args", c.Meta.Name, order, len(c.Args)))
+	}
+	args := make([]Arg, len(order))
+	seen := make([]bool, len(order))
+	for i, idx := range order {
+		if idx < 0 || idx >= len(c.Args) || seen[idx] {
+			panic(fmt.Sprintf("%v: bad arg order %v", c.Meta.Name, order))
+		}
+		seen[idx] = true
+		args[i] = c.Args[idx]
+	}
+	return args
+}
+
+// writeCopyouts generates copyout instructions that persist interesting return values.
+func (w *execContext) writeCopyouts(c *Call) {
+	foreachArg(c, func(arg, base Arg, _ *[]Arg) {
+		if !w.isUsed(arg) {
+			return
+		}
+		switch arg.(type) {
+		case *ReturnArg:
+			// Idx is already assigned in writeCall.
+		case *ConstArg, *ResultArg:
+			// Create a separate copyout instruction that has own Idx.
+			if _, ok := base.(*PointerArg); !ok {
+				panic("arg base is not a pointer")
+			}
+			info := w.argInfo(arg)
+			info.Idx = w.copyoutSeq
+			info.Async = w.opts.AsyncCalls && c.Async
+			info.copiedOut = true
+			w.copyoutSeq++
+			w.writeInstr(ExecInstrCopyout)
+			w.write(info.Idx)
+			w.write(info.Addr)
+			// Results can't be bitfields, so the type size is the whole storage unit
+			// of the value; padding around it belongs to separate pad args.
+			size := arg.Size()
+			if w.opts.CopyoutOnSuccess {
+				size |= ExecCopyoutFlagOnSuccess
+			}
+			w.writeSize(size)
+		default:
+			panic("bad arg kind in copyout")
+		}
+	})
+	if !w.opts.CopyoutData {
+		return
+	}
+	foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+		if !isCopyoutData(arg) {
+			return
+		}
+		info := w.argInfo(arg)
+		if info == nil {
+			// Copyins of the call were not written because the buffer has overflowed.
+			return
+		}
+		info.Idx = w.copyoutSeq
+		info.copiedOut = true
+		w.copyoutSeq++
+		w.writeInstr(ExecInstrCopyoutData)
+		w.write(info.Idx)
+		w.write(info.Addr)
+		w.writeSize(arg.Size())
+	})
+}
+
+// writeCallProps writes ExecInstrCallProps with non-zero props of call c.
+func (w *execContext) writeCallProps(c *Call) {
+	rerun := c.Repeat
+	if rerun <= 1 {
+		rerun = 0
+	}
+	kv := [...]uint64{
+		ExecCallPropCollideGroup, c.Props.CollideGroup,
+		ExecCallPropSandbox, c.Props.Sandbox,
+		ExecCallPropRerun, rerun,
+	}
+	n := uint64(0)
+	for i := 0; i < len(kv); i += 2 {
+		if kv[i+1] != 0 {
+			n++
+		}
+	}
+	w.writeInstr(ExecInstrCallProps)
+	w.write(n)
+	for i := 0; i < len(kv); i += 2 {
+		if kv[i+1] != 0 {
+			w.write(kv[i])
+			w.write(kv[i+1])
+		}
+	}
+}
+
+// isCopyoutData returns whether arg is written by the kernel and is copied out
+// with ExecInstrCopyoutData (see ExecOpts.CopyoutData).
+func isCopyoutData(arg Arg) bool {
+	a, ok := arg.(*DataArg)
+	return ok && a.Type().Dir() != DirIn && a.Size() != 0
+}
+
+// CopyoutDataArgs maps copyout indices of ExecInstrCopyoutData of program p serialized
+// for process pid with opts (ExecOpts.CopyoutData is implied) to the data args,
+// so that buffers reported by executor can be matched with the args of the program.
+func (p *Prog) CopyoutDataArgs(pid int, opts ExecOpts) (map[uint64]Arg, error) {
+	opts.CopyoutData = true
+	opts.OnInstr = nil
+	w := newExecContext(p.Target, nil, opts)
+	w.out = ioutil.Discard
+	if err := w.serializeProg(p, pid); err != nil {
+		return nil, err
+	}
+	args := make(map[uint64]Arg)
+	for _, c := range p.Calls {
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			if info := w.argInfo(arg); info != nil && info.copiedOut && isCopyoutData(arg) {
+				args[info.Idx] = arg
+			}
+		})
+	}
+	return args, nil
+}
+
+// unionOptionIndex returns index of the selected option of union arg.
+func unionOptionIndex(arg *UnionArg) uint64 {
+	for i, typ := range arg.Type().(*UnionType).Fields {
+		if typ == arg.OptionType {
+			return uint64(i)
+		}
+	}
+	panic(fmt.Sprintf("union %v has unknown option %v", arg.Type().Name(), arg.OptionType.Name()))
+}
+
+// CallHash returns hash of the shape of call c: the syscall and types of all its args
+// (including the selected union options and the number of array elements), but not their values.
+// The hash is stable across processes and runs of the same descriptions.
+func CallHash(c *Call) uint64 {
+	h := fnv.New64a()
+	io.WriteString(h, c.Meta.Name)
+	foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+		h.Write([]byte{0})
+		io.WriteString(h, arg.Type().Name())
+		if a, ok := arg.(*PointerArg); ok && a.Res == nil {
+			// Distinguish pointers without pointee from pointers to args of the same type.
+			h.Write([]byte{1})
+		}
+	})
+	return h.Sum64()
+}
+
+// uniformData returns the byte value of data if it is large enough
+// and consists of a single repeated byte value.
+func uniformData(data []byte) (byte, bool) {
+	if len(data) < execMinFillSize {
+		return 0, false
+	}
+	for _, v := range data[1:] {
+		if v != data[0] {
+			return 0, false
+		}
+	}
+	return data[0], true
+}
+
+// physicalAddr returns address of pointer arg within the data region that starts at dataOffset.
+// Returns an error if the address overflows or is outside of the data region.
+func (target *Target) physicalAddr(arg Arg, dataOffset uint64) (uint64, error) {
+	a, ok := arg.(*PointerArg)
+	if !ok {
+		panic("physicalAddr: bad arg kind")
+	}
+	size := target.NumPages * target.PageSize
+	if dataOffset > math.MaxUint64-size {
+		return 0, fmt.Errorf("data region [0x%x, +0x%x) overflows", dataOffset, size)
+	}
+	if a.PageIndex >= target.NumPages {
+		return 0, fmt.Errorf("pointer arg %v page %v is outside of data region of %v pages",
+			a.Type().Name(), a.PageIndex, target.NumPages)
+	}
+	if target.FlatMemory {
+		// Page index is bounded, so this does not overflow.
+		off := int64(a.PageIndex*target.PageSize) + int64(a.PageOffset)
+		if off < 0 || uint64(off) >= size {
+			return 0, fmt.Errorf("pointer arg %v offset %v is outside of data region",
+				a.Type().Name(), off)
+		}
+		return dataOffset + uint64(off), nil
+	}
+	// Page index is bounded, so this does not overflow.
+	addr := dataOffset + a.PageIndex*target.PageSize
+	if a.PageOffset >= 0 {
+		if uint64(a.PageOffset) >= size {
+			return 0, fmt.Errorf("pointer arg %v page offset %v is outside of data region",
+				a.Type().Name(), a.PageOffset)
+		}
+		addr += uint64(a.PageOffset)
+	} else {
+		// Negative offsets count from the end of the page and can point before the page.
+		addr += target.PageSize
+		if uint64(-a.PageOffset) > addr {
+			return 0, fmt.Errorf("pointer arg %v page offset %v underflows address space",
+				a.Type().Name(), a.PageOffset)
+		}
+		addr -= uint64(-a.PageOffset)
+	}
+	if addr >= dataOffset+size {
+		return 0, fmt.Errorf("pointer arg %v address 0x%x is outside of data region",
+			a.Type().Name(), addr)
+	}
+	return addr, nil
+}
+
+// ExecMemFootprint returns the number of data region pages spanned by memory
+// referenced by pointer arguments of the program, counting from the start of the region.
+// Pointers outside of the data region are ignored.
+func (p *Prog) ExecMemFootprint() (pages uint64) {
+	if len(p.Calls) == 0 {
+		return 0
+	}
+	target := p.Target
+	var end uint64
+	for _, c := range p.Calls {
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			a, ok := arg.(*PointerArg)
+			if !ok || a.IsNull {
+				return
+			}
+			addr, err := target.physicalAddr(a, target.DataOffset)
+			if err != nil {
+				return
+			}
+			size := a.PagesNum * target.PageSize
+			if a.Res != nil {
+				size = a.Res.Size()
+			}
+			if e := addr - target.DataOffset + size; e > end {
+				end = e
+			}
+		})
+	}
+	return (end + target.PageSize - 1) / target.PageSize
+}
+
+// physicalAddr returns address of pointer arg, the arg must pass validateExec.
+func (w *execContext) physicalAddr(arg Arg) uint64 {
+	addr, err := w.target.physicalAddr(arg, w.dataOffset)
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+type execContext struct {
+	target      *Target
+	opts        ExecOpts
+	bigEndian   bool // words are written in big-endian byte order (Target.BigEndian)
+	dataOffset  uint64
+	buf         []byte
+	eof         bool
+	copyoutSeq  uint64
+	copyoutBase uint64         // first copyout index of the program (see MergeForExec)
+	pos         int64          // number of written bytes
+	ninstrs     int            // number of instructions written for the current program
+	limitErr    error          // set if the program exceeds ExecMaxBlobLen
+	setupOnly   bool           // emit only copyin and checksum instructions
+	addrs       map[Arg]uint64 // if set, collects addresses of all args in the data region
+	copyins     copyinSet
+	dirty       []copyinRange     // memory used by previous calls, see ExecOpts.AssumeZeroedArena
+	callEnds    []int             // len(buf) after complete calls, see ExecOpts.TruncateOnOverflow
+	persisted   map[uint64]uint64 // addr -> size of written persistent pointees of the program
+	redact      bool              // replace contents of data args with zeros
+
+	// Infos of args referenced by result args and checksums, argIdx maps args
+	// to indices in infos. Both are reused across programs to reduce allocations.
+	infos  []argInfo
+	argIdx map[Arg]int
+
+	// Checksums of the current call that are not recalculated, and inputs
+	// of all checksums of the program, see ExecOpts.CsumCache.
+	skipCsums  map[Arg]bool
+	csumHashes map[uint64]uint64
+	csumDups   map[uint64]bool
+
+	// Words of the current instruction, collected only if opts.OnInstr is set.
+	instr []uint64
+	// Encoded sizes of instr words (see ExecInstr.Widths) and whether
+	// regular words of the instruction are varints.
+	instrWidths []int
+	instrVarint bool
+	// In debug mode instructions are checked with execOrderChecker.
+	checkOrder    bool
+	order         execOrderChecker
+	collectInstrs bool // instructions are collected in instr
+
+	// If out is set, the program is streamed to out instead of buf.
+	out    io.Writer
+	outErr error
+	word   [8]byte
+	varint [binary.MaxVarintLen64]byte
+
+	// If set, serialization continues in next when buf is exhausted (see ExecRing).
+	next []byte
+	// If countOverflow is set, serialization does not stop when buf is exhausted,
+	// but sets overflow and only counts pos, so that the required size is known.
+	countOverflow bool
+	overflow      bool
+
+	// If hashing is set, hash is FNV-1a hash of all written bytes (see SerializeAndHashForExec).
+	hashing bool
+	hash    uint64
+}
+
+// ExecContext allows to build custom exec streams using the same routines
+// as SerializeForExec. An ExecContext is not safe for concurrent use.
+type ExecContext struct {
+	w      *execContext
+	buffer []byte
+}
+
+// NewExecContext returns a context that writes exec stream into buffer.
+// Only opts that affect encoding of individual words and args are taken into account.
+func (target *Target) NewExecContext(buffer []byte, opts ExecOpts) *ExecContext {
+	w := newExecContext(target, buffer, opts)
+	w.countOverflow = true
+	return &ExecContext{
+		w:      w,
+		buffer: buffer,
+	}
+}
+
+// Write writes a single word (instruction, call ID, number of args, etc).
+func (ctx *ExecContext) Write(v uint64) {
+	ctx.w.write(v)
+}
+
+// WriteArg writes arg of a program for execution by process pid.
+// Result args that reference other args are not supported,
+// since copyout indices are known only during serialization of the whole program.
+func (ctx *ExecContext) WriteArg(arg Arg, pid int) {
+	if a, ok := arg.(*ResultArg); ok && a.Res != nil {
+		panic("ExecContext.WriteArg: result arg references other arg")
+	}
+	ctx.w.writeArg(arg, pid)
+}
+
+// Finish writes ExecInstrEOF and returns the resulting stream.
+// If the buffer is too small, ExecBufferTooSmallError with the size of the whole stream is returned.
+func (ctx *ExecContext) Finish() ([]byte, error) {
+	ctx.w.writeEOF()
+	if ctx.w.overflow {
+		return nil, &ExecBufferTooSmallError{int(ctx.w.pos)}
+	}
+	return ctx.buffer[:len(ctx.buffer)-len(ctx.w.buf)], nil
+}
+
+func newExecContext(target *Target, buf []byte, opts ExecOpts) *execContext {
+	w := new(execContext)
+	w.reset(target, buf, opts)
+	return w
+}
+
+// execContextPool caches contexts of finished serializations, so that their maps
+// and slices are reused instead of being allocated for every program.
+var execContextPool = sync.Pool{New: func() interface{} { return new(execContext) }}
+
+// getExecContext is newExecContext that reuses a cached context if there is one.
+// The context must be returned with putExecContext and not used after that.
+func getExecContext(target *Target, buf []byte, opts ExecOpts) *execContext {
+	w := execContextPool.Get().(*execContext)
+	w.reset(target, buf, opts)
+	return w
+}
+
+// putExecContext returns w to the pool. References to the program, the buffer
+// and opts are dropped, so that cached contexts don't keep them alive.
+func putExecContext(w *execContext) {
+	w.reset(nil, nil, ExecOpts{})
+	execContextPool.Put(w)
+}
+
+// reset prepares the context for serialization into buf,
+// so that it can be reused for another program without leaking any state.
+func (w *execContext) reset(target *Target, buf []byte, opts ExecOpts) {
+	w.target = target
+	w.opts = opts
+	w.bigEndian = target != nil && target.BigEndian
+	w.dataOffset = opts.DataOffset
+	// Empty programs may have no target.
+	if w.dataOffset == 0 && target != nil {
+		w.dataOffset = target.DataOffset
+	}
+	if opts.RelativePointers {
+		w.dataOffset = 0
+	}
+	w.buf = buf
+	w.eof = false
+	w.resetArgs()
+	w.copyoutSeq = 0
+	w.copyoutBase = 0
+	w.pos = 0
+	w.setupOnly = false
+	w.redact = false
+	w.addrs = nil
+	w.copyins.reset()
+	w.skipCsums = nil
+	w.csumHashes = nil
+	w.csumDups = nil
+	w.dirty = w.dirty[:0]
+	w.callEnds = w.callEnds[:0]
+	w.instr = w.instr[:0]
+	w.instrWidths = w.instrWidths[:0]
+	// Type IDs make copyin instructions ambiguous for the checker.
+	w.checkOrder = debug && !opts.EmitTypeIDs
+	w.order.reset()
+	w.collectInstrs = opts.OnInstr != nil || w.checkOrder
+	w.out = nil
+	w.outErr = nil
+	w.next = nil
+	w.countOverflow = false
+	w.overflow = false
+	w.hashing = false
+	w.hash = fnvOffset64
+}
+
+func (w *execContext) resetArgs() {
+	w.infos = w.infos[:0]
+	if w.argIdx == nil {
+		w.argIdx = make(map[Arg]int)
+		return
+	}
+	for arg := range w.argIdx {
+		delete(w.argIdx, arg)
+	}
+}
+
+type argInfo struct {
+	Addr uint64 // physical addr
+	Idx  uint64 // copyout instruction index
+	// Async is set if the arg is a result of an async call, it is not known
+	// until the end of the program and can't be referenced by other calls.
+	Async     bool
+	used      bool // referenced by result args and results can be read from it
+	readable  bool // results can be read from the arg
+	copiedOut bool // Idx is assigned
+}
+
+// argInfo returns info of arg, or nil if there is none.
+// The result is valid until the next addArgInfo.
+func (w *execContext) argInfo(arg Arg) *argInfo {
+	if i, ok := w.argIdx[arg]; ok {
+		return &w.infos[i]
+	}
+	return nil
+}
+
+// addArgInfo returns info of arg, adding an empty one if there is none.
+// The result is valid until the next addArgInfo.
+func (w *execContext) addArgInfo(arg Arg) *argInfo {
+	if i, ok := w.argIdx[arg]; ok {
+		return &w.infos[i]
+	}
+	w.argIdx[arg] = len(w.infos)
+	w.infos = append(w.infos, argInfo{})
+	return &w.infos[len(w.infos)-1]
+}
+
+// isUsed returns whether arg is referenced by result args (see markUsed).
+func (w *execContext) isUsed(arg Arg) bool {
+	info := w.argInfo(arg)
+	return info != nil && info.used
+}
+
+// argAddr returns physical address of arg with info, or 0 if arg has no info.
+func (w *execContext) argAddr(arg Arg) uint64 {
+	if info := w.argInfo(arg); info != nil {
+		return info.Addr
+	}
+	return 0
+}
+
+// writeInstr writes the first word of a new instruction.
+func (w *execContext) writeInstr(v uint64) {
+	w.ninstrs++
+	w.flushInstr()
+	w.instrVarint = w.opts.Varint
+	w.write(v)
+}
+
+// writeEOF writes the terminating ExecInstrEOF.
+func (w *execContext) writeEOF() {
+	w.writeInstr(ExecInstrEOF)
+	w.flushInstr()
+}
+
+// flushInstr passes the current instruction to opts.OnInstr and to the order checker in debug mode.
+func (w *execContext) flushInstr() {
+	if len(w.instr) == 0 {
+		return
+	}
+	if !w.eof {
+		if w.checkOrder {
+			if err := w.order.add(w.instr); err != nil {
+				panic(err)
+			}
+		}
+		if w.opts.OnInstr != nil {
+			w.opts.OnInstr(w.instr[0], w.instr)
+		}
+	}
+	w.instr = w.instr[:0]
+	w.instrWidths = w.instrWidths[:0]
+}
+
+func (w *execContext) write(v uint64) {
+	if w.eof {
+		return
+	}
+	if w.collectInstrs {
+		w.instr = append(w.instr, v)
+		w.instrWidths = append(w.instrWidths, 0)
+	}
+	if w.opts.Varint {
+		w.writeVarint(v)
+		return
+	}
+	w.pos += 8
+	buf := w.buf
+	if w.out != nil || len(buf) < 8 {
+		buf = w.word[:]
+	}
+	if w.bigEndian {
+		binary.BigEndian.PutUint64(buf, v)
+	} else {
+		buf[0] = byte(v >> 0)
+		buf[1] = byte(v >> 8)
+		buf[2] = byte(v >> 16)
+		buf[3] = byte(v >> 24)
+		buf[4] = byte(v >> 32)
+		buf[5] = byte(v >> 40)
+		buf[6] = byte(v >> 48)
+		buf[7] = byte(v >> 56)
+	}
+	if w.hashing {
+		w.hashBytes(buf[:8], 0)
+	}
+	if w.out != nil {
+		w.writeOut(buf)
+		return
+	}
+	if len(w.buf) < 8 {
+		w.writeSplit(buf)
+		return
+	}
+	w.buf = w.buf[8:]
+}
+
+// truncateValue masks v to size bytes, so that executors on all architectures
+// see the same value. Values don't always fit (e.g. sign-extended negative values
+// or len args of large structs in small ints), so this is not a bug.
+func truncateValue(v, size uint64) uint64 {
+	return v & (uint64(1)<<(size*8) - 1)
+}
+
+// writeSize writes a size word (see ExecOpts.SizeWidth).
+func (w *execContext) writeSize(v uint64) {
+	width := w.opts.SizeWidth
+	if width == 0 || width == execDefaultSizeWidth {
+		w.write(v)
+		return
+	}
+	if v>>(width*8) != 0 && w.limitErr == nil {
+		w.limitErr = fmt.Errorf("size 0x%x does not fit into %v bytes", v, width)
+	}
+	if w.bigEndian {
+		binary.BigEndian.PutUint64(w.word[:], v)
+		w.writeData(w.word[8-width:], int(width))
+		return
+	}
+	binary.LittleEndian.PutUint64(w.word[:], v)
+	w.writeData(w.word[:width], int(width))
+}
+
+// writeSplit writes data that may not fit into buf, continuing in next
+// (the wrapped part of ExecRing free space) if there is one.
+func (w *execContext) writeSplit(data []byte) {
+	n := copy(w.buf, data)
+	w.buf = w.buf[n:]
+	if n == len(data) {
+		return
+	}
+	if len(w.next) < len(data)-n {
+		w.overflow = true
+		w.eof = !w.countOverflow
+		return
+	}
+	w.buf, w.next = w.next, nil
+	w.buf = w.buf[copy(w.buf, data[n:]):]
+}
+
+// writeVarint writes v as a signed varint, so that both small values
+// and instructions (which are small negative values) take few bytes.
+func (w *execContext) writeVarint(v uint64) {
+	n := binary.PutVarint(w.varint[:], int64(v))
+	w.pos += int64(n)
+	if w.hashing {
+		w.hashBytes(w.varint[:n], 0)
+	}
+	if w.out != nil {
+		w.writeOut(w.varint[:n])
+		return
+	}
+	if len(w.buf) < n {
+		w.writeSplit(w.varint[:n])
+		return
+	}
+	copy(w.buf, w.varint[:n])
+	w.buf = w.buf[n:]
+}
+
+// writeData writes data padded with zeros to padded bytes.
+func (w *execContext) writeData(data []byte, padded int) {
+	if w.eof {
+		return
+	}
+	w.pos += int64(padded)
+	if w.hashing {
+		w.hashBytes(data, padded-len(data))
+	}
+	if w.collectInstrs {
+		for i := 0; i < padded; i += 8 {
+			var word [8]byte
+			if i < len(data) {
+				copy(word[:], data[i:])
+			}
+			w.instr = append(w.instr, w.target.execByteOrder().Uint64(word[:]))
+			width := padded - i
+			if width > 8 {
+				width = 8
+			}
+			w.instrWidths = append(w.instrWidths, width)
+		}
+	}
+	if w.out != nil {
+		w.writeOut(data)
+		for i := range w.word {
+			w.word[i] = 0
+		}
+		for pad := padded - len(data); pad > 0; pad -= len(w.word) {
+			if pad > len(w.word) {
+				w.writeOut(w.word[:])
+			} else {
+				w.writeOut(w.word[:pad])
+			}
+		}
+		return
+	}
+	if len(w.buf) < padded {
+		w.writeSplit(data)
+		for i := range w.word {
+			w.word[i] = 0
+		}
+		for pad := padded - len(data); pad > 0; pad -= len(w.word) {
+			if pad > len(w.word) {
+				w.writeSplit(w.word[:])
+			} else {
+				w.writeSplit(w.word[:pad])
+			}
+		}
+		return
+	}
+	n := copy(w.buf, data)
+	for ; n < padded; n++ {
+		w.buf[n] = 0
+	}
+	w.buf = w.buf[padded:]
+}
+
+// compressData returns zlib-compressed data if it should be emitted
+// as ExecArgTypeDataCompressed according to ExecOpts.CompressData, or nil.
+func (w *execContext) compressData(data []byte) []byte {
+	if !w.opts.CompressData || len(data) < execMinCompressSize {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	zw := zlib.NewWriter(buf)
+	zw.Write(data)
+	zw.Close()
+	if buf.Len() >= len(data) {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// hashBytes adds data followed by pad zero bytes to w.hash.
+func (w *execContext) hashBytes(data []byte, pad int) {
+	h := w.hash
+	for _, b := range data {
+		h ^= uint64(b)
+		h *= fnvPrime64
+	}
+	for ; pad > 0; pad-- {
+		h *= fnvPrime64
+	}
+	w.hash = h
+}
+
+func (w *execContext) writeOut(data []byte) {
+	if w.outErr != nil || len(data) == 0 {
+		return
+	}
+	_, w.outErr = w.out.Write(data)
+}
+
+func (w *execContext) writeArg(arg Arg, pid int) {
+	if w.opts.EmitTypeIDs {
+		w.write(w.target.TypeID(arg.Type()))
+	}
+	switch a := arg.(type) {
+	case *ConstArg:
+		val, bigEndian := a.hostValue(pid)
+		if a.Size() < 8 {
+			val = truncateValue(val, a.Size())
+		}
+		// Big-endian args are already in the right byte order on big-endian targets.
+		bigEndian = bigEndian && !w.bigEndian
+		size := a.Size()
+		if bigEndian && w.opts.ArgByteOrder {
+			size |= ExecArgFlagBigEndian
+		} else if a.Size() != 16 {
+			val = encodeValue(val, a.Size(), bigEndian)
+		}
+		w.write(ExecArgTypeConst)
+		w.writeSize(size)
+		if a.Size() == 16 {
+			lo, hi := val, a.ValHigh
+			if bigEndian && !w.opts.ArgByteOrder {
+				lo, hi = swap64(hi), swap64(lo)
+			}
+			w.write(lo)
+			w.write(hi)
+		} else {
+			w.write(val)
+		}
+		w.writeSize(a.Type().BitfieldOffset())
+		w.writeSize(a.Type().BitfieldLength())
+	case *ResultArg:
+		size := a.Size()
+		if w.opts.ArgByteOrder && !w.bigEndian {
+			if t, ok := a.Type().(*ResourceType); ok && t.Desc.Type.(*IntType).BigEndian {
+				size |= ExecArgFlagBigEndian
+			}
+		}
+		// There are no results in setup-only mode, for skipped calls and unreadable args,
+		// so use the default value.
+		if a.Res == nil || w.setupOnly || !w.isUsed(a.Res) {
+			w.write(ExecArgTypeConst)
+			w.writeSize(size)
+			w.write(a.Val)
+			w.writeSize(0) // bit field offset
+			w.writeSize(0) // bit field length
+		} else {
+			info := w.argInfo(a.Res)
+			if info == nil {
+				panic("no copyout index")
+			}
+			if info.Async && w.limitErr == nil {
+				w.limitErr = fmt.Errorf("result %v of an async call is used by a following call", info.Idx)
+			}
+			w.write(ExecArgTypeResult)
+			w.writeSize(size)
+			w.write(info.Idx)
+			w.write(a.OpDiv)
+			// Executor truncates the result to the arg size, so only the low bytes
+			// of the addend matter (large values are wrap-around subtractions).
+			w.write(truncateValue(a.OpAdd, a.Size()))
+			if w.opts.CopyoutOnSuccess {
+				w.write(a.Type().(*ResourceType).Default())
+			}
+		}
+	case *PointerArg:
+		var addr uint64
+		size := a.Size()
+		if !a.IsNull {
+			addr = w.physicalAddr(arg)
+			if w.opts.RelativePointers {
+				size |= ExecArgFlagPointer
+			}
+		}
+		w.write(ExecArgTypeConst)
+		w.writeSize(size)
+		w.write(addr)
+		w.writeSize(0) // bit field offset
+		w.writeSize(0) // bit field length
+	case *DataArg:
+		data := a.Data()
+		if w.redact {
+			data = make([]byte, len(data))
+		}
+		if compressed := w.compressData(data); compressed != nil {
+			w.write(ExecArgTypeDataCompressed)
+			w.writeSize(uint64(len(compressed)))
+			w.writeSize(uint64(len(data)))
+			data = compressed
+		} else {
+			w.write(ExecArgTypeData)
+			w.writeSize(uint64(len(data)))
+		}
+		align := int(w.opts.DataAlign)
+		if align == 0 {
+			align = execDefaultDataAlign
+		}
+		if w.opts.Varint {
+			align = 1
 		}
+		padded := (len(data) + align - 1) / align * align
+		w.writeData(data, padded)
 	default:
 		panic("unknown arg type")
 	}
@@ -7,7 +7,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -49,7 +54,7 @@ func TestSerializeForExec(t *testing.T) {
 			"syz_test()",
 			[]uint64{
 				callID("syz_test"), ExecNoCopyout, 0,
-				execInstrEOF,
+				ExecInstrEOF,
 			},
 			&ExecProg{
 				Calls: []ExecCall{
@@ -65,217 +70,230 @@ func TestSerializeForExec(t *testing.T) {
 			"syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)",
 			[]uint64{
 				callID("syz_test$int"), ExecNoCopyout, 5,
-				execArgConst, 8, 1, 0, 0,
-				execArgConst, 1, 2, 0, 0,
-				execArgConst, 2, 3, 0, 0,
-				execArgConst, 4, 4, 0, 0,
-				execArgConst, 8, 5, 0, 0,
-				execInstrEOF,
+				ExecArgTypeConst, 8, 1, 0, 0,
+				ExecArgTypeConst, 1, 2, 0, 0,
+				ExecArgTypeConst, 2, 3, 0, 0,
+				ExecArgTypeConst, 4, 4, 0, 0,
+				ExecArgTypeConst, 8, 5, 0, 0,
+				ExecInstrEOF,
+			},
+			nil,
+		},
+		{
+			"syz_test$opt1(0x0)",
+			[]uint64{
+				callID("syz_test$opt1"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
+			},
+			nil,
+		},
+		{
+			"syz_test$opt1(nil)",
+			[]uint64{
+				callID("syz_test$opt1"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, 0, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$align0(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 2, 1, 0, 0,
-				execInstrCopyin, dataOffset + 4, execArgConst, 4, 2, 0, 0,
-				execInstrCopyin, dataOffset + 8, execArgConst, 1, 3, 0, 0,
-				execInstrCopyin, dataOffset + 10, execArgConst, 2, 4, 0, 0,
-				execInstrCopyin, dataOffset + 16, execArgConst, 8, 5, 0, 0,
-				callID("syz_test$align0"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 2, 1, 0, 0,
+				ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 4, 2, 0, 0,
+				ExecInstrCopyin, dataOffset + 8, ExecArgTypeConst, 1, 3, 0, 0,
+				ExecInstrCopyin, dataOffset + 10, ExecArgTypeConst, 2, 4, 0, 0,
+				ExecInstrCopyin, dataOffset + 16, ExecArgTypeConst, 8, 5, 0, 0,
+				callID("syz_test$align0"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$align1(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 2, 1, 0, 0,
-				execInstrCopyin, dataOffset + 2, execArgConst, 4, 2, 0, 0,
-				execInstrCopyin, dataOffset + 6, execArgConst, 1, 3, 0, 0,
-				execInstrCopyin, dataOffset + 7, execArgConst, 2, 4, 0, 0,
-				execInstrCopyin, dataOffset + 9, execArgConst, 8, 5, 0, 0,
-				callID("syz_test$align1"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 2, 1, 0, 0,
+				ExecInstrCopyin, dataOffset + 2, ExecArgTypeConst, 4, 2, 0, 0,
+				ExecInstrCopyin, dataOffset + 6, ExecArgTypeConst, 1, 3, 0, 0,
+				ExecInstrCopyin, dataOffset + 7, ExecArgTypeConst, 2, 4, 0, 0,
+				ExecInstrCopyin, dataOffset + 9, ExecArgTypeConst, 8, 5, 0, 0,
+				callID("syz_test$align1"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$align2(&(0x7f0000000000)={0x42, {[0x43]}, {[0x44]}})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 1, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 1, execArgConst, 2, 0x43, 0, 0,
-				execInstrCopyin, dataOffset + 4, execArgConst, 2, 0x44, 0, 0,
-				callID("syz_test$align2"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 1, ExecArgTypeConst, 2, 0x43, 0, 0,
+				ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 2, 0x44, 0, 0,
+				callID("syz_test$align2"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$align3(&(0x7f0000000000)={0x42, {0x43}, {0x44}})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 1, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 1, execArgConst, 1, 0x43, 0, 0,
-				execInstrCopyin, dataOffset + 4, execArgConst, 1, 0x44, 0, 0,
-				callID("syz_test$align3"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 1, ExecArgTypeConst, 1, 0x43, 0, 0,
+				ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 1, 0x44, 0, 0,
+				callID("syz_test$align3"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$align4(&(0x7f0000000000)={{0x42, 0x43}, 0x44})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 1, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 1, execArgConst, 2, 0x43, 0, 0,
-				execInstrCopyin, dataOffset + 4, execArgConst, 1, 0x44, 0, 0,
-				callID("syz_test$align4"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 1, ExecArgTypeConst, 2, 0x43, 0, 0,
+				ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 1, 0x44, 0, 0,
+				callID("syz_test$align4"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$align5(&(0x7f0000000000)={{0x42, []}, {0x43, [0x44, 0x45, 0x46]}, 0x47})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 8, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 8, execArgConst, 8, 0x43, 0, 0,
-				execInstrCopyin, dataOffset + 16, execArgConst, 2, 0x44, 0, 0,
-				execInstrCopyin, dataOffset + 18, execArgConst, 2, 0x45, 0, 0,
-				execInstrCopyin, dataOffset + 20, execArgConst, 2, 0x46, 0, 0,
-				execInstrCopyin, dataOffset + 22, execArgConst, 1, 0x47, 0, 0,
-				callID("syz_test$align5"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 8, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 8, ExecArgTypeConst, 8, 0x43, 0, 0,
+				ExecInstrCopyin, dataOffset + 16, ExecArgTypeConst, 2, 0x44, 0, 0,
+				ExecInstrCopyin, dataOffset + 18, ExecArgTypeConst, 2, 0x45, 0, 0,
+				ExecInstrCopyin, dataOffset + 20, ExecArgTypeConst, 2, 0x46, 0, 0,
+				ExecInstrCopyin, dataOffset + 22, ExecArgTypeConst, 1, 0x47, 0, 0,
+				callID("syz_test$align5"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$align6(&(0x7f0000000000)={0x42, [0x43]})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 1, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 4, execArgConst, 4, 0x43, 0, 0,
-				callID("syz_test$align6"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 4, 0x43, 0, 0,
+				callID("syz_test$align6"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$union0(&(0x7f0000000000)={0x1, @f2=0x2})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 8, 1, 0, 0,
-				execInstrCopyin, dataOffset + 8, execArgConst, 1, 2, 0, 0,
-				callID("syz_test$union0"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 8, 1, 0, 0,
+				ExecInstrCopyin, dataOffset + 8, ExecArgTypeConst, 1, 2, 0, 0,
+				callID("syz_test$union0"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$union1(&(0x7f0000000000)={@f1=0x42, 0x43})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 4, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 8, execArgConst, 1, 0x43, 0, 0,
-				callID("syz_test$union1"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 4, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 8, ExecArgTypeConst, 1, 0x43, 0, 0,
+				callID("syz_test$union1"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$union2(&(0x7f0000000000)={@f1=0x42, 0x43})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 4, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 4, execArgConst, 1, 0x43, 0, 0,
-				callID("syz_test$union2"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 4, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 1, 0x43, 0, 0,
+				callID("syz_test$union2"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$array0(&(0x7f0000000000)={0x1, [@f0=0x2, @f1=0x3], 0x4})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 1, 1, 0, 0,
-				execInstrCopyin, dataOffset + 1, execArgConst, 2, 2, 0, 0,
-				execInstrCopyin, dataOffset + 3, execArgConst, 8, 3, 0, 0,
-				execInstrCopyin, dataOffset + 11, execArgConst, 8, 4, 0, 0,
-				callID("syz_test$array0"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 1, 0, 0,
+				ExecInstrCopyin, dataOffset + 1, ExecArgTypeConst, 2, 2, 0, 0,
+				ExecInstrCopyin, dataOffset + 3, ExecArgTypeConst, 8, 3, 0, 0,
+				ExecInstrCopyin, dataOffset + 11, ExecArgTypeConst, 8, 4, 0, 0,
+				callID("syz_test$array0"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 1, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 1, execArgData, 5, 0x0504030201,
-				callID("syz_test$array1"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 1, ExecArgTypeData, 5, 0x0504030201,
+				callID("syz_test$array1"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$array2(&(0x7f0000000000)={0x42, \"aaaaaaaabbbbbbbbccccccccdddddddd\", 0x43})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 2, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 2, execArgData, 16, 0xbbbbbbbbaaaaaaaa, 0xddddddddcccccccc,
-				execInstrCopyin, dataOffset + 18, execArgConst, 2, 0x43, 0, 0,
-				callID("syz_test$array2"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 2, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 2, ExecArgTypeData, 16, 0xbbbbbbbbaaaaaaaa, 0xddddddddcccccccc,
+				ExecInstrCopyin, dataOffset + 18, ExecArgTypeConst, 2, 0x43, 0, 0,
+				callID("syz_test$array2"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$end0(&(0x7f0000000000)={0x42, 0x42, 0x42, 0x42})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 1, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 1, execArgConst, 2, 0x4200, 0, 0,
-				execInstrCopyin, dataOffset + 3, execArgConst, 4, 0x42000000, 0, 0,
-				execInstrCopyin, dataOffset + 7, execArgConst, 8, 0x4200000000000000, 0, 0,
-				callID("syz_test$end0"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 1, ExecArgTypeConst, 2, 0x4200, 0, 0,
+				ExecInstrCopyin, dataOffset + 3, ExecArgTypeConst, 4, 0x42000000, 0, 0,
+				ExecInstrCopyin, dataOffset + 7, ExecArgTypeConst, 8, 0x4200000000000000, 0, 0,
+				callID("syz_test$end0"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$end1(&(0x7f0000000000)={0xe, 0x42, 0x1})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 2, 0x0e00, 0, 0,
-				execInstrCopyin, dataOffset + 2, execArgConst, 4, 0x42000000, 0, 0,
-				execInstrCopyin, dataOffset + 6, execArgConst, 8, 0x0100000000000000, 0, 0,
-				callID("syz_test$end1"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 2, 0x0e00, 0, 0,
+				ExecInstrCopyin, dataOffset + 2, ExecArgTypeConst, 4, 0x42000000, 0, 0,
+				ExecInstrCopyin, dataOffset + 6, ExecArgTypeConst, 8, 0x0100000000000000, 0, 0,
+				callID("syz_test$end1"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$bf0(&(0x7f0000000000)={0x42, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 2, 0x42, 0, 10,
-				execInstrCopyin, dataOffset + 8, execArgConst, 8, 0x42, 0, 0,
-				execInstrCopyin, dataOffset + 16, execArgConst, 2, 0x42, 0, 5,
-				execInstrCopyin, dataOffset + 16, execArgConst, 2, 0x42, 5, 6,
-				execInstrCopyin, dataOffset + 20, execArgConst, 4, 0x42, 0, 15,
-				execInstrCopyin, dataOffset + 24, execArgConst, 2, 0x42, 0, 11,
-				execInstrCopyin, dataOffset + 26, execArgConst, 2, 0x4200, 0, 11,
-				execInstrCopyin, dataOffset + 28, execArgConst, 1, 0x42, 0, 0,
-				callID("syz_test$bf0"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 2, 0x42, 0, 10,
+				ExecInstrCopyin, dataOffset + 8, ExecArgTypeConst, 8, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 16, ExecArgTypeConst, 2, 0x2<<5 | 0x2, 0, 0,
+				ExecInstrCopyin, dataOffset + 20, ExecArgTypeConst, 4, 0x42, 0, 15,
+				ExecInstrCopyin, dataOffset + 24, ExecArgTypeConst, 2, 0x42, 0, 11,
+				ExecInstrCopyin, dataOffset + 26, ExecArgTypeConst, 2, 0x4200, 0, 11,
+				ExecInstrCopyin, dataOffset + 28, ExecArgTypeConst, 1, 0x42, 0, 0,
+				callID("syz_test$bf0"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$bf1(&(0x7f0000000000)={{0x42, 0x42, 0x42}, 0x42})",
 			[]uint64{
-				execInstrCopyin, dataOffset + 0, execArgConst, 4, 0x42, 0, 10,
-				execInstrCopyin, dataOffset + 0, execArgConst, 4, 0x42, 10, 10,
-				execInstrCopyin, dataOffset + 0, execArgConst, 4, 0x42, 20, 10,
-				execInstrCopyin, dataOffset + 4, execArgConst, 1, 0x42, 0, 0,
-				callID("syz_test$bf1"), ExecNoCopyout, 1, execArgConst, ptrSize, dataOffset, 0, 0,
-				execInstrEOF,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 4, 0x42<<20 | 0x42<<10 | 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 1, 0x42, 0, 0,
+				callID("syz_test$bf1"), ExecNoCopyout, 1, ExecArgTypeConst, ptrSize, dataOffset, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
 		{
 			"syz_test$res1(0xffff)",
 			[]uint64{
-				callID("syz_test$res1"), ExecNoCopyout, 1, execArgConst, 4, 0xffff, 0, 0,
-				execInstrEOF,
+				callID("syz_test$res1"), ExecNoCopyout, 1, ExecArgTypeConst, 4, 0xffff, 0, 0,
+				ExecInstrEOF,
 			},
 			nil,
 		},
@@ -315,3 +333,3036 @@ func TestSerializeForExec(t *testing.T) {
 		})
 	}
 }
+
+// parseProg deserializes a test program and fails the test on error.
+func parseProg(t *testing.T, target *Target, text string) *Prog {
+	t.Helper()
+	p, err := target.Deserialize([]byte(text))
+	if err != nil {
+		t.Fatalf("failed to deserialize %q: %v", text, err)
+	}
+	return p
+}
+
+// serializeForExec serializes p into a fresh buffer and fails the test on error.
+func serializeForExec(t *testing.T, p *Prog, opts ExecOpts) []byte {
+	t.Helper()
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExecOpts(buf, 0, opts)
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+	return buf[:n]
+}
+
+// serializeAndDecode serializes p and decodes the result back.
+func serializeAndDecode(t *testing.T, p *Prog, opts ExecOpts) (ExecProg, []byte) {
+	t.Helper()
+	data := serializeForExec(t, p, opts)
+	decoded, err := p.Target.DeserializeExec(data)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	return decoded, data
+}
+
+// checkExecWords checks that data consists of exactly the little-endian words want.
+func checkExecWords(t *testing.T, data []byte, want []uint64) {
+	t.Helper()
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.LittleEndian, want)
+	if !bytes.Equal(data, w.Bytes()) {
+		got := make([]uint64, len(data)/8)
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &got)
+		t.Fatalf("mismatch\nwant: %v\ngot:  %v", want, got)
+	}
+}
+
+// checkExecEncoding checks that data is re-encoded and assembled back from its
+// disassembly without changes, and returns the disassembly.
+func checkExecEncoding(t *testing.T, target *Target, data []byte) string {
+	t.Helper()
+	if err := target.checkExecRoundTrip(data); err != nil {
+		t.Fatal(err)
+	}
+	text, err := target.DisassembleExec(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec, err := target.AssembleExec(text); err != nil || !bytes.Equal(exec, data) {
+		t.Fatalf("assembly round trip failed: %v\n%v", err, text)
+	}
+	return text
+}
+
+// execWords encodes words as a little-endian exec program.
+func execWords(words ...uint64) []byte {
+	data := make([]byte, 8*len(words))
+	for i, v := range words {
+		binary.LittleEndian.PutUint64(data[i*8:], v)
+	}
+	return data
+}
+
+// checkBadExec checks that none of the word sequences is decoded successfully.
+func checkBadExec(t *testing.T, target *Target, progs [][]uint64) {
+	t.Helper()
+	for _, words := range progs {
+		if _, err := target.DeserializeExec(execWords(words...)); err == nil {
+			t.Errorf("no error for bad program %x", words)
+		}
+	}
+}
+
+func TestExecFormatConstants(t *testing.T) {
+	want := map[string]uint64{
+		"ExecInstrEOF":              0xffffffffffffffff,
+		"ExecInstrCopyin":           0xfffffffffffffffe,
+		"ExecInstrCopyout":          0xfffffffffffffffd,
+		"ExecInstrBatchSep":         0xfffffffffffffffc,
+		"ExecInstrRepeat":           0xfffffffffffffffb,
+		"ExecInstrCopyinFill":       0xfffffffffffffffa,
+		"ExecInstrUnionOption":      0xfffffffffffffff9,
+		"ExecInstrDataAlign":        0xfffffffffffffff8,
+		"ExecInstrExpectReturn":     0xfffffffffffffff7,
+		"ExecInstrProgID":           0xfffffffffffffff6,
+		"ExecInstrSizeWidth":        0xfffffffffffffff5,
+		"ExecInstrReset":            0xfffffffffffffff4,
+		"ExecInstrNop":              0xfffffffffffffff3,
+		"ExecInstrCallHash":         0xfffffffffffffff2,
+		"ExecInstrHeader":           0xfffffffffffffff1,
+		"ExecInstrCallTimeout":      0xfffffffffffffff0,
+		"ExecInstrAsync":            0xffffffffffffffef,
+		"ExecInstrFailNth":          0xffffffffffffffee,
+		"ExecInstrCopyoutData":      0xffffffffffffffed,
+		"ExecInstrCallProps":        0xffffffffffffffec,
+		"ExecCallPropCollideGroup":  0,
+		"ExecCallPropSandbox":       1,
+		"ExecCallPropRerun":         2,
+		"ExecSandboxNone":           1,
+		"ExecSandboxSetuid":         2,
+		"ExecSandboxNamespace":      3,
+		"ExecFormatMagic":           0x53595a45,
+		"ExecFormatVersion":         1,
+		"ExecFlagArgByteOrder":      1,
+		"ExecFlagRelativePointers":  2,
+		"ExecFlagTypeIDs":           4,
+		"ExecFlagSyscallNR":         8,
+		"ExecFlagBigEndian":         16,
+		"ExecFlagCopyoutOnSuccess":  32,
+		"ExecFlagVarint":            64,
+		"ExecCopyoutFlagOnSuccess":  1 << 15,
+		"ExecArgTypeConst":          0,
+		"ExecArgTypeResult":         1,
+		"ExecArgTypeData":           2,
+		"ExecArgTypeCsum":           3,
+		"ExecArgTypeArgBlock":       4,
+		"ExecArgTypeDataCompressed": 5,
+		"ExecArgCsumInet":           0,
+		"ExecArgCsumCrc32":          1,
+		"ExecArgCsumChunkData":      0,
+		"ExecArgCsumChunkConst":     1,
+		"ExecArgFlagBigEndian":      1 << 15,
+		"ExecArgFlagPointer":        1 << 14,
+		"ExecNoCopyout":             0xffffffffffffffff,
+	}
+	got := ExecFormatConstants()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad exec format constants:\ngot:  %v\nwant: %v", got, want)
+	}
+	for name, v := range got {
+		if strings.HasPrefix(name, "ExecInstr") && v < execInstrMin {
+			t.Errorf("%v is smaller than execInstrMin", name)
+		}
+	}
+}
+
+func TestSerializeBatchForExec(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	var progs []*Prog
+	for i := 0; i < 2; i++ {
+		p := parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res1(r0)\n")
+		progs = append(progs, p)
+	}
+	buf := make([]byte, ExecBufferSize)
+	n, err := SerializeBatchForExec(buf, progs, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res0 := uint64(target.SyscallMap["syz_test$res0"].ID)
+	res1 := uint64(target.SyscallMap["syz_test$res1"].ID)
+	want := []uint64{
+		res0, 0, 0,
+		res1, ExecNoCopyout, 1, ExecArgTypeResult, 4, 0, 0, 0,
+		ExecInstrBatchSep,
+		res0, 0, 0,
+		res1, ExecNoCopyout, 1, ExecArgTypeResult, 4, 0, 0, 0,
+		ExecInstrBatchSep,
+		ExecInstrEOF,
+	}
+	checkExecWords(t, buf[:n], want)
+	decoded, err := target.DeserializeBatchExec(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(progs) {
+		t.Fatalf("decoded %v programs, want %v", len(decoded), len(progs))
+	}
+	for i, p := range decoded {
+		if len(p.Calls) != 2 || p.Calls[0].Index != 0 || p.NumVars != 1 {
+			t.Fatalf("bad decoded program %v: %+v", i, p)
+		}
+	}
+	if _, err := target.DeserializeExec(buf[:n]); err == nil {
+		t.Fatalf("non-batch decoding of a batch succeeded")
+	}
+}
+
+func TestExecProgramWriteTo(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		n, err := p.SerializeForExec(buf, i%16)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		out := new(bytes.Buffer)
+		n1, err := (&ExecProgram{Prog: p, Pid: i % 16}).WriteTo(out)
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		if n1 != int64(n) || !bytes.Equal(buf[:n], out.Bytes()) {
+			t.Fatalf("streamed program differs from serialized: %v/%v bytes\n%s",
+				n1, n, p.Serialize())
+		}
+	}
+}
+
+func TestWriteExec(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$hint_data(&(0x7f0000000000)=\"00\")\n"+
+		"syz_test$hint_data(&(0x7f0000100000)=\"00\")")
+	// The program does not fit into ExecBufferSize.
+	data := bytes.Repeat([]byte{1, 2}, ExecMaxBlobLen/2)
+	for _, c := range p.Calls {
+		c.Args[0].(*PointerArg).Res.(*DataArg).data = data
+	}
+	if _, err := p.SerializeForExec(make([]byte, ExecBufferSize), 0); err == nil {
+		t.Fatalf("program fits into ExecBufferSize")
+	}
+	buf := make([]byte, 2*ExecBufferSize)
+	n, err := p.SerializeForExec(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := p.WriteExec(out, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], out.Bytes()) {
+		t.Fatalf("streamed program differs from serialized: %v/%v bytes", out.Len(), n)
+	}
+}
+
+func TestSerializeForExecCompressData(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$hint_data(&(0x7f0000000000)=\"00\")\n"+
+		"syz_test$array1(&(0x7f0000100000)={0x42, \"0102030405\"})")
+	data := bytes.Repeat([]byte{1, 2, 3}, 10<<10)
+	p.Calls[0].Args[0].(*PointerArg).Res.(*DataArg).data = data
+	decoded, exec := serializeAndDecode(t, p, ExecOpts{CompressData: true})
+	if n, n1 := len(exec), len(serializeForExec(t, p, ExecOpts{})); n >= n1/10 {
+		t.Fatalf("compressed program has %v bytes, uncompressed %v", n, n1)
+	}
+	big := decoded.Calls[0].Copyin[0].Arg.(ExecArgData)
+	if !bytes.Equal(big.Data, data) || big.Compressed == nil {
+		t.Fatalf("large data arg is not compressed or decompressed incorrectly")
+	}
+	// Small data args are not compressed.
+	small := decoded.Calls[1].Copyin[1].Arg.(ExecArgData)
+	if !bytes.Equal(small.Data, []byte{1, 2, 3, 4, 5}) || small.Compressed != nil {
+		t.Fatalf("bad small data arg %+v", small)
+	}
+	checkExecEncoding(t, target, exec)
+	// The declared size must match the decompressed data.
+	binary.LittleEndian.PutUint64(exec[32:], uint64(len(data)+1))
+	if _, err := target.DeserializeExec(exec); err == nil {
+		t.Fatalf("no error for wrong uncompressed size")
+	}
+}
+
+func TestSerializeAndHashForExec(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	buf1 := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		n, hash, err := p.SerializeAndHashForExec(buf, i%16)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		n1, err := p.SerializeForExec(buf1, i%16)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		if !bytes.Equal(buf[:n], buf1[:n1]) {
+			t.Fatalf("program differs from SerializeForExec")
+		}
+		h := fnv.New64a()
+		h.Write(buf[:n])
+		if hash != h.Sum64() {
+			t.Fatalf("hash 0x%x, want 0x%x", hash, h.Sum64())
+		}
+	}
+}
+
+func TestSerializeForExecDataOffset(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$align0(&(0x7f0000001000)={0x1, 0x2, 0x3, 0x4, 0x5})")
+	for _, dataOffset := range []uint64{target.DataOffset, 0x10000000, 0x7f0000000000} {
+		decoded, _ := serializeAndDecode(t, p, ExecOpts{DataOffset: dataOffset})
+		call := decoded.Calls[0]
+		addr := dataOffset + target.PageSize
+		if val := call.Args[0].(ExecArgConst).Value; val != addr {
+			t.Errorf("data offset 0x%x: pointer value 0x%x, want 0x%x", dataOffset, val, addr)
+		}
+		if copyin := call.Copyin[0].Addr; copyin != addr {
+			t.Errorf("data offset 0x%x: copyin address 0x%x, want 0x%x", dataOffset, copyin, addr)
+		}
+	}
+}
+
+func TestSerializeForExecArgByteOrder(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$end0(&(0x7f0000000000)={0x42, 0x42, 0x42, 0x42})")
+	type arg struct {
+		size uint64
+		val  uint64
+	}
+	tests := []struct {
+		opts ExecOpts
+		args []arg
+	}{
+		{
+			ExecOpts{},
+			[]arg{{1, 0x42}, {2, 0x4200}, {4, 0x42000000}, {8, 0x4200000000000000}},
+		},
+		{
+			ExecOpts{ArgByteOrder: true},
+			[]arg{
+				{1, 0x42},
+				{2 | ExecArgFlagBigEndian, 0x42},
+				{4 | ExecArgFlagBigEndian, 0x42},
+				{8 | ExecArgFlagBigEndian, 0x42},
+			},
+		},
+	}
+	for i, test := range tests {
+		decoded, _ := serializeAndDecode(t, p, test.opts)
+		copyin := decoded.Calls[0].Copyin
+		if len(copyin) != len(test.args) {
+			t.Fatalf("test #%v: got %v copyins, want %v", i, len(copyin), len(test.args))
+		}
+		for j, want := range test.args {
+			got := copyin[j].Arg.(ExecArgConst)
+			if got.Size != want.size || got.Value != want.val {
+				t.Errorf("test #%v: copyin #%v: size 0x%x value 0x%x, want size 0x%x value 0x%x",
+					i, j, got.Size, got.Value, want.size, want.val)
+			}
+		}
+	}
+}
+
+func TestSerializeForExecOverflow(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$hint_data(&(0x7f0000000000)=\"00\")\nsyz_test$res0()\n")
+	data := make([]byte, 4<<10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	p.Calls[0].Args[0].(*PointerArg).Res.(*DataArg).data = data
+	size, err := p.ExecByteSize(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bufSize := range []int{0, 64, 1 << 10, size - 8, size - 1} {
+		_, err := p.SerializeForExec(make([]byte, bufSize), 0)
+		tooSmall, ok := err.(*ExecBufferTooSmallError)
+		if !ok {
+			t.Fatalf("buffer size %v: got error %v, want *ExecBufferTooSmallError", bufSize, err)
+		}
+		if tooSmall.Size != size {
+			t.Fatalf("buffer size %v: got required size %v, want %v", bufSize, tooSmall.Size, size)
+		}
+	}
+	n, err := p.SerializeForExec(make([]byte, size), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != size {
+		t.Fatalf("serialized %v bytes, ExecByteSize returned %v", n, size)
+	}
+}
+
+func TestSerializeForExecRepeat(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res1(r0)\n")
+	p.Calls[0].Repeat = 100
+	res0 := uint64(target.SyscallMap["syz_test$res0"].ID)
+	res1 := uint64(target.SyscallMap["syz_test$res1"].ID)
+	tests := []struct {
+		opts ExecOpts
+		want []uint64
+	}{
+		{
+			ExecOpts{},
+			[]uint64{
+				res0, 0, 0,
+				res1, ExecNoCopyout, 1, ExecArgTypeResult, 4, 0, 0, 0,
+				ExecInstrEOF,
+			},
+		},
+		{
+			ExecOpts{RepeatCalls: true},
+			[]uint64{
+				ExecInstrRepeat, 100,
+				res0, 0, 0,
+				res1, ExecNoCopyout, 1, ExecArgTypeResult, 4, 0, 0, 0,
+				ExecInstrEOF,
+			},
+		},
+	}
+	for i, test := range tests {
+		decoded, exec := serializeAndDecode(t, p, test.opts)
+		checkExecWords(t, exec, test.want)
+		repeat := uint64(0)
+		if test.opts.RepeatCalls {
+			repeat = 100
+		}
+		if len(decoded.Calls) != 2 || decoded.Calls[0].Repeat != repeat || decoded.Calls[1].Repeat != 0 {
+			t.Fatalf("test #%v: bad decoded program: %+v", i, decoded)
+		}
+	}
+}
+
+func TestSerializeForExecErrors(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	setData := func(size uint64) func(p *Prog) {
+		return func(p *Prog) {
+			foreachArg(p.Calls[0], func(arg, _ Arg, _ *[]Arg) {
+				if a, ok := arg.(*DataArg); ok {
+					a.data = make([]byte, size)
+				}
+			})
+		}
+	}
+	setOps := func(div, add uint64) func(p *Prog) {
+		return func(p *Prog) {
+			res := p.Calls[1].Args[0].(*ResultArg)
+			res.OpDiv, res.OpAdd = div, add
+		}
+	}
+	array1 := "syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})"
+	array2 := "syz_test$array2(&(0x7f0000000000)={0x42, \"aaaaaaaabbbbbbbbccccccccdddddddd\", 0x43})"
+	res := "r0 = syz_test$res0()\nsyz_test$res1(r0)\n"
+	tests := []struct {
+		prog   string
+		mutate func(p *Prog)
+		opts   ExecOpts
+		err    string // part of the expected error, empty if serialization must succeed
+	}{
+		// Programs created for a target with a larger data region.
+		{
+			prog: "syz_test$align0(&(0x7f0000fff000)={0x1, 0x2, 0x3, 0x4, 0x5})",
+		},
+		{
+			prog: "syz_test$align0(&(0x7f0001000000)={0x1, 0x2, 0x3, 0x4, 0x5})",
+			err:  "syscall syz_test$align0: arg 0: pointer arg",
+		},
+		{
+			prog: "mmap(&(0x7f0000ffe000/0x3000)=nil, 0x3000)",
+			err:  "syscall mmap: arg 0: pointer arg",
+		},
+		{
+			prog:   "syz_test$hint_data(&(0x7f0000000000)=\"00\")",
+			mutate: setData(target.NumPages*target.PageSize + 1),
+			err:    "syscall syz_test$hint_data: arg 0: data arg",
+		},
+		// Data args that don't match the size of their type.
+		{prog: array2, mutate: setData(16)},
+		{prog: array2, mutate: setData(17), err: "data arg array has wrong size"},
+		{prog: array2, mutate: setData(15), err: "data arg array has wrong size"},
+		{prog: array1, mutate: setData(4)},
+		{prog: array1, mutate: setData(8)},
+		{prog: array1, mutate: setData(3), err: "data arg array has wrong size"},
+		{prog: array1, mutate: setData(9), err: "data arg array has wrong size"},
+		// Calls with a missing or an extra argument.
+		{
+			prog: "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)",
+			mutate: func(p *Prog) {
+				c := p.Calls[0]
+				c.Args = c.Args[:len(c.Args)-1]
+			},
+			err: "wrong number of arguments",
+		},
+		{
+			prog: "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)",
+			mutate: func(p *Prog) {
+				c := p.Calls[0]
+				c.Args = append(c.Args, MakeConstArg(c.Meta.Args[4], 6))
+			},
+			err: "wrong number of arguments",
+		},
+		// Result ops of the 4-byte result arg, large addends wrap around.
+		{prog: res, mutate: setOps(0, 0)},
+		{prog: res, mutate: setOps(2, 1)},
+		{prog: res, mutate: setOps(0, 0xffffffff)},
+		{prog: res, mutate: setOps(0, 1<<32)},
+		{prog: res, mutate: setOps(0, ^uint64(0))},
+		{prog: res, mutate: setOps(1<<40, 0), err: "doesn't fit into 4 bytes"},
+		// A forward result reference.
+		{
+			prog: res,
+			mutate: func(p *Prog) {
+				p.Calls[0], p.Calls[1] = p.Calls[1], p.Calls[0]
+			},
+			err: "references result of a later call",
+		},
+		// Results that are not produced by any call are rejected only in strict mode.
+		{
+			prog: res,
+			opts: ExecOpts{StrictResults: true},
+		},
+		{
+			prog: "syz_test$res0()\nsyz_test$res1(0xffff)\n",
+		},
+		{
+			prog: "syz_test$res0()\nsyz_test$res1(0xffff)\n",
+			opts: ExecOpts{StrictResults: true},
+			err:  "does not reference a result",
+		},
+	}
+	buf := make([]byte, ExecBufferSize)
+	for i, test := range tests {
+		p := parseProg(t, target, test.prog)
+		if test.mutate != nil {
+			test.mutate(p)
+		}
+		_, err := p.SerializeForExecOpts(buf, 0, test.opts)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("test #%v: serialization failed: %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("test #%v: got error %v, want %q", i, err, test.err)
+		}
+	}
+}
+
+func TestSerializeForExecResultAdd(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res1(r0)\n")
+	res := p.Calls[1].Args[0].(*ResultArg)
+	// Executor truncates the 4-byte result, so the addend is emitted truncated as well.
+	for _, add := range []uint64{1, 1<<32 + 1, ^uint64(0)} {
+		res.OpAdd = add
+		decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+		want := ExecArgResult{Size: 4, Index: 0, AddOp: add & 0xffffffff}
+		if got := decoded.Calls[1].Args[0]; !reflect.DeepEqual(got, want) {
+			t.Errorf("add 0x%x: got %+v, want %+v", add, got, want)
+		}
+	}
+	res.OpDiv = 1 << 40
+	if errs := p.ValidateForExec(0); len(errs) != 1 || !strings.Contains(errs[0].Error(), "divisor") {
+		t.Fatalf("want divisor error, got %v", errs)
+	}
+}
+
+func TestExecContextReset(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	fresh := make([]byte, ExecBufferSize)
+	w := newExecContext(target, buf, ExecOpts{})
+	for i := 0; i < iters; i++ {
+		pa := target.Generate(rs, 10, nil)
+		pb := target.Generate(rs, 10, nil)
+		w.reset(target, buf, ExecOpts{})
+		if err := w.serializeProg(pa, i); err != nil {
+			t.Fatal(err)
+		}
+		// Serialize B into a short buffer to leave the context in overflow state.
+		w.reset(target, buf[:8], ExecOpts{})
+		if err := w.serializeProg(pb, i); err != nil {
+			t.Fatal(err)
+		}
+		w.reset(target, buf, ExecOpts{})
+		if err := w.serializeProg(pb, i); err != nil {
+			t.Fatal(err)
+		}
+		w.writeEOF()
+		if w.eof {
+			t.Fatalf("buffer overflow after reset")
+		}
+		n, err := pb.SerializeForExec(fresh, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf[:len(buf)-len(w.buf)]; !bytes.Equal(got, fresh[:n]) {
+			t.Fatalf("serialization after reset differs from fresh serialization:\n%s", pb.Serialize())
+		}
+	}
+}
+
+func TestSerializeForExecCopyinFill(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$hint_data(&(0x7f0000000000)=\"00\")")
+	data := p.Calls[0].Args[0].(*PointerArg).Res.(*DataArg)
+	data.data = make([]byte, 1<<20)
+	want := []uint64{
+		ExecInstrCopyinFill, target.DataOffset, 1 << 20, 0,
+		uint64(target.SyscallMap["syz_test$hint_data"].ID), ExecNoCopyout, 1, ExecArgTypeConst, 8, target.DataOffset, 0, 0,
+		ExecInstrEOF,
+	}
+	decoded, exec := serializeAndDecode(t, p, ExecOpts{})
+	checkExecWords(t, exec, want)
+	if fill := decoded.Calls[0].Copyin[0].Arg; fill != (ExecArgFill{Size: 1 << 20, Value: 0}) {
+		t.Fatalf("bad decoded copyin: %+v", fill)
+	}
+	// Non-uniform data must be copied as is.
+	data.data[len(data.data)-1] = 1
+	decoded, _ = serializeAndDecode(t, p, ExecOpts{})
+	if copyin, ok := decoded.Calls[0].Copyin[0].Arg.(ExecArgData); !ok || !bytes.Equal(copyin.Data, data.data) {
+		t.Fatalf("bad decoded copyin: %T", decoded.Calls[0].Copyin[0].Arg)
+	}
+}
+
+func TestSerializeForExecInPlaceResult(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\n"+
+		"syz_test$res2(&(0x7f0000000000)=<r1=>r0, r1)\n")
+	buf := make([]byte, ExecBufferSize)
+	if _, err := p.SerializeForExec(buf, 0); err != nil {
+		t.Fatalf("failed to serialize in-place result reference: %v", err)
+	}
+	// Make the in-place result reference itself.
+	res := p.Calls[1].Args[1].(*ResultArg)
+	delete(*res.Res.(ArgUsed).Used(), res)
+	res.Res = res
+	res.uses = map[Arg]bool{res: true}
+	if _, err := p.SerializeForExec(buf, 0); err == nil ||
+		!strings.Contains(err.Error(), "references itself") {
+		t.Fatalf("want self-reference error, got %v", err)
+	}
+	if errs := p.ValidateForExec(0); len(errs) == 0 || !strings.Contains(errs[0].Error(), "references itself") {
+		t.Fatalf("want self-reference error, got %v", errs)
+	}
+}
+
+func TestSerializeForExecCopyoutPadded(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	// The result is preceded by a bitfield storage unit with padding
+	// and followed by trailing padding of the struct.
+	p := parseProg(t, target, "syz_test$res3(&(0x7f0000000000)={0x0, <r0=>0x0, 0x0})\n"+
+		"syz_test$res1(r0)\n")
+	decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+	copyouts := decoded.Calls[0].Copyout
+	if len(copyouts) != 1 {
+		t.Fatalf("got %v copyouts, want 1", len(copyouts))
+	}
+	want := ExecCopyout{Index: 0, Addr: target.DataOffset + 4, Size: 4}
+	if copyouts[0] != want {
+		t.Fatalf("got copyout %+v, want %+v", copyouts[0], want)
+	}
+	// The copyout covers the whole storage unit of the result and nothing else.
+	var res Arg
+	for _, inner := range p.Calls[0].Args[0].(*PointerArg).Res.(*GroupArg).Inner {
+		if _, ok := inner.(*ResultArg); ok {
+			res = inner
+		}
+	}
+	if copyouts[0].Size != res.Type().Size() {
+		t.Fatalf("copyout size %v, result storage unit size %v", copyouts[0].Size, res.Type().Size())
+	}
+	if end := copyouts[0].Addr + copyouts[0].Size; end != target.DataOffset+8 {
+		t.Fatalf("copyout ends at 0x%x, next field starts at 0x%x", end, target.DataOffset+8)
+	}
+}
+
+func TestSerializeForExecCsumSameAddr(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	// Two csum args of different size at the same address.
+	// They are emitted in the reverse order of appearance in the call.
+	prog := "syz_test$csum_alias(&(0x7f0000000000)={0x0, 0x1, 0x2}, " +
+		"&(0x7f0000000000)={0x0, 0x1, 0x2, [{0x7, 0x4, \"0102\"}]})"
+	var first []byte
+	for i := 0; i < 100; i++ {
+		p := parseProg(t, target, prog)
+		decoded, exec := serializeAndDecode(t, p, ExecOpts{})
+		if first == nil {
+			first = exec
+			var sizes []uint64
+			for _, copyin := range decoded.Calls[0].Copyin {
+				if csum, ok := copyin.Arg.(ExecArgCsum); ok {
+					if copyin.Addr != target.DataOffset {
+						t.Fatalf("csum at 0x%x, want 0x%x", copyin.Addr, target.DataOffset)
+					}
+					sizes = append(sizes, csum.Chunks[0].Size)
+				}
+			}
+			if want := []uint64{14, 10}; !reflect.DeepEqual(sizes, want) {
+				t.Fatalf("csum chunk sizes %v, want %v", sizes, want)
+			}
+		} else if !bytes.Equal(first, exec) {
+
+			t.Fatalf("serialization differs on run %v", i)
+		}
+	}
+}
+
+func TestSerializeForExecTypeIDs(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$end0(&(0x7f0000000000)={0x42, 0x42, 0x42, 0x42})")
+	meta := target.SyscallMap["syz_test$end0"]
+	ptr := meta.Args[0].(*PtrType)
+	fields := ptr.Type.(*StructType).Fields
+	dataOffset := target.DataOffset
+	want := []uint64{
+		ExecInstrCopyin, dataOffset + 0, target.TypeID(fields[0]), ExecArgTypeConst, 1, 0x42, 0, 0,
+		ExecInstrCopyin, dataOffset + 1, target.TypeID(fields[1]), ExecArgTypeConst, 2, 0x4200, 0, 0,
+		ExecInstrCopyin, dataOffset + 3, target.TypeID(fields[2]), ExecArgTypeConst, 4, 0x42000000, 0, 0,
+		ExecInstrCopyin, dataOffset + 7, target.TypeID(fields[3]), ExecArgTypeConst, 8, 0x4200000000000000, 0, 0,
+		uint64(meta.ID), ExecNoCopyout, 1, target.TypeID(ptr), ExecArgTypeConst, 8, dataOffset, 0, 0,
+		ExecInstrEOF,
+	}
+	ids := make(map[uint64]bool)
+	for _, typ := range append([]Type{ptr}, fields...) {
+		ids[target.TypeID(typ)] = true
+	}
+	if len(ids) != 5 {
+		t.Fatalf("types have duplicate IDs: %v", ids)
+	}
+	data := serializeForExec(t, p, ExecOpts{EmitTypeIDs: true})
+	checkExecWords(t, data, want)
+}
+
+func TestSerializeSetupForExec(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	dataOffset := target.DataOffset
+	tests := []struct {
+		prog string
+		want []uint64
+	}{
+		{
+			"syz_test$end0(&(0x7f0000000000)={0x42, 0x42, 0x42, 0x42})",
+			[]uint64{
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+				ExecInstrCopyin, dataOffset + 1, ExecArgTypeConst, 2, 0x4200, 0, 0,
+				ExecInstrCopyin, dataOffset + 3, ExecArgTypeConst, 4, 0x42000000, 0, 0,
+				ExecInstrCopyin, dataOffset + 7, ExecArgTypeConst, 8, 0x4200000000000000, 0, 0,
+				ExecInstrEOF,
+			},
+		},
+		{
+			"syz_test$csum_ipv4(&(0x7f0000000000)={0x0, 0x1, 0x2})",
+			[]uint64{
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 2, 0, 0, 0,
+				ExecInstrCopyin, dataOffset + 2, ExecArgTypeConst, 4, 0x01000000, 0, 0,
+				ExecInstrCopyin, dataOffset + 6, ExecArgTypeConst, 4, 0x02000000, 0, 0,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeCsum, 2, ExecArgCsumInet, 1,
+				ExecArgCsumChunkData, dataOffset + 0, 10,
+				ExecInstrEOF,
+			},
+		},
+		{
+			"r0 = syz_test$res0()\nsyz_test$res1(r0)\n",
+			[]uint64{
+				ExecInstrEOF,
+			},
+		},
+	}
+	buf := make([]byte, ExecBufferSize)
+	for i, test := range tests {
+		p := parseProg(t, target, test.prog)
+		n, err := p.SerializeSetupForExec(buf, 0)
+		if err != nil {
+			t.Fatalf("failed to serialize prog %v: %v", i, err)
+		}
+		checkExecWords(t, buf[:n], test.want)
+		_, err = p.SerializeSetupForExec(buf[:n-1], 0)
+		if tooSmall, ok := err.(*ExecBufferTooSmallError); !ok || tooSmall.Size != n {
+			t.Fatalf("prog %v: want ExecBufferTooSmallError with size %v, got %v", i, n, err)
+		}
+	}
+}
+
+func TestPhysicalAddrOverflow(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$opt1(&(0x7f0000001000)=0x0)")
+	ptr := p.Calls[0].Args[0].(*PointerArg)
+	if addr, err := target.physicalAddr(ptr, target.DataOffset); err != nil || addr != target.DataOffset+target.PageSize {
+		t.Fatalf("bad address 0x%x: %v", addr, err)
+	}
+	tests := []struct {
+		pageIndex  uint64
+		pageOffset int
+		dataOffset uint64
+	}{
+		{math.MaxUint64, 0, target.DataOffset},
+		{math.MaxUint64 / target.PageSize, 0, target.DataOffset},
+		{math.MaxUint64/target.PageSize + 1, 0, 0},
+		{0, math.MaxInt64, target.DataOffset},
+		{0, math.MinInt64, target.DataOffset},
+		{0, -int(target.PageSize) - 1, 0},
+		{0, 0, math.MaxUint64 - target.PageSize},
+	}
+	buf := make([]byte, ExecBufferSize)
+	for i, test := range tests {
+		ptr.PageIndex = test.pageIndex
+		ptr.PageOffset = test.pageOffset
+		if addr, err := target.physicalAddr(ptr, test.dataOffset); err == nil {
+			t.Errorf("test #%v: got address 0x%x, want an error", i, addr)
+		}
+		if test.dataOffset == 0 {
+			continue // means default data offset in ExecOpts
+		}
+		opts := ExecOpts{DataOffset: test.dataOffset}
+		if _, err := p.SerializeForExecOpts(buf, 0, opts); err == nil {
+			t.Errorf("test #%v: serialization succeeded", i)
+		}
+	}
+}
+
+func TestSerializeForExecStrictArena(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})")
+	ptr := p.Calls[0].Args[0].(*PointerArg)
+	buf := make([]byte, ExecBufferSize)
+	opts := ExecOpts{StrictArena: true}
+	if _, err := p.SerializeForExecOpts(buf, 0, opts); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pageIndex  uint64
+		pageOffset int
+		err        string
+	}{
+		// The struct starts 2 bytes below the data region.
+		{0, -int(target.PageSize) - 2, "copyin of int8 to [0x63ffffe, +1)"},
+		// The data array crosses the end of the data region.
+		{target.NumPages - 1, int(target.PageSize) - 3, "copyin of array to [0x" +
+			strconv.FormatUint(target.DataOffset+target.NumPages*target.PageSize-2, 16) + ", +5)"},
+	}
+	for i, test := range tests {
+		ptr.PageIndex = test.pageIndex
+		ptr.PageOffset = test.pageOffset
+		// Such programs are fine by default, executor tolerates faults on copyins.
+		if _, err := p.SerializeForExec(buf, 0); err != nil {
+			t.Fatalf("test #%v: %v", i, err)
+		}
+		_, err := p.SerializeForExecOpts(buf, 0, opts)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("test #%v: got error %v, want %q", i, err, test.err)
+		}
+	}
+}
+
+func TestSerializeForExecDeadCopyout(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res0()\nr1 = syz_test$res0()\nsyz_test$res1(r0)\nsyz_test$res1(r1)\n")
+	// Drop the consumer of r0 without updating uses, as a careless minimization would do.
+	// Such program does not pass debug validation.
+	p.Calls = append(p.Calls[:3], p.Calls[4])
+	defer overrideDebug(false)()
+	data := serializeForExec(t, p, ExecOpts{})
+	res0 := uint64(target.SyscallMap["syz_test$res0"].ID)
+	res1 := uint64(target.SyscallMap["syz_test$res1"].ID)
+	want := []uint64{
+		res0, ExecNoCopyout, 0,
+		res0, ExecNoCopyout, 0,
+		res0, 0, 0,
+		res1, ExecNoCopyout, 1, ExecArgTypeResult, 4, 0, 0, 0,
+		ExecInstrEOF,
+	}
+	checkExecWords(t, data, want)
+}
+
+func TestSerializeForExecOnInstr(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\n"+
+		"syz_test$end0(&(0x7f0000000000)={0x42, 0x42, 0x42, 0x42})\n"+
+		"syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})\n"+
+		"syz_test$res1(r0)\n")
+	var kinds []uint64
+	var words []uint64
+	opts := ExecOpts{
+		OnInstr: func(kind uint64, instr []uint64) {
+			kinds = append(kinds, kind)
+			words = append(words, instr...)
+			// Must not affect the serialized program.
+			for i := range instr {
+				instr[i] = 0
+			}
+		},
+	}
+	data := serializeForExec(t, p, opts)
+	call := func(name string) uint64 {
+		return uint64(target.SyscallMap[name].ID)
+	}
+	wantKinds := []uint64{
+		call("syz_test$res0"),
+		ExecInstrCopyin, ExecInstrCopyin, ExecInstrCopyin, ExecInstrCopyin,
+		call("syz_test$end0"),
+		ExecInstrCopyin, ExecInstrCopyin,
+		call("syz_test$array1"),
+		call("syz_test$res1"),
+		ExecInstrEOF,
+	}
+	if !reflect.DeepEqual(kinds, wantKinds) {
+		t.Fatalf("bad instructions\ngot:  %v\nwant: %v", kinds, wantKinds)
+	}
+	got := make([]uint64, len(data)/8)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &got)
+	if !reflect.DeepEqual(words, got) {
+		t.Fatalf("instruction words don't match the program\ngot:  %v\nwant: %v", words, got)
+	}
+}
+
+func TestSerializeForExecCsumIPv4Options(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$csum_ipv4_options(&(0x7f0000000000)="+
+		"{0x0, 0x1, 0x2, [{0x7, 0x4, \"0102\"}, {0x1, 0x2, \"\"}]})")
+	decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+	// The checksum covers the 10-byte base header and 6 bytes of options.
+	want := ExecArgCsum{
+		Size: 2,
+		Kind: ExecArgCsumInet,
+		Chunks: []ExecCsumChunk{
+			{ExecArgCsumChunkData, target.DataOffset, 16},
+		},
+	}
+	for _, copyin := range decoded.Calls[0].Copyin {
+		if csum, ok := copyin.Arg.(ExecArgCsum); ok {
+			if !reflect.DeepEqual(csum, want) {
+				t.Fatalf("bad csum:\ngot:  %+v\nwant: %+v", csum, want)
+			}
+			return
+		}
+	}
+	t.Fatalf("no csum instruction")
+}
+
+func TestSerializeForExecUnionOptions(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$union0(&(0x7f0000000000)={0x1, @f2=0x2})")
+	dataOffset := target.DataOffset
+	want := []uint64{
+		ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 8, 1, 0, 0,
+		ExecInstrUnionOption, dataOffset + 8, 2,
+		ExecInstrCopyin, dataOffset + 8, ExecArgTypeConst, 1, 2, 0, 0,
+		uint64(target.SyscallMap["syz_test$union0"].ID), ExecNoCopyout, 1,
+		ExecArgTypeConst, 8, dataOffset, 0, 0,
+		ExecInstrEOF,
+	}
+	decoded, data := serializeAndDecode(t, p, ExecOpts{EmitUnionOptions: true})
+	checkExecWords(t, data, want)
+	copyin := decoded.Calls[0].Copyin[1]
+	if copyin.Addr != dataOffset+8 || copyin.Arg != (ExecArgUnionOption{Index: 2}) {
+		t.Fatalf("bad decoded union option: %+v", copyin)
+	}
+	if err := target.checkExecRoundTrip(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSerializeForExecDataAlign(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})")
+	dataOffset := target.DataOffset
+	words := func(v ...uint64) []byte {
+		w := new(bytes.Buffer)
+		binary.Write(w, binary.LittleEndian, v)
+		return w.Bytes()
+	}
+	cat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	copyin := words(ExecInstrCopyin, dataOffset+0, ExecArgTypeConst, 1, 0x42, 0, 0,
+		ExecInstrCopyin, dataOffset+1, ExecArgTypeData, 5)
+	call := words(uint64(target.SyscallMap["syz_test$array1"].ID), ExecNoCopyout, 1,
+		ExecArgTypeConst, 8, dataOffset, 0, 0,
+		ExecInstrEOF)
+	data := []byte{1, 2, 3, 4, 5}
+	tests := []struct {
+		align uint64
+		want  []byte
+	}{
+		{0, cat(copyin, data, make([]byte, 3), call)},
+		{8, cat(copyin, data, make([]byte, 3), call)},
+		{16, cat(words(ExecInstrDataAlign, 16), copyin, data, make([]byte, 11), call)},
+		{1, cat(words(ExecInstrDataAlign, 1), copyin, data, call)},
+		{3, nil},
+	}
+	for _, test := range tests {
+		opts := ExecOpts{DataAlign: test.align}
+		if test.want == nil {
+			if _, err := p.SerializeForExecOpts(make([]byte, ExecBufferSize), 0, opts); err == nil {
+				t.Errorf("align %v: serialization succeeded", test.align)
+			}
+			continue
+		}
+		decoded, exec := serializeAndDecode(t, p, opts)
+		if !bytes.Equal(exec, test.want) {
+			t.Fatalf("align %v: mismatch\nwant: %x\ngot:  %x", test.align, test.want, exec)
+		}
+		size, err := p.execByteSize(0, opts)
+		if err != nil || size != len(exec) {
+			t.Fatalf("align %v: byte size %v, want %v (%v)", test.align, size, len(exec), err)
+		}
+		copyin := decoded.Calls[0].Copyin[1].Arg.(ExecArgData)
+		if !bytes.Equal(copyin.Data, data) {
+			t.Fatalf("align %v: bad decoded data %x", test.align, copyin.Data)
+		}
+	}
+}
+
+func TestSerializeForExecEmpty(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	for _, p := range []*Prog{{Target: target}, {}} {
+		size, err := p.ExecByteSize(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != 8 {
+			t.Fatalf("ExecByteSize returned %v, want 8", size)
+		}
+		data := serializeForExec(t, p, ExecOpts{})
+		if len(data) != 8 {
+			t.Fatalf("serialized %v bytes, want 8", len(data))
+		}
+		if v := binary.LittleEndian.Uint64(data); v != ExecInstrEOF {
+			t.Fatalf("serialized 0x%x, want EOF", v)
+		}
+		exec, err := target.DeserializeExec(data)
+		if err != nil {
+
+			t.Fatalf("failed to decode: %v", err)
+		}
+		if len(exec.Calls) != 0 || exec.NumVars != 0 {
+			t.Fatalf("decoded non-empty program: %+v", exec)
+		}
+	}
+}
+
+func TestSerializeForExecSyscallNR(t *testing.T) {
+	target, err := GetTarget("linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parseProg(t, target, "getpid()\n")
+	meta := target.SyscallMap["getpid"]
+	if uint64(meta.ID) == meta.NR {
+		t.Fatalf("getpid ID and NR are both %v", meta.NR)
+	}
+	buf := make([]byte, ExecBufferSize)
+	for _, nr := range []bool{false, true} {
+		if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{EmitSyscallNR: nr}); err != nil {
+			t.Fatal(err)
+		}
+		want := uint64(meta.ID)
+		if nr {
+			want = meta.NR
+		}
+		if got := binary.LittleEndian.Uint64(buf); got != want {
+			t.Fatalf("EmitSyscallNR=%v: call header is %v, want %v", nr, got, want)
+		}
+	}
+	ct := target.BuildChoiceTable(nil, map[*Syscall]bool{target.SyscallMap["syz_emit_ethernet"]: true})
+	p = target.Generate(rand.NewSource(0), 1, ct)
+	if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{EmitSyscallNR: true}); err == nil {
+		t.Fatalf("serialized pseudo-syscall with EmitSyscallNR")
+	}
+}
+
+func TestSerializeForExecCsumCrc32(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	dataOffset := target.DataOffset
+	tests := []struct {
+		prog  string
+		crc32 bool // turn the inet csum field into crc32
+		want  ExecArgCsum
+		words []uint64 // if set, the expected serialization
+	}{
+		{
+			prog:  "syz_test$csum_ipv4(&(0x7f0000000000)={0x0, 0x1, 0x2})",
+			crc32: true,
+			want: ExecArgCsum{
+				Size:   2,
+				Kind:   ExecArgCsumCrc32,
+				Chunks: []ExecCsumChunk{{ExecArgCsumChunkData, dataOffset, 10}},
+				Poly:   0xedb88320,
+			},
+			words: []uint64{
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 2, 0, 0, 0,
+				ExecInstrCopyin, dataOffset + 2, ExecArgTypeConst, 4, 0x01000000, 0, 0,
+				ExecInstrCopyin, dataOffset + 6, ExecArgTypeConst, 4, 0x02000000, 0, 0,
+				ExecInstrCopyin, dataOffset + 0, ExecArgTypeCsum, 2, ExecArgCsumCrc32,
+				dataOffset + 0, 10, 0xedb88320,
+				uint64(target.SyscallMap["syz_test$csum_ipv4"].ID), ExecNoCopyout, 1,
+				ExecArgTypeConst, 8, dataOffset, 0, 0,
+				ExecInstrEOF,
+			},
+		},
+		{
+			prog: `syz_test$csum_crc32c(&(0x7f0000000000)={0x0, "0102"})`,
+			want: ExecArgCsum{
+				Size:   4,
+				Kind:   ExecArgCsumCrc32,
+				Chunks: []ExecCsumChunk{{ExecArgCsumChunkData, dataOffset, 6}},
+				Poly:   0x82f63b78,
+			},
+		},
+	}
+	for i, test := range tests {
+		p := parseProg(t, target, test.prog)
+		if test.crc32 {
+			csum := p.Calls[0].Args[0].(*PointerArg).Res.(*GroupArg).Inner[0].(*ConstArg)
+			typ := *csum.Type().(*CsumType)
+			typ.Kind = CsumCrc32
+			csum.typ = &typ
+		}
+		decoded, data := serializeAndDecode(t, p, ExecOpts{})
+		if test.words != nil {
+			checkExecWords(t, data, test.words)
+		}
+		copyins := decoded.Calls[0].Copyin
+		copyin := copyins[len(copyins)-1]
+		if copyin.Addr != dataOffset || !reflect.DeepEqual(copyin.Arg, test.want) {
+			t.Fatalf("test #%v: wrong decoded csum:\ngot:  0x%x %#v\nwant: 0x%x %#v",
+				i, copyin.Addr, copyin.Arg, dataOffset, test.want)
+		}
+		if err := p.CheckExecRoundTrip(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// The test is not parallel because it changes byte order of the shared target.
+func TestSerializeForExecBigEndian(t *testing.T) {
+	target, err := GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.BigEndian = true
+	defer func() { target.BigEndian = false }()
+	p := parseProg(t, target, "syz_test$end0(&(0x7f0000000000)={0x42, 0x42, 0x42, 0x42})\n"+
+		"syz_test$array1(&(0x7f0000001000)={0x42, \"0102030405\"})")
+	decoded, data := serializeAndDecode(t, p, ExecOpts{})
+	dataOffset := target.DataOffset
+	want := []uint64{
+		// Big-endian fields are not swapped.
+		ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 1, 0x42, 0, 0,
+		ExecInstrCopyin, dataOffset + 1, ExecArgTypeConst, 2, 0x42, 0, 0,
+		ExecInstrCopyin, dataOffset + 3, ExecArgTypeConst, 4, 0x42, 0, 0,
+		ExecInstrCopyin, dataOffset + 7, ExecArgTypeConst, 8, 0x42, 0, 0,
+		uint64(target.SyscallMap["syz_test$end0"].ID), ExecNoCopyout, 1,
+		ExecArgTypeConst, 8, dataOffset, 0, 0,
+	}
+	var got []uint64
+	for i := 0; i < len(want)*8; i += 8 {
+		got = append(got, binary.BigEndian.Uint64(data[i:]))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong serialization:\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if err := p.CheckExecRoundTrip(0); err != nil {
+		t.Fatal(err)
+	}
+	// Data is copied as is regardless of the byte order.
+	if data := decoded.Calls[1].Copyin[1].Arg.(ExecArgData).Data; !bytes.Equal(data, []byte{1, 2, 3, 4, 5}) {
+		t.Fatalf("bad data arg %x", data)
+	}
+	// Narrow size words are big-endian as well.
+	decoded, _ = serializeAndDecode(t, p, ExecOpts{SizeWidth: 2})
+	if size := decoded.Calls[0].Copyin[3].Arg.(ExecArgConst).Size; size != 8 {
+		t.Fatalf("bad decoded size %v with narrow size words", size)
+	}
+	decoded, data = serializeAndDecode(t, p, ExecOpts{EmitHeader: true, ArgByteOrder: true})
+	if decoded.Flags&ExecFlagBigEndian == 0 {
+		t.Fatalf("no big-endian flag in the header: 0x%x", decoded.Flags)
+	}
+	for _, copyin := range decoded.Calls[0].Copyin {
+		if arg := copyin.Arg.(ExecArgConst); arg.Size&ExecArgFlagBigEndian != 0 || arg.Value != 0x42 {
+			t.Fatalf("bad big-endian arg %+v", arg)
+		}
+	}
+	checkExecEncoding(t, target, data)
+	target.BigEndian = false
+	if _, err := target.DeserializeExec(data); err == nil {
+
+		t.Fatalf("big-endian program is decoded for little-endian target")
+	}
+}
+
+func TestSerializeForExecBitfieldGroup(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$bf1(&(0x7f0000000000)={{0x0, 0x0, 0x0}, 0x42})")
+	// Replace the 3 int32:10 bitfields with 4 int32:8 bitfields.
+	group := p.Calls[0].Args[0].(*PointerArg).Res.(*GroupArg).Inner[0].(*GroupArg)
+	structType := *group.Type().(*StructType)
+	structDesc := *structType.StructDesc
+	structType.StructDesc = &structDesc
+	base := structDesc.Fields[0].(*IntType)
+	structDesc.Fields = nil
+	group.typ = &structType
+	group.Inner = nil
+	for i, v := range []uint64{0x11, 0x22, 0x33, 0x1ff} {
+		typ := *base
+		typ.BitfieldOff = uint64(i) * 8
+		typ.BitfieldLen = 8
+		typ.BitfieldMdl = i != 3
+		structDesc.Fields = append(structDesc.Fields, &typ)
+		group.Inner = append(group.Inner, MakeConstArg(&typ, v))
+	}
+	defer overrideDebug(false)()
+	dataOffset := target.DataOffset
+	checkExecWords(t, serializeForExec(t, p, ExecOpts{}), []uint64{
+		ExecInstrCopyin, dataOffset + 0, ExecArgTypeConst, 4, 0xff332211, 0, 0,
+		ExecInstrCopyin, dataOffset + 4, ExecArgTypeConst, 1, 0x42, 0, 0,
+		uint64(target.SyscallMap["syz_test$bf1"].ID), ExecNoCopyout, 1,
+		ExecArgTypeConst, 8, dataOffset, 0, 0,
+		ExecInstrEOF,
+	})
+}
+
+func TestExecMemFootprint(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		prog  string
+		pages uint64
+	}{
+		{"", 0},
+		{"syz_test$opt1(0x0)", 0},
+		{"syz_test$align0(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})", 1},
+		{"syz_test$align0(&(0x7f0000000000+0xff0)={0x1, 0x2, 0x3, 0x4, 0x5})", 2},
+		{"syz_test$align0(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})\n" +
+			"syz_test$align0(&(0x7f0000064000)={0x1, 0x2, 0x3, 0x4, 0x5})", 101},
+	}
+	for i, test := range tests {
+		p := parseProg(t, target, test.prog)
+		if pages := p.ExecMemFootprint(); pages != test.pages {
+			t.Errorf("prog %v: footprint is %v pages, want %v", i, pages, test.pages)
+		}
+	}
+}
+
+func TestSerializeForExecArgOrder(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	meta := target.SyscallMap["syz_test$int"]
+	// Emulate an ABI that passes the first 2 args after the rest.
+	target.ExecArgOrder = func(c *Syscall) []int {
+		if c == meta {
+			return []int{2, 3, 4, 0, 1}
+		}
+		return nil
+	}
+	defer func() { target.ExecArgOrder = nil }()
+	p := parseProg(t, target, "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)\nsyz_test$opt1(0x0)")
+	checkExecWords(t, serializeForExec(t, p, ExecOpts{}), []uint64{
+		uint64(meta.ID), ExecNoCopyout, 5,
+		ExecArgTypeConst, 2, 3, 0, 0,
+		ExecArgTypeConst, 4, 4, 0, 0,
+		ExecArgTypeConst, 8, 5, 0, 0,
+		ExecArgTypeConst, 8, 1, 0, 0,
+		ExecArgTypeConst, 1, 2, 0, 0,
+		uint64(target.SyscallMap["syz_test$opt1"].ID), ExecNoCopyout, 1,
+		ExecArgTypeConst, 8, target.DataOffset, 0, 0,
+		ExecInstrEOF,
+	})
+}
+
+func TestSerializeForExecMetrics(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	buf1 := make([]byte, ExecBufferSize)
+	var metrics ExecMetrics
+	calls := 0
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		calls += len(p.Calls)
+		n, err := p.SerializeForExec(buf, i%16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n1, err := p.SerializeForExecOpts(buf1, i%16, ExecOpts{Metrics: &metrics})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], buf1[:n1]) {
+			t.Fatalf("serialization with metrics differs")
+		}
+	}
+	if metrics.Programs != iters || metrics.Calls != calls {
+		t.Fatalf("metrics has %v programs, %v calls; want %v, %v",
+			metrics.Programs, metrics.Calls, iters, calls)
+	}
+	if metrics.Checksums+metrics.Copyins+metrics.Args+metrics.Copyouts == 0 {
+		t.Fatalf("no time in metrics: %+v", metrics)
+	}
+}
+
+func TestSerializeForExecAppendChecksum(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	buf1 := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		n, err := p.SerializeForExec(buf, i%16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n1, err := p.SerializeForExecOpts(buf1, i%16, ExecOpts{AppendChecksum: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		exec, err := target.VerifyExecChecksum(buf1[:n1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(exec, buf[:n]) {
+			t.Fatalf("program with checksum differs")
+		}
+		if _, err := target.DeserializeExec(buf1[:n1]); err != nil {
+			t.Fatal(err)
+		}
+		// Flip a bit in the middle.
+		pos := n1 / 2
+		buf1[pos] ^= 0x10
+		if _, err := target.VerifyExecChecksum(buf1[:n1]); err == nil {
+			t.Fatalf("corrupted program at byte %v passed verification", pos)
+		}
+	}
+}
+
+func TestSerializeForExecWithAddrs(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$align0(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})\n"+
+		"syz_test$array1(&(0x7f0000001000)={0x42, \"0102030405\"})")
+	buf := make([]byte, ExecBufferSize)
+	n, addrs, err := p.SerializeForExecWithAddrs(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n1 := len(serializeForExec(t, p, ExecOpts{})); n != n1 {
+		t.Fatalf("serialized %v bytes, SerializeForExec serialized %v", n, n1)
+	}
+	dataOffset := target.DataOffset
+	align0 := p.Calls[0].Args[0].(*PointerArg).Res.(*GroupArg)
+	array1 := p.Calls[1].Args[0].(*PointerArg).Res.(*GroupArg)
+	want := map[Arg]uint64{
+		align0:          dataOffset,
+		align0.Inner[0]: dataOffset + 0,
+		align0.Inner[1]: dataOffset + 2,
+		align0.Inner[2]: dataOffset + 4,
+		align0.Inner[3]: dataOffset + 8,
+		align0.Inner[4]: dataOffset + 9,
+		align0.Inner[5]: dataOffset + 10,
+		align0.Inner[6]: dataOffset + 12,
+		align0.Inner[7]: dataOffset + 16,
+		array1:          dataOffset + 0x1000,
+		array1.Inner[0]: dataOffset + 0x1000,
+		array1.Inner[1]: dataOffset + 0x1001,
+	}
+	if len(align0.Inner) != 8 || len(array1.Inner) != 2 {
+		t.Fatalf("unexpected number of fields: %v, %v", len(align0.Inner), len(array1.Inner))
+	}
+	for arg, addr := range want {
+		if got, ok := addrs[arg]; !ok || got != addr {
+			t.Errorf("arg %v: addr 0x%x (%v), want 0x%x", arg.Type().Name(), got, ok, addr)
+		}
+	}
+	if len(addrs) != len(want) {
+		t.Errorf("got %v addrs, want %v", len(addrs), len(want))
+	}
+}
+
+func TestSerializeForExecDataPadding(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})")
+	size, err := p.ExecByteSize(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Const copyin (7 words), data copyin header (4 words) and the padded blob.
+	dataEnd := 7*8 + 4*8 + 8
+	// The second buffer ends exactly at the end of the padded blob, serialization into it fails
+	// due to the following call, but the blob must be fully written nevertheless.
+	for _, buf := range [][]byte{make([]byte, size), make([]byte, dataEnd)} {
+		for i := range buf {
+			buf[i] = 0xff
+		}
+		p.SerializeForExec(buf, 0)
+		blob := buf[dataEnd-8 : dataEnd]
+		if want := []byte{1, 2, 3, 4, 5, 0, 0, 0}; !bytes.Equal(blob, want) {
+			t.Fatalf("blob is serialized as %v, want %v", blob, want)
+		}
+	}
+}
+
+func TestSerializeForExecCaptureAllReturns(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test()\nr0 = syz_test$res0()\nsyz_test$res1(r0)\nsyz_test$res0()\n")
+	for _, all := range []bool{false, true} {
+		exec, _ := serializeAndDecode(t, p, ExecOpts{CaptureAllReturns: all})
+		var got []uint64
+		for _, c := range exec.Calls {
+			got = append(got, c.Index)
+		}
+		want := []uint64{ExecNoCopyout, 0, ExecNoCopyout, ExecNoCopyout}
+		if all {
+			want = []uint64{0, 1, 2, 3}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("CaptureAllReturns=%v: copyout indices %v, want %v", all, got, want)
+		}
+		if all && exec.NumVars != uint64(len(want)) {
+			t.Fatalf("NumVars is %v, want %v", exec.NumVars, len(want))
+		}
+		if all && exec.Calls[2].Args[0].(ExecArgResult).Index != 1 {
+			t.Fatalf("result arg references %+v, want 1", exec.Calls[2].Args[0])
+		}
+	}
+}
+
+func TestValidateForExec(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res1(r0)\n"+
+		"syz_test$align0(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})\n"+
+		"syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)\n")
+	if errs := p.ValidateForExec(0); len(errs) != 0 {
+		t.Fatalf("valid program has errors: %v", errs)
+	}
+	// Consumer of r0 before the producer.
+	p.Calls[0], p.Calls[1] = p.Calls[1], p.Calls[0]
+	// Pointer outside of the data region.
+	p.Calls[2].Args[0].(*PointerArg).PageIndex = target.NumPages + 1
+	// Extra arg.
+	p.Calls[3].Args = append(p.Calls[3].Args, MakeConstArg(p.Calls[3].Args[0].Type(), 0))
+	errs := p.ValidateForExec(0)
+	want := []string{
+		"references result of a later call",
+		"outside of data region",
+		"wrong number of arguments",
+	}
+	// Some defects are detected by several checks, so there can be more errors.
+	for _, w := range want {
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), w)
+		}
+		if !found {
+			t.Errorf("no %q error in %v", w, errs)
+		}
+	}
+	if _, err := p.SerializeForExec(make([]byte, ExecBufferSize), 0); err == nil ||
+		err.Error() != errs[0].Error() {
+		t.Fatalf("SerializeForExec returned %v, want %v", err, errs[0])
+	}
+}
+
+func TestValidateForExecProc(t *testing.T) {
+	target, err := GetTarget("linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Port is proc[20000, 4, int16be].
+	p := parseProg(t, target, "bind$inet(0xffffffffffffffff, "+
+		"&(0x7f0000000000)={0x2, 0x3, @loopback=0x7f000001}, 0x10)")
+	if errs := p.ValidateForExec(0); len(errs) != 0 {
+		t.Fatalf("valid program has errors: %v", errs)
+	}
+	// 20000 + 4*11383 + 3 = 65535 still fits into int16.
+	if errs := p.ValidateForExec(11383); len(errs) != 0 {
+		t.Fatalf("valid program has errors: %v", errs)
+	}
+	errs := p.ValidateForExec(11384)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "does not fit into 16 bits") {
+		t.Fatalf("want proc value error, got %v", errs)
+	}
+}
+
+func TestSerializeForExecEnabledCalls(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = mutate5(&(0x7f0000000000)='./file0\\x00', 0x0)\n"+
+		"r1 = syz_test$res0()\n"+
+		"mutate6(r0, &(0x7f0000001000)=\"01\", 0x1)\n"+
+		"syz_test$res1(r1)\n")
+	enabled := make(map[*Syscall]bool)
+	for _, c := range target.Syscalls {
+		enabled[c] = c.Name != "mutate5"
+	}
+	exec, _ := serializeAndDecode(t, p, ExecOpts{EnabledCalls: enabled})
+	var calls []string
+
+	for _, c := range exec.Calls {
+		calls = append(calls, c.Meta.Name)
+	}
+	if want := []string{"syz_test$res0", "mutate6", "syz_test$res1"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("serialized calls %v, want %v", calls, want)
+	}
+	// r1 gets copyout index 0, the use of r0 is replaced with the default value.
+	if exec.Calls[0].Index != 0 || exec.NumVars != 1 {
+		t.Fatalf("r1 has copyout index %v, %v vars", exec.Calls[0].Index, exec.NumVars)
+	}
+	if arg, ok := exec.Calls[1].Args[0].(ExecArgConst); !ok || arg.Value != p.Calls[2].Args[0].(*ResultArg).Val {
+		t.Fatalf("use of skipped result is %+v", exec.Calls[1].Args[0])
+	}
+	if arg, ok := exec.Calls[2].Args[0].(ExecArgResult); !ok || arg.Index != 0 {
+		t.Fatalf("use of r1 is %+v", exec.Calls[2].Args[0])
+	}
+}
+
+func TestSerializeForExecVarint(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	buf1 := make([]byte, ExecBufferSize)
+	opts := ExecOpts{EmitHeader: true, Varint: true}
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		n, err := p.SerializeForExecOpts(buf, i%16, ExecOpts{EmitHeader: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n1, err := p.SerializeForExecOpts(buf1, i%16, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size, err := p.execByteSize(i%16, opts); err != nil || size != n1 {
+			t.Fatalf("execByteSize returned %v/%v, serialized %v bytes", size, err, n1)
+		}
+		if n1 > n {
+			t.Fatalf("varint program is larger: %v vs %v", n1, n)
+		}
+		want, err := target.DeserializeExec(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := target.DeserializeExec(buf1[:n1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.Flags |= ExecFlagVarint
+		want.varint = true
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("varint program decoded differently:\n%s", p.Serialize())
+		}
+		if err := target.checkExecRoundTrip(buf1[:n1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := target.Generate(rs, 10, nil)
+	if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{Varint: true}); err == nil {
+		t.Fatalf("no error for varint program without header")
+	}
+}
+
+// BenchmarkSerializeForExecProgs serializes a set of programs into a reused buffer,
+// so that the results reflect the cost of serialization itself.
+func BenchmarkSerializeForExecProgs(b *testing.B) {
+	defer overrideDebug(false)()
+	target, err := GetTarget("linux", "amd64")
+	if err != nil {
+		b.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	var progs []*Prog
+	for i := 0; i < 100; i++ {
+		progs = append(progs, target.Generate(rs, 30, nil))
+	}
+	buf := make([]byte, ExecBufferSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := progs[i%len(progs)].SerializeForExec(buf, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSerializeForExecVarint(b *testing.B) {
+	defer overrideDebug(false)()
+	target, err := GetTarget("linux", "amd64")
+	if err != nil {
+		b.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	var progs []*Prog
+	for i := 0; i < 100; i++ {
+		progs = append(progs, target.Generate(rs, 30, nil))
+	}
+	for _, varint := range []bool{false, true} {
+		name := "fixed"
+		if varint {
+			name = "varint"
+		}
+		b.Run(name, func(b *testing.B) {
+			buf := make([]byte, ExecBufferSize)
+			opts := ExecOpts{EmitHeader: true, Varint: varint}
+			total := 0
+			for i := 0; i < b.N; i++ {
+				n, err := progs[i%len(progs)].SerializeForExecOpts(buf, 0, opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				total += n
+			}
+			b.ReportMetric(float64(total)/float64(b.N), "bytes/prog")
+		})
+	}
+}
+
+func TestSerializeForExecExpectedReturns(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res1(r0)\nsyz_test()\n")
+	opts := ExecOpts{ExpectedReturns: map[int]uint64{0: 3, 2: ^uint64(0)}}
+	exec, data := serializeAndDecode(t, p, opts)
+	callID := func(name string) uint64 {
+		return uint64(target.SyscallMap[name].ID)
+	}
+	want := []uint64{
+		callID("syz_test$res0"), 0, 0,
+		ExecInstrExpectReturn, 3,
+		callID("syz_test$res1"), ExecNoCopyout, 1, ExecArgTypeResult, 4, 0, 0, 0,
+		callID("syz_test"), ExecNoCopyout, 0,
+		ExecInstrExpectReturn, ^uint64(0),
+		ExecInstrEOF,
+	}
+	checkExecWords(t, data, want)
+	for i, c := range exec.Calls {
+		ret, ok := opts.ExpectedReturns[i]
+		if c.HasExpectedRet != ok || c.ExpectedRet != ret {
+			t.Errorf("call %v: decoded expected return %v/0x%x, want %v/0x%x",
+				i, c.HasExpectedRet, c.ExpectedRet, ok, ret)
+		}
+	}
+	if err := target.checkExecRoundTrip(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecContext(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})")
+	ptr := p.Calls[0].Args[0].(*PointerArg)
+	blob := ptr.Res.(*GroupArg).Inner[1]
+	full := 0
+	for _, size := range []int{ExecBufferSize, 64, 20} {
+		ctx := target.NewExecContext(make([]byte, size), ExecOpts{})
+		ctx.Write(ExecInstrCopyin)
+		ctx.Write(target.DataOffset + 1)
+		ctx.WriteArg(blob, 0)
+		ctx.Write(uint64(p.Calls[0].Meta.ID))
+		ctx.Write(ExecNoCopyout)
+		ctx.Write(1)
+		ctx.WriteArg(ptr, 0)
+		exec, err := ctx.Finish()
+		if size != ExecBufferSize {
+			if tooSmall, ok := err.(*ExecBufferTooSmallError); !ok || tooSmall.Size != full {
+				t.Fatalf("got %v for a small buffer, want ExecBufferTooSmallError{%v}", err, full)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		full = len(exec)
+		decoded, err := target.DeserializeExec(exec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ExecProg{
+			Calls: []ExecCall{{
+				Meta:  p.Calls[0].Meta,
+				Index: ExecNoCopyout,
+				Args:  []ExecArg{ExecArgConst{Size: 8, Value: target.DataOffset}},
+				Copyin: []ExecCopyin{{
+					Addr: target.DataOffset + 1,
+					Arg:  ExecArgData{Data: []byte{1, 2, 3, 4, 5}},
+				}},
+			}},
+		}
+		if !reflect.DeepEqual(decoded, want) {
+			t.Fatalf("decoded program:\n%+v\nwant:\n%+v", decoded, want)
+		}
+	}
+}
+
+func TestSerializeForExecDedupCopyins(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		prog    string
+		copyins int
+	}{
+		{
+			// a1 writes the same value to the same address as a0.f0.
+			"syz_test$length13(&(0x7f0000000000)={0x30, 0x1, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, &(0x7f0000000000)=0x30)",
+			10,
+		},
+		{
+			// The data differs, so the last write must be preserved.
+			"syz_test$length13(&(0x7f0000000000)={0x31, 0x1, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, &(0x7f0000000000)=0x30)",
+			11,
+		},
+	}
+	for i, test := range tests {
+		decoded, _ := serializeAndDecode(t, parseProg(t, target, test.prog), ExecOpts{})
+		if got := len(decoded.Calls[0].Copyin); got != test.copyins {
+			t.Errorf("#%v: got %v copyins, want %v", i, got, test.copyins)
+		}
+	}
+}
+
+func TestSerializeForExecFlatMemory(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$opt1(&(0x7f0000001000)=0x42)")
+	p.Calls[0].Args[0].(*PointerArg).PageOffset = -0x10
+	for _, flat := range []bool{false, true} {
+		target.FlatMemory = flat
+		decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+		target.FlatMemory = false
+		want := target.DataOffset + 0x1ff0
+		if flat {
+			want = target.DataOffset + 0xff0
+		}
+		call := decoded.Calls[0]
+		if addr := call.Args[0].(ExecArgConst).Value; addr != want {
+			t.Errorf("flat=%v: got pointer 0x%x, want 0x%x", flat, addr, want)
+		}
+		if addr := call.Copyin[0].Addr; addr != want {
+			t.Errorf("flat=%v: got copyin addr 0x%x, want 0x%x", flat, addr, want)
+		}
+	}
+}
+
+func TestSerializeForExecRedacted(t *testing.T) {
+	target, rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		want, data := serializeAndDecode(t, p, ExecOpts{})
+		redacted := make([]byte, ExecBufferSize)
+		n1, err := p.SerializeForExecRedacted(redacted, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(data); n != n1 {
+			t.Fatalf("redacted stream size %v, want %v", n1, n)
+		}
+		got, err := target.DeserializeExec(redacted[:n1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, call := range want.Calls {
+			for i, copyin := range call.Copyin {
+				switch arg := copyin.Arg.(type) {
+				case ExecArgData:
+					call.Copyin[i].Arg = ExecArgData{Data: make([]byte, len(arg.Data))}
+				case ExecArgFill:
+					arg.Value = 0
+					call.Copyin[i].Arg = arg
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("redacted program differs:\n%s\ngot:\n%+v\nwant:\n%+v", p.Serialize(), got, want)
+		}
+	}
+}
+
+func TestSerializeForExecCsumCache(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	countCsums := func(prog string, opts ExecOpts) (csums, copyins int) {
+		decoded, _ := serializeAndDecode(t, parseProg(t, target, prog), opts)
+		for _, copyin := range decoded.Calls[0].Copyin {
+			if _, ok := copyin.Arg.(ExecArgCsum); ok {
+				csums++
+			} else {
+				copyins++
+			}
+		}
+		return
+	}
+	prog1 := "syz_test$csum_ipv4_tcp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {{0x0}, \"abcd\"}})"
+	prog2 := "syz_test$csum_ipv4_tcp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {{0x0}, \"abce\"}})"
+	csums, copyins := countCsums(prog1, ExecOpts{})
+	opts := ExecOpts{CsumCache: new(ExecCsumCache)}
+	tests := []struct {
+		prog    string
+		csums   int
+		copyins int
+	}{
+		{prog1, csums, copyins},
+		// Nothing has changed, both checksums and their zero copyins are skipped.
+		{prog1, 0, copyins - csums},
+		// Only the TCP checksum covers the changed payload.
+		{prog2, 1, copyins - 1},
+		{prog2, 0, copyins - csums},
+	}
+	for i, test := range tests {
+		csums, copyins := countCsums(test.prog, opts)
+		if csums != test.csums || copyins != test.copyins {
+			t.Errorf("#%v: got %v csums and %v copyins, want %v and %v",
+				i, csums, copyins, test.csums, test.copyins)
+		}
+	}
+	// Without the cache checksums are always emitted.
+	if got, _ := countCsums(prog1, ExecOpts{}); got != csums || csums != 2 {
+		t.Errorf("got %v csums without cache, want %v", got, csums)
+	}
+}
+
+func TestEncodeInstrs(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	buf1 := make([]byte, ExecBufferSize)
+	allOpts := []ExecOpts{
+		{},
+		{SizeWidth: 2},
+		{SizeWidth: 4, DataAlign: 16},
+		{EmitHeader: true, Varint: true},
+	}
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		for _, opts := range allOpts {
+			n, err := p.SerializeForExecOpts(buf, i%16, opts)
+			if err != nil {
+				// Generated programs may have sizes that don't fit into 2 bytes.
+				if opts.SizeWidth == 2 {
+					continue
+				}
+				t.Fatal(err)
+			}
+			instrs, err := p.SerializeForExecInstrsOpts(i%16, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last := instrs[len(instrs)-1]; last.Kind != ExecInstrEOF {
+				t.Fatalf("last instruction is 0x%x, want EOF", last.Kind)
+			}
+			n1, err := target.EncodeInstrs(instrs, buf1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf[:n], buf1[:n1]) {
+				t.Fatalf("encoded instructions differ from SerializeForExecOpts with %+v for:\n%s",
+					opts, p.Serialize())
+			}
+			_, err = target.EncodeInstrs(instrs, buf1[:n-1])
+			if tooSmall, ok := err.(*ExecBufferTooSmallError); !ok || tooSmall.Size != n {
+				t.Fatalf("got %v for a small buffer, want ExecBufferTooSmallError{%v}", err, n)
+			}
+		}
+	}
+}
+
+func TestSerializeForExecConst128(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		text    string
+		lo, hi  uint64
+		encoded string
+	}{
+		{"0x11121314151617180102030405060708", 0x0102030405060708, 0x1112131415161718, ""},
+		{"0x10000000000000000", 0, 1, ""},
+		{"0x2a", 0x2a, 0, ""},
+		{"0x0000000000000000000000000000002a", 0x2a, 0, "0x2a"},
+	}
+	for i, test := range tests {
+		text := "syz_test$int128(&(0x7f0000000000)=" + test.text + ")\n"
+		p := parseProg(t, target, text)
+		arg := p.Calls[0].Args[0].(*PointerArg).Res.(*ConstArg)
+		if arg.Val != test.lo || arg.ValHigh != test.hi {
+			t.Fatalf("#%v: parsed 0x%x:0x%x, want 0x%x:0x%x", i, arg.ValHigh, arg.Val, test.hi, test.lo)
+		}
+		want := text
+		if test.encoded != "" {
+			want = "syz_test$int128(&(0x7f0000000000)=" + test.encoded + ")\n"
+		}
+		if got := string(p.Serialize()); got != want {
+			t.Fatalf("#%v: serialized %q, want %q", i, got, want)
+		}
+		decoded, data := serializeAndDecode(t, p, ExecOpts{})
+		wantArg := ExecArgConst{Size: 16, Value: test.lo, ValueHigh: test.hi}
+		if got := decoded.Calls[0].Copyin[0].Arg; !reflect.DeepEqual(got, wantArg) {
+			t.Fatalf("#%v: got %+v, want %+v", i, got, wantArg)
+		}
+		if !bytes.Equal(decoded.encode(), data) {
+			t.Fatalf("#%v: re-encoded program differs", i)
+		}
+	}
+	// Values wider than 16 bytes don't fit.
+	if _, err := target.Deserialize([]byte("syz_test$int128(&(0x7f0000000000)=" +
+		"0x100000000000000000000000000000000)\n")); err == nil {
+		t.Fatalf("parsed 17-byte value")
+	}
+}
+
+func TestSerializeForExecUnionResults(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	defer overrideDebug(false)()
+	tests := []struct {
+		dir      Dir
+		inactive bool
+		copyout  bool
+	}{
+		{DirOut, false, true},
+		// The resource is in an in union, so its value is not written by the call.
+		{DirIn, false, false},
+		// The resource is in an option that is not selected anymore.
+		{DirOut, true, false},
+	}
+	for i, test := range tests {
+		p := parseProg(t, target, "syz_test$union0(&(0x7f0000000000)={0x1, @f0=0x2})\nsyz_test$res1(0xffff)")
+		union := p.Calls[0].Args[0].(*PointerArg).Res.(*GroupArg).Inner[1].(*UnionArg)
+		res := p.Calls[1].Args[0].(*ResultArg)
+		// Pretend that the union option is a resource produced by the call.
+		typ := *res.Type().(*ResourceType)
+		typ.ArgDir = test.dir
+		producer := MakeResultArg(&typ, nil, 0)
+		union.Option = producer
+		p.Calls[1].Args[0] = MakeResultArg(res.Type(), producer, 0xffff)
+		if test.inactive {
+			typ := union.Type().(*UnionType).Fields[2]
+			union.Option = MakeConstArg(typ, 3)
+			union.OptionType = typ
+		}
+		if test.inactive {
+			// References to args that are not in the program are rejected.
+			if errs := p.ValidateForExec(0); len(errs) == 0 {
+				t.Errorf("#%v: no error for a reference to an inactive option", i)
+			}
+			continue
+		}
+		decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+		if got := len(decoded.Calls[0].Copyout) != 0; got != test.copyout {
+			t.Errorf("#%v: got copyout %v, want %v", i, got, test.copyout)
+		}
+		var want ExecArg = ExecArgConst{Size: 4, Value: 0xffff}
+		if test.copyout {
+			want = ExecArgResult{Size: 4, Index: 0}
+		}
+		if got := decoded.Calls[1].Args[0]; !reflect.DeepEqual(got, want) {
+			t.Errorf("#%v: got result arg %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestSerializeForExecNoCsums(t *testing.T) {
+	target, rs, iters := initTest(t)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		for _, c := range p.Calls {
+			if !target.hasCsums(c.Meta) && calcChecksumsCall(c, 0) != nil {
+				t.Fatalf("call %v has checksums", c.Meta.Name)
+			}
+		}
+	}
+	target, err := GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !target.hasCsums(target.SyscallMap["syz_test$csum_ipv4_tcp"]) {
+		t.Fatalf("syz_test$csum_ipv4_tcp has no checksums")
+	}
+	p := parseProg(t, target, "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)")
+	if target.hasCsums(p.Calls[0].Meta) {
+		t.Fatalf("syz_test$int has checksums")
+	}
+	checkExecWords(t, serializeForExec(t, p, ExecOpts{}), []uint64{
+		uint64(p.Calls[0].Meta.ID), ExecNoCopyout, 5,
+		ExecArgTypeConst, 8, 1, 0, 0,
+		ExecArgTypeConst, 1, 2, 0, 0,
+		ExecArgTypeConst, 2, 3, 0, 0,
+		ExecArgTypeConst, 4, 4, 0, 0,
+		ExecArgTypeConst, 8, 5, 0, 0,
+		ExecInstrEOF,
+	})
+}
+
+func BenchmarkSerializeForExecCsums(b *testing.B) {
+	defer overrideDebug(false)()
+	target, err := GetTarget("test", "64")
+	if err != nil {
+		b.Fatal(err)
+	}
+	progs := map[string]string{
+		"csum":   "syz_test$csum_ipv4_tcp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {{0x0}, \"abcd\"}})",
+		"nocsum": "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)",
+	}
+	for _, name := range []string{"csum", "nocsum"} {
+		p, err := target.Deserialize([]byte(strings.Repeat(progs[name]+"\n", 10)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			buf := make([]byte, ExecBufferSize)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.SerializeForExec(buf, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSerializeForExecRelativePointers(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target,
+		"syz_test$opt1(&(0x7f0000001000)=0x42)\n"+
+			"syz_test$opt1(nil)\n"+
+			"syz_test$csum_ipv4(&(0x7f0000002000)={0x0, 0x1, 0x2})")
+	abs, _ := serializeAndDecode(t, p, ExecOpts{})
+	rel, _ := serializeAndDecode(t, p, ExecOpts{RelativePointers: true})
+	// Convert the absolute program to the relative form.
+	for ci := range abs.Calls {
+		call := &abs.Calls[ci]
+		for i, arg := range call.Args {
+			if a, ok := arg.(ExecArgConst); ok && a.Value >= target.DataOffset {
+				a.Size |= ExecArgFlagPointer
+				a.Value -= target.DataOffset
+				call.Args[i] = a
+			}
+		}
+		for i := range call.Copyin {
+			copyin := &call.Copyin[i]
+			copyin.Addr -= target.DataOffset
+			if csum, ok := copyin.Arg.(ExecArgCsum); ok {
+				for j := range csum.Chunks {
+					if csum.Chunks[j].Kind == ExecArgCsumChunkData {
+						csum.Chunks[j].Value -= target.DataOffset
+					}
+				}
+			}
+		}
+	}
+	if !reflect.DeepEqual(rel, abs) {
+		t.Fatalf("relative program:\n%+v\nwant:\n%+v", rel, abs)
+	}
+	if got := rel.Calls[0].Args[0]; !reflect.DeepEqual(got, ExecArgConst{Size: 8 | ExecArgFlagPointer, Value: 0x1000}) {
+		t.Fatalf("got pointer arg %+v", got)
+	}
+	if got := rel.Calls[1].Args[0]; !reflect.DeepEqual(got, ExecArgConst{Size: 8}) {
+		t.Fatalf("got NULL pointer arg %+v", got)
+	}
+}
+
+func TestSerializeForExecMaxInstrs(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	// 10 copyins and 1 call.
+	p := parseProg(t, target, "syz_test$length13(&(0x7f0000000000)={0x1, 0x2, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, &(0x7f0000001000)=0x30)")
+	buf := make([]byte, ExecBufferSize)
+	for _, max := range []int{0, 12} {
+		if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{MaxInstrs: max}); err != nil {
+			t.Fatalf("max %v: %v", max, err)
+		}
+	}
+	for _, max := range []int{1, 11} {
+		_, err := p.SerializeForExecOpts(buf, 0, ExecOpts{MaxInstrs: max})
+		if err == nil || !strings.Contains(err.Error(), "instructions") {
+			t.Fatalf("max %v: got error %v, want too many instructions", max, err)
+		}
+	}
+}
+
+func TestSerializeForExecReverseCalls(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)\nr0 = syz_test$res0()")
+	decoded, _ := serializeAndDecode(t, p, ExecOpts{ReverseCalls: true})
+	if len(decoded.Calls) != 2 || decoded.Calls[0].Meta != p.Calls[1].Meta ||
+		decoded.Calls[1].Meta != p.Calls[0].Meta {
+		t.Fatalf("calls are not reversed: %+v", decoded.Calls)
+	}
+	// The result is used by the next call, which is executed first in reverse order.
+	p = parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res1(r0)")
+	buf := make([]byte, ExecBufferSize)
+	if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{ReverseCalls: true}); err == nil {
+		t.Fatalf("no error for a result used before it is produced")
+	}
+	// Without the consumer the result is not used.
+	if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{
+		ReverseCalls: true,
+		EnabledCalls: map[*Syscall]bool{p.Calls[0].Meta: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSerializeForExecMaxBlobLen(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, fmt.Sprintf("syz_test$hint_data(&(0x7f0000000000)=\"%v\")",
+		strings.Repeat("aa", 100)))
+	buf := make([]byte, ExecBufferSize)
+	for _, max := range []int{0, 100} {
+		if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{MaxBlobLen: max}); err != nil {
+			t.Fatalf("max %v: %v", max, err)
+		}
+	}
+	_, err := p.SerializeForExecOpts(buf, 0, ExecOpts{MaxBlobLen: 99})
+	if err == nil || !strings.Contains(err.Error(), "has 100 bytes, max 99") {
+		t.Fatalf("got error %v, want too long data arg", err)
+	}
+	// Blobs longer than the default limit fit into the buffer, but are still rejected.
+	p.Calls[0].Args[0].(*PointerArg).Res.(*DataArg).data = make([]byte, ExecMaxBlobLen+1)
+	if _, err := p.SerializeForExec(buf, 0); err == nil {
+		t.Fatalf("no error for a blob exceeding ExecMaxBlobLen")
+	}
+}
+
+func TestSerializeForExecCanonical(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p := parseProg(t, target, "msgget(0x0, 0x0)")
+	serialize := func(p *Prog, pid int) []byte {
+		buf := make([]byte, ExecBufferSize)
+		n, err := p.SerializeForExec(buf, pid)
+		if pid < 0 {
+			n, err = p.SerializeForExecCanonical(buf)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf[:n]
+	}
+	if bytes.Equal(serialize(p, 1), serialize(p, 2)) {
+		t.Fatalf("serialization does not depend on pid")
+	}
+	canonical := serialize(p, -1)
+	if !bytes.Equal(canonical, serialize(p.Clone(), -1)) || !bytes.Equal(canonical, serialize(p, 0)) {
+		t.Fatalf("canonical serialization is not stable")
+	}
+}
+
+func TestSerializeForExecProgID(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$opt1(&(0x7f0000000000)=0x42)")
+	const id = 0x1234567890abcdef
+	decoded, buf := serializeAndDecode(t, p, ExecOpts{ProgID: id})
+	n := len(buf)
+	if instr, v := binary.LittleEndian.Uint64(buf), binary.LittleEndian.Uint64(buf[8:]); instr != ExecInstrProgID || v != id {
+		t.Fatalf("program starts with 0x%x 0x%x, want ExecInstrProgID 0x%x", instr, v, uint64(id))
+	}
+	if decoded.ProgID != id {
+		t.Fatalf("decoded program ID 0x%x, want 0x%x", decoded.ProgID, uint64(id))
+	}
+	checkExecEncoding(t, target, buf)
+	// The ID must be the first instruction.
+	exec := append([]byte{}, buf[16:n-8]...)
+	exec = append(exec, buf[:16]...)
+	exec = append(exec, buf[n-8:n]...)
+	if _, err := target.DeserializeExec(exec); err == nil {
+		t.Fatalf("no error for program ID after other instructions")
+	}
+}
+
+func TestSerializeForExecCsumLenChunk(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$csum_ipv4_udp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {0x0, \"abcd\"}})")
+	packet := p.Calls[0].Args[0].(*PointerArg).Res.(*GroupArg)
+	payload := packet.Inner[1].(*GroupArg).Inner[1].(*DataArg)
+	for _, size := range []int{2, 5, 100} {
+		payload.data = make([]byte, size)
+		decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+		var chunks []ExecCsumChunk
+		for _, copyin := range decoded.Calls[0].Copyin {
+			if csum, ok := copyin.Arg.(ExecArgCsum); ok && len(csum.Chunks) > 1 {
+				chunks = csum.Chunks
+			}
+		}
+		if len(chunks) != 5 {
+			t.Fatalf("size %v: no pseudo header checksum: %+v", size, decoded.Calls[0].Copyin)
+		}
+		// The UDP packet is 2-byte checksum and the payload.
+		want := ExecCsumChunk{ExecArgCsumChunkConst, uint64(swap16(uint16(2 + size))), 2}
+		if chunks[3] != want {
+			t.Errorf("size %v: got length chunk %+v, want %+v", size, chunks[3], want)
+		}
+	}
+}
+
+func TestSerializeForExecNonResourceReturn(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	defer overrideDebug(false)()
+	p := parseProg(t, target, "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)\nsyz_test$res1(0xffff)")
+	// Pretend that a mutation made the resource reference return of a void call.
+	res := p.Calls[1].Args[0].(*ResultArg)
+	p.Calls[1].Args[0] = MakeResultArg(res.Type(), p.Calls[0].Ret, 0xffff)
+	if !isUsed(p.Calls[0].Ret) {
+		t.Fatalf("return value is not marked as used")
+	}
+	decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+	if got := decoded.Calls[0].Index; got != ExecNoCopyout {
+		t.Errorf("void call has copyout index %v", got)
+	}
+	var want ExecArg = ExecArgConst{Size: 4, Value: 0xffff}
+	if got := decoded.Calls[1].Args[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got result arg %+v, want %+v", got, want)
+	}
+}
+
+func TestSerializeForExecSizeWidth(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		prog  string
+		width uint64
+		fits  bool
+	}{
+		{"syz_test$hint_data(&(0x7f0000000000)=\"0102030405\")", 2, true},
+		{"syz_test$length13(&(0x7f0000000000)={0x1, 0x2, [0x3, 0x4]}, &(0x7f0000001000)=0x10)", 2, true},
+		{"syz_test$csum_ipv4_udp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {0x0, \"abcd\"}})", 4, true},
+		{"syz_test$hint_data(&(0x7f0000000000)=\"" + strings.Repeat("ab", 0x10000) + "\")", 2, false},
+		{"syz_test$hint_data(&(0x7f0000000000)=\"" + strings.Repeat("ab", 0x10000) + "\")", 4, true},
+	}
+	for i, test := range tests {
+		p := parseProg(t, target, test.prog)
+		opts := ExecOpts{SizeWidth: test.width}
+		if !test.fits {
+			if _, err := p.SerializeForExecOpts(make([]byte, ExecBufferSize), 0, opts); err == nil {
+				t.Errorf("#%v: no error for a size that does not fit", i)
+			}
+			continue
+		}
+		got, buf := serializeAndDecode(t, p, opts)
+		if instr, v := binary.LittleEndian.Uint64(buf), binary.LittleEndian.Uint64(buf[8:]); instr != ExecInstrSizeWidth || v != test.width {
+			t.Fatalf("#%v: program starts with 0x%x 0x%x, want ExecInstrSizeWidth %v", i, instr, v, test.width)
+		}
+		want, buf1 := serializeAndDecode(t, p, ExecOpts{})
+		if n, n1 := len(buf), len(buf1); n-16 >= n1 {
+			t.Errorf("#%v: narrow program has %v bytes, default program has %v bytes", i, n, n1)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("#%v: decoded program differs:\n%+v\nwant:\n%+v", i, got, want)
+		}
+	}
+}
+
+func TestCopyoutSource(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p := parseProg(t, target, `r0 = socket(0x2, 0x1, 0x0)
+pipe(&(0x7f0000000000)={<r1=>0xffffffffffffffff, <r2=>0xffffffffffffffff})
+r3 = dup(r1)
+dup2(r0, r2)
+close(r3)
+`)
+	fds := p.Calls[1].Args[0].(*PointerArg).Res.(*GroupArg).Inner
+	want := []struct {
+		call int
+		arg  Arg
+	}{
+		{0, p.Calls[0].Ret},
+		{1, fds[0]},
+		{1, fds[1]},
+		{2, p.Calls[2].Ret},
+	}
+	decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+	if decoded.NumVars != uint64(len(want)) {
+		t.Fatalf("program has %v copyouts, want %v", decoded.NumVars, len(want))
+	}
+	for idx, w := range want {
+		call, arg, ok := p.CopyoutSource(0, uint64(idx))
+		if !ok || call != w.call || arg != w.arg {
+			t.Errorf("copyout %v: got call %v arg %p ok %v, want call %v arg %p",
+				idx, call, arg, ok, w.call, w.arg)
+		}
+	}
+	if _, _, ok := p.CopyoutSource(0, uint64(len(want))); ok {
+		t.Errorf("found source of a non-existent copyout")
+	}
+}
+
+func TestSerializeForExecResetMemory(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$opt1(&(0x7f0000000000)=0x42)")
+	decoded, data := serializeAndDecode(t, p, ExecOpts{ResetMemory: true})
+	if instr := binary.LittleEndian.Uint64(data); instr != ExecInstrReset {
+		t.Fatalf("program starts with 0x%x, want ExecInstrReset", instr)
+	}
+	if !decoded.Reset {
+		t.Fatalf("decoded program has no memory reset")
+	}
+	checkExecEncoding(t, target, data)
+	n := len(data)
+	if !bytes.Equal(data[8:], serializeForExec(t, p, ExecOpts{})) {
+		t.Fatalf("program differs from the program without reset")
+	}
+	// The reset must precede copyins and calls.
+	exec := append([]byte{}, data[8:n-8]...)
+	exec = append(exec, data[:8]...)
+	exec = append(exec, data[n-8:]...)
+	if _, err := target.DeserializeExec(exec); err == nil {
+		t.Fatalf("no error for memory reset after other instructions")
+	}
+}
+
+func TestSerializeForExecAssumeZeroedArena(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, `
+syz_test$array1(&(0x7f0000000000)={0x0, "0102030405"})
+syz_test$array1(&(0x7f0000001000)={0x42, "0000000000"})
+syz_test$array1(&(0x7f0000000000)={0x0, "0000000000"})
+`)
+	decoded, data := serializeAndDecode(t, p, ExecOpts{AssumeZeroedArena: true})
+	// Zeros are not written to fresh memory, but are written to memory used by previous calls.
+	want := [][]uint64{
+		{0x6400001},
+		{0x6401000},
+		{0x6400000, 0x6400001},
+	}
+	for i, call := range decoded.Calls {
+		var addrs []uint64
+		for _, copyin := range call.Copyin {
+			addrs = append(addrs, copyin.Addr)
+		}
+		if !reflect.DeepEqual(addrs, want[i]) {
+			t.Errorf("call %v: copyins to 0x%x, want 0x%x", i, addrs, want[i])
+		}
+	}
+	if n, n1 := len(data), len(serializeForExec(t, p, ExecOpts{})); n1 <= n {
+		t.Fatalf("program without the option is not larger: %v vs %v", n1, n)
+	}
+}
+
+func TestSerializeForExecCallHash(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, `
+syz_test$union0(&(0x7f0000000000)={0x1, @f2=0x2})
+syz_test$union0(&(0x7f0000001000)={0x3, @f2=0x4})
+syz_test$union0(&(0x7f0000000000)={0x1, @f0=0x2})
+syz_test$opt1(0x0)
+syz_test$opt1(&(0x7f0000000000)=0x1)
+`)
+	decoded, data := serializeAndDecode(t, p, ExecOpts{EmitCallHash: true})
+	checkExecEncoding(t, target, data)
+	var hashes []uint64
+	for i, call := range decoded.Calls {
+		if !call.HasHash || call.Hash != CallHash(p.Calls[i]) {
+			t.Fatalf("call %v: hash 0x%x (%v), want 0x%x", i, call.Hash, call.HasHash, CallHash(p.Calls[i]))
+		}
+		hashes = append(hashes, call.Hash)
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("calls that differ only in values have different hashes")
+	}
+	for i := 1; i < len(hashes); i++ {
+		for j := i + 1; j < len(hashes); j++ {
+			if hashes[i] == hashes[j] {
+				t.Errorf("calls %v and %v of different shapes have the same hash", i, j)
+			}
+		}
+	}
+}
+
+func TestSerializeForExecCallAttrs(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	id := uint64(target.SyscallMap["syz_test"].ID)
+	tests := []struct {
+		name string
+		set  func(c *Call) // sets the attribute on the second call
+		opts ExecOpts      // enables emission of the attribute
+		get  func(c ExecCall) interface{}
+		want interface{}
+		asm  string     // the attribute in the disassembly of the second call
+		bad  [][]uint64 // programs that must fail to decode
+	}{
+		{
+			name: "async",
+			set:  func(c *Call) { c.Async = true },
+			opts: ExecOpts{AsyncCalls: true},
+			get:  func(c ExecCall) interface{} { return c.Async },
+			want: true,
+			asm:  " async=1\n",
+		},
+		{
+			name: "fail_nth",
+			set:  func(c *Call) { c.FailNth = 3 },
+			opts: ExecOpts{EmitFailNth: true},
+			get:  func(c ExecCall) interface{} { return c.FailNth },
+			want: 3,
+			asm:  " fail_nth=3\n",
+			bad: [][]uint64{
+				{ExecInstrFailNth, 0, id, ExecNoCopyout, 0, ExecInstrEOF},
+				{ExecInstrFailNth, 1, ExecInstrFailNth, 2, id, ExecNoCopyout, 0, ExecInstrEOF},
+			},
+		},
+		{
+			name: "timeout",
+			set: func(c *Call) {
+				// Don't modify the shared syscall descriptions.
+				meta := *c.Meta
+				meta.Timeout = 500
+				c.Meta = &meta
+			},
+			opts: ExecOpts{EmitCallTimeout: true},
+			get:  func(c ExecCall) interface{} { return c.Timeout },
+			want: uint64(500),
+			asm:  " timeout=500\n",
+			bad: [][]uint64{
+				{ExecInstrCallTimeout, 0, id, ExecNoCopyout, 0, ExecInstrEOF},
+				{ExecInstrCallTimeout, 1, ExecInstrCallTimeout, 1, id, ExecNoCopyout, 0, ExecInstrEOF},
+			},
+		},
+		{
+			name: "props",
+			set:  func(c *Call) { c.Props = CallProps{CollideGroup: 3, Sandbox: ExecSandboxSetuid} },
+			opts: ExecOpts{EmitCallProps: true},
+			get:  func(c ExecCall) interface{} { return c.Props },
+			want: []ExecCallProp{{ExecCallPropCollideGroup, 3}, {ExecCallPropSandbox, ExecSandboxSetuid}},
+			asm:  " collide_group=3 sandbox=2\n",
+			bad: [][]uint64{
+				{ExecInstrCallProps, 0, ExecInstrCallProps, 0, id, ExecNoCopyout, 0, ExecInstrEOF},
+				{ExecInstrCallProps, 2, 1, 1, 1, 2, id, ExecNoCopyout, 0, ExecInstrEOF},
+				{ExecInstrCallProps, 2, 2, 1, 1, 2, id, ExecNoCopyout, 0, ExecInstrEOF},
+				{ExecInstrCallProps, 1 << 40, id, ExecNoCopyout, 0, ExecInstrEOF},
+			},
+		},
+		{
+			name: "rerun",
+			set:  func(c *Call) { c.Repeat = 3 },
+			opts: ExecOpts{EmitCallProps: true},
+			get:  func(c ExecCall) interface{} { return c.Props },
+			want: []ExecCallProp{{ExecCallPropRerun, 3}},
+			asm:  " rerun=3\n",
+		},
+	}
+	for _, test := range tests {
+		p := parseProg(t, target, "syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)\nsyz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)")
+		test.set(p.Calls[1])
+		decoded, data := serializeAndDecode(t, p, ExecOpts{})
+		noAttr := test.get(decoded.Calls[0])
+		if got := test.get(decoded.Calls[1]); !reflect.DeepEqual(got, noAttr) {
+			t.Fatalf("%v: attribute is emitted by default: %v", test.name, got)
+		}
+		decoded, data = serializeAndDecode(t, p, test.opts)
+		if !bytes.Equal(serializeForExec(t, p.Clone(), test.opts), data) {
+			t.Fatalf("%v: Clone does not preserve the attribute", test.name)
+		}
+		if got := test.get(decoded.Calls[1]); reflect.DeepEqual(got, noAttr) ||
+			fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Fatalf("%v: decoded %v, want %v", test.name, got, test.want)
+		}
+		if got := test.get(decoded.Calls[0]); !reflect.DeepEqual(got, noAttr) {
+			t.Fatalf("%v: attribute of the first call is %v", test.name, got)
+		}
+		if text := checkExecEncoding(t, target, data); !strings.Contains(text, test.asm) {
+			t.Fatalf("%v: no %q in assembly:\n%v", test.name, test.asm, text)
+		}
+		checkBadExec(t, target, test.bad)
+	}
+}
+
+func TestSerializeForExecAsyncResults(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\nsyz_test$res1(r0)\n")
+	serializeForExec(t, p, ExecOpts{AsyncCalls: true})
+	// Results of async calls are not known to the following calls.
+	p.Calls[0].Async = true
+	_, err := p.SerializeForExecOpts(make([]byte, ExecBufferSize), 0, ExecOpts{AsyncCalls: true})
+	if err == nil || !strings.Contains(err.Error(), "async") {
+		t.Fatalf("no error for use of async call result: %v", err)
+	}
+	serializeForExec(t, p, ExecOpts{})
+}
+
+func TestExecCallPropsUnknown(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	// Unknown keys are preserved, so that programs for newer executors can be inspected.
+	id := uint64(target.SyscallMap["syz_test"].ID)
+	data := execWords(ExecInstrCallProps, 2, ExecCallPropSandbox, 3, 100, 4, id, ExecNoCopyout, 0, ExecInstrEOF)
+	if text := checkExecEncoding(t, target, data); !strings.Contains(text, " sandbox=3 prop_100=4\n") {
+		t.Fatalf("bad assembly of unknown call props:\n%v", text)
+	}
+}
+
+func TestSerializeForExecTruncateOnOverflow(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, `
+r0 = syz_test$res0()
+syz_test$array1(&(0x7f0000000000)={0x42, "0102030405"})
+syz_test$res1(r0)
+`)
+	full, data := serializeAndDecode(t, p, ExecOpts{})
+	n := len(data)
+	opts := ExecOpts{TruncateOnOverflow: true}
+	for size := 0; size <= n; size++ {
+		// The expected result is the longest prefix of complete calls that fits.
+		var want []byte
+		for ncalls := 0; ncalls <= len(full.Calls); ncalls++ {
+			prefix := ExecProg{Calls: full.Calls[:ncalls]}.encode()
+			if len(prefix) <= size {
+				want = prefix
+			}
+		}
+		small := make([]byte, size)
+		n1, err := p.SerializeForExecOpts(small, 0, opts)
+		switch {
+		case want == nil:
+			if _, ok := err.(*ExecBufferTooSmallError); !ok {
+				t.Fatalf("size %v: got %v, want ExecBufferTooSmallError", size, err)
+			}
+			continue
+		case size == n:
+			if err != nil {
+				t.Fatalf("size %v: got %v, want no error", size, err)
+			}
+		case err != ErrExecTruncated:
+			t.Fatalf("size %v: got %v, want ErrExecTruncated", size, err)
+		}
+		if !bytes.Equal(small[:n1], want) {
+			t.Fatalf("size %v: got program of %v bytes, want %v", size, n1, len(want))
+		}
+		if _, err := target.DeserializeExec(small[:n1]); err != nil {
+			t.Fatalf("size %v: truncated program is invalid: %v", size, err)
+		}
+	}
+}
+
+func TestSerializeForExecPersistentPointers(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, `
+syz_test$array1(&(0x7f0000000000)={0x42, "0102030405"})
+syz_test$array1(&(0x7f0000000000)={0x42, "0102030405"})
+syz_test$array1(&(0x7f0000001000)={0x42, "0102030405"})
+`)
+	opts := ExecOpts{PersistentPointers: make(map[Arg]bool)}
+	for _, c := range p.Calls {
+		opts.PersistentPointers[c.Args[0]] = true
+	}
+	decoded, _ := serializeAndDecode(t, p, opts)
+	// The second call uses the buffer left by the first one, the third one uses a different buffer.
+	for i, want := range []int{2, 0, 2} {
+		if got := len(decoded.Calls[i].Copyin); got != want {
+			t.Errorf("call %v has %v copyins, want %v", i, got, want)
+		}
+	}
+}
+
+func TestSerializeForExecHeader(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$opt1(&(0x7f0000000000)=0x42)")
+	opts, err := NegotiateExecFormat(ExecFormatVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.ArgByteOrder = true
+	opts.ProgID = 1
+	decoded, data := serializeAndDecode(t, p, opts)
+	header := ExecFormatMagic<<32 | ExecFormatVersion<<16 | ExecFlagArgByteOrder
+	instr, v := binary.LittleEndian.Uint64(data), binary.LittleEndian.Uint64(data[8:])
+	if instr != ExecInstrHeader || v != header {
+		t.Fatalf("program starts with 0x%x 0x%x, want header 0x%x", instr, v, header)
+	}
+	if decoded.Version != ExecFormatVersion || decoded.Flags != ExecFlagArgByteOrder || decoded.ProgID != 1 {
+		t.Fatalf("decoded version %v, flags 0x%x, program ID %v", decoded.Version, decoded.Flags, decoded.ProgID)
+	}
+	checkExecEncoding(t, target, data)
+	// Old executors get programs without the header.
+	opts, err = NegotiateExecFormat(0)
+	if err != nil || opts.EmitHeader {
+		t.Fatalf("bad options for old executor: %+v, %v", opts, err)
+	}
+	if _, err := NegotiateExecFormat(ExecFormatVersion + 1); err == nil {
+		t.Fatalf("no error for a newer executor")
+	}
+	for i, bad := range []uint64{
+		header + 1<<16,            // newer version
+		header ^ 1<<32,            // bad magic
+		header | execFlagsAll + 1, // unknown flag
+	} {
+		exec := append([]byte{}, data...)
+		binary.LittleEndian.PutUint64(exec[8:], bad)
+		if _, err := target.DeserializeExec(exec); err == nil {
+			t.Errorf("bad header #%v: no error", i)
+		}
+	}
+	// The header must be the first instruction.
+	exec := append([]byte{}, data[16:32]...)
+	exec = append(exec, data[:16]...)
+	exec = append(exec, data[32:]...)
+	if _, err := target.DeserializeExec(exec); err == nil {
+		t.Fatalf("no error for header after other instructions")
+	}
+}
+
+func TestSerializeForExecCsumOverflow(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$csum_ipv4_udp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {0x0, \"abcd\"}})")
+	for _, varint := range []bool{false, true} {
+		// Find offsets of the first checksum instruction. Instructions are passed
+		// to OnInstr when the next one starts, so the current position is their end.
+		buf := make([]byte, ExecBufferSize)
+		var w *execContext
+		csumStart, csumEnd, pos := -1, -1, 0
+		opts := ExecOpts{
+			EmitHeader: varint,
+			Varint:     varint,
+			OnInstr: func(kind uint64, words []uint64) {
+				end := len(buf) - len(w.buf)
+				if csumStart == -1 && kind == ExecInstrCopyin && words[2] == ExecArgTypeCsum {
+					csumStart, csumEnd = pos, end
+				}
+				pos = end
+			},
+		}
+		w = newExecContext(target, buf, opts)
+		if err := w.serializeProg(p, 0); err != nil {
+			t.Fatal(err)
+		}
+		w.writeEOF()
+		if csumStart == -1 {
+			t.Fatalf("no checksum instruction")
+		}
+		opts.OnInstr = nil
+		for size := csumStart; size < csumEnd; size++ {
+			buf := bytes.Repeat([]byte{0xab}, size+8)
+			_, err := p.SerializeForExecOpts(buf[:size], 0, opts)
+			if _, ok := err.(*ExecBufferTooSmallError); !ok {
+				t.Fatalf("varint=%v size %v: got %v, want ExecBufferTooSmallError", varint, size, err)
+			}
+			if !bytes.Equal(buf[csumStart:], bytes.Repeat([]byte{0xab}, len(buf)-csumStart)) {
+				t.Fatalf("varint=%v size %v: partial checksum instruction is written", varint, size)
+			}
+		}
+	}
+}
+
+func TestMergeForExec(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	text := `r0 = socket(0x2, 0x1, 0x0)
+pipe(&(0x7f0000000000)={<r1=>0xffffffffffffffff, <r2=>0xffffffffffffffff})
+write(r1, &(0x7f0000001000)="0102", 0x2)
+dup2(r0, r2)
+`
+	a, b := parseProg(t, target, text), parseProg(t, target, text)
+	buf := make([]byte, ExecBufferSize)
+	n, err := MergeForExec(buf, a, b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := target.DeserializeExec(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Calls) != len(a.Calls)+len(b.Calls) {
+		t.Fatalf("merged program has %v calls, want %v", len(decoded.Calls), len(a.Calls)+len(b.Calls))
+	}
+	// a uses 2 pages, so b must start at page 2.
+	boundary := target.DataOffset + 2*target.PageSize
+	copyouts := make(map[uint64]int)
+	for i, c := range decoded.Calls {
+		second := i >= len(a.Calls)
+		var addrs []uint64
+		for _, copyin := range c.Copyin {
+			addrs = append(addrs, copyin.Addr)
+		}
+		for _, copyout := range c.Copyout {
+			addrs = append(addrs, copyout.Addr)
+			copyouts[copyout.Index]++
+		}
+		for _, addr := range addrs {
+			if (addr >= boundary) != second {
+				t.Errorf("call %v: address 0x%x is on the wrong side of 0x%x", i, addr, boundary)
+			}
+		}
+		if c.Index != ExecNoCopyout {
+			copyouts[c.Index]++
+		}
+		for _, arg := range c.Args {
+			if res, ok := arg.(ExecArgResult); ok && (res.Index >= 3) != second {
+				t.Errorf("call %v: references copyout %v of the other program", i, res.Index)
+			}
+		}
+	}
+	if len(copyouts) != 6 || decoded.NumVars != 6 {
+		t.Errorf("got copyouts %v, NumVars %v, want 6 distinct indices", copyouts, decoded.NumVars)
+	}
+	for idx, count := range copyouts {
+		if count != 1 {
+			t.Errorf("copyout index %v is used %v times", idx, count)
+		}
+	}
+}
+
+func TestSerializeForExecConstOverflow(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$int(0x0, 0x0, 0x1ffff, 0x0, 0x0)")
+	decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+	var want ExecArg = ExecArgConst{Size: 2, Value: 0xffff}
+	if got := decoded.Calls[0].Args[2]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got arg %+v, want %+v", got, want)
+	}
+}
+
+func TestSerializeForExecArgBlock(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	defer overrideDebug(false)()
+	// Synthesize an 8-arg syscall, there are no such syscalls in descriptions.
+	meta := *target.SyscallMap["syz_test$int"]
+	typ := meta.Args[4]
+	meta.Args = nil
+	c := &Call{Meta: &meta, Ret: MakeReturnArg(nil)}
+	for i := 0; i < 8; i++ {
+		meta.Args = append(meta.Args, typ)
+		c.Args = append(c.Args, MakeConstArg(typ, uint64(i+1)))
+	}
+	p := &Prog{Target: target, Calls: []*Call{c}}
+	target.ExecRegArgs = func(c *Syscall) int {
+		if c == &meta {
+			return 6
+		}
+		return 1 << 10
+	}
+	defer func() { target.ExecRegArgs = nil }()
+	decoded, data := serializeAndDecode(t, p, ExecOpts{})
+	var want []ExecArg
+	for i := 0; i < 6; i++ {
+		want = append(want, ExecArgConst{Size: 8, Value: uint64(i + 1)})
+	}
+	want = append(want, ExecArgBlock{Args: []ExecArg{
+		ExecArgConst{Size: 8, Value: 7},
+		ExecArgConst{Size: 8, Value: 8},
+	}})
+	if got := decoded.Calls[0].Args; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got args:\n%+v\nwant:\n%+v", got, want)
+	}
+	checkExecEncoding(t, target, data)
+	data, err := p.SerializeForExecJSON(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedJSON, err := target.DeserializeExecJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodedJSON, decoded) {
+		t.Fatalf("JSON program differs:\n%+v\nwant:\n%+v", decodedJSON, decoded)
+	}
+}
+
+func TestSerializeForExecAlignCalls(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	buf1 := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		pos, calls := 0, 0
+		opts := ExecOpts{
+			AlignCalls: 64,
+			OnInstr: func(kind uint64, words []uint64) {
+				if kind < uint64(len(target.Syscalls)) {
+					calls++
+					if pos%64 != 0 {
+						t.Fatalf("call %v starts at offset %v", target.Syscalls[kind].Name, pos)
+					}
+				}
+				pos += len(words) * 8
+			},
+		}
+		n, err := p.SerializeForExecOpts(buf, i%16, opts)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		if pos != n || calls != len(p.Calls) {
+			t.Fatalf("seen %v bytes and %v calls, program has %v bytes and %v calls",
+				pos, calls, n, len(p.Calls))
+		}
+		n1, err := p.SerializeForExec(buf1, i%16)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		got, err := target.DeserializeExec(buf[:n])
+		if err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		want, err := target.DeserializeExec(buf1[:n1])
+		if err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("aligned program differs from the original:\n%s", p.Serialize())
+		}
+	}
+}
+
+func TestExecOrderChecker(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p := parseProg(t, target, `pipe(&(0x7f0000000000)={<r0=>0xffffffffffffffff, <r1=>0xffffffffffffffff})
+write(r0, &(0x7f0000000000)="0102", 0x2)
+`)
+	instrs, err := p.SerializeForExecInstrs(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkExecOrder(instrs); err != nil {
+		t.Fatalf("error for the original order: %v", err)
+	}
+	// Emulate an option that emits copyins of the next call before copyouts.
+	var copyouts, reordered []ExecInstr
+	for _, instr := range instrs {
+		switch {
+		case instr.Kind == ExecInstrCopyout:
+			copyouts = append(copyouts, instr)
+		case instr.Kind == uint64(target.SyscallMap["write"].ID):
+			reordered = append(reordered, copyouts...)
+			fallthrough
+		default:
+			reordered = append(reordered, instr)
+		}
+	}
+	if len(copyouts) != 1 {
+		t.Fatalf("program has %v copyouts, want 1", len(copyouts))
+	}
+	if err := checkExecOrder(reordered); err == nil {
+		t.Fatalf("no error for copyout after copyin of the next call")
+	}
+}
+
+func TestExecOrderCheckerCsums(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "syz_test$csum_ipv4_tcp(&(0x7f0000000000)={{0x0, 0x1, 0x2}, {{0x0}, \"abcd\"}})")
+	instrs, err := p.SerializeForExecInstrs(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkExecOrder(instrs); err != nil {
+		t.Fatalf("error for the original order: %v", err)
+	}
+	// Move the first checksum before the data copyins.
+	for i, instr := range instrs {
+		if instr.Kind == ExecInstrCopyin && instr.Words[2] == ExecArgTypeCsum {
+			reordered := append([]ExecInstr{instr}, instrs[:i]...)
+			reordered = append(reordered, instrs[i+1:]...)
+			if err := checkExecOrder(reordered); err == nil || !strings.Contains(err.Error(), "follows checksum") {
+				t.Fatalf("want checksum order error, got %v", err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no checksum instructions")
+}
+
+func TestSerializeForExecValidate(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	buf1 := make([]byte, ExecBufferSize)
+	opts := ExecOpts{Validate: true, CaptureAllReturns: true, CopyoutData: true}
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		// Generated programs may legitimately overlap or cross the end of the data region,
+		// but validation must not affect the stream.
+		n, err := p.SerializeForExecOpts(buf, i%16, opts)
+		if err != nil {
+			if _, ok := err.(*ExecValidationError); !ok {
+				t.Fatalf("program:\n%s\nfailed to serialize: %v", p.Serialize(), err)
+			}
+			continue
+		}
+		opts1 := opts
+		opts1.Validate = false
+		n1, err := p.SerializeForExecOpts(buf1, i%16, opts1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], buf1[:n1]) {
+			t.Fatalf("program:\n%s\nvalidation changed the stream", p.Serialize())
+		}
+	}
+}
+
+func TestSerializeForExecValidateErrors(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		prog string
+		err  *ExecValidationError
+	}{
+		{
+			"syz_test$length13(&(0x7f0000000000)={0x1, 0x2, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, " +
+				"&(0x7f0000000000+0x100)=0x30)",
+			nil,
+		},
+		{
+			// The len arg is written over f1 of the struct with a different value.
+			"syz_test$length13(&(0x7f0000000000)={0x1, 0x2, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, " +
+				"&(0x7f0000000000+0x8)=0x30)",
+			&ExecValidationError{0, "syz_test$length13", "len",
+				"copyin to [0x6400008, +8) overlaps copyin of int64 to [0x6400008, +8)"},
+		},
+		{
+			// The same, but the values match, so there is no conflict.
+			"syz_test$length13(&(0x7f0000000000)={0x1, 0x30, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, " +
+				"&(0x7f0000000000+0x8)=0x30)",
+			nil,
+		},
+		{
+			// The len arg partially overlaps f0 and f1.
+			"syz_test$length13(&(0x7f0000000000)={0x1, 0x2, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, " +
+				"&(0x7f0000000000+0x4)=0x30)",
+			&ExecValidationError{0, "syz_test$length13", "len",
+				"copyin to [0x6400004, +8) overlaps copyin of int64 to [0x6400000, +8)"},
+		},
+		{
+			// The array crosses the end of the data region, its first element
+			// outside of the region is reported.
+			"syz_test$length13(&(0x7f0000000000)={0x1, 0x2, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, " +
+				"&(0x7f0000000000+0x100)=0x30)\n" +
+				"syz_test$length13(&(0x7f0000fff000+0xfe0)={0x1, 0x2, [0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0]}, " +
+				"&(0x7f0000000000+0x100)=0x30)",
+			&ExecValidationError{1, "syz_test$length13", "int32",
+				"copyin to [0x7400000, +4) is outside of data region [0x6400000, +0x1000000)"},
+		},
+	}
+	buf := make([]byte, ExecBufferSize)
+	for i, test := range tests {
+		p := parseProg(t, target, test.prog)
+		// Such programs are fine by default.
+		serializeForExec(t, p, ExecOpts{})
+		_, err := p.SerializeForExecOpts(buf, 0, ExecOpts{Validate: true})
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("test #%v: %v", i, err)
+			}
+			continue
+		}
+		if verr, ok := err.(*ExecValidationError); !ok || *verr != *test.err {
+			t.Errorf("test #%v: got error %#v, want %#v", i, err, test.err)
+		}
+	}
+}
+
+func TestSerializeForExecCopyoutData(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\n"+
+		"serialize1(&(0x7f0000000000)=\"\"/16, 0x10)\n"+
+		"syz_test$res1(r0)\n"+
+		"serialize1(&(0x7f0000001000)=\"\"/0, 0x0)\n")
+	decoded, _ := serializeAndDecode(t, p, ExecOpts{})
+	if len(decoded.Calls[1].CopyoutData) != 0 {
+		t.Fatalf("data copyout is emitted by default")
+	}
+	decoded, data := serializeAndDecode(t, p, ExecOpts{CopyoutData: true, Validate: true})
+	// Data copyouts share indices with results, the empty buffer is not copied out.
+	want := []ExecCopyout{{Index: 1, Addr: target.DataOffset, Size: 16}}
+	if got := decoded.Calls[1].CopyoutData; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got data copyouts %+v, want %+v", got, want)
+	}
+	if decoded.Calls[0].Index != 0 || len(decoded.Calls[3].CopyoutData) != 0 || decoded.NumVars != 2 {
+		t.Fatalf("bad copyout indices: %+v", decoded)
+	}
+	args, err := p.CopyoutDataArgs(0, ExecOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1 || args[1] != p.Calls[1].Args[0].(*PointerArg).Res {
+		t.Fatalf("bad data copyout args %v", args)
+	}
+	if text := checkExecEncoding(t, target, data); !strings.Contains(text, "copyout_data 1 0x") {
+		t.Fatalf("no data copyout in assembly:\n%v", text)
+	}
+	json, err := p.SerializeForExecJSON(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.DeserializeExecJSON(json); err != nil {
+		t.Fatal(err)
+	}
+	id := uint64(target.SyscallMap["syz_test"].ID)
+	checkBadExec(t, target, [][]uint64{
+		{ExecInstrCopyoutData, 0, 0, 8, ExecInstrEOF},
+		{id, ExecNoCopyout, 0, ExecInstrCopyoutData, 0, 0, 8, ExecInstrCopyout, 1, 0, 8, ExecInstrEOF},
+	})
+}
+
+func TestSerializeForExecCopyoutOnSuccess(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p := parseProg(t, target, "pipe(&(0x7f0000000000)={<r0=>0xffffffffffffffff, <r1=>0xffffffffffffffff})\n"+
+		"close(r0)\nclose(r1)\n")
+	buf := make([]byte, ExecBufferSize)
+	if _, err := p.SerializeForExecOpts(buf, 0, ExecOpts{CopyoutOnSuccess: true}); err == nil {
+		t.Fatalf("no error without header")
+	}
+	exec, data := serializeAndDecode(t, p, ExecOpts{CopyoutOnSuccess: true, EmitHeader: true})
+	if exec.Flags&ExecFlagCopyoutOnSuccess == 0 {
+		t.Fatalf("no header flag")
+	}
+	copyouts := exec.Calls[0].Copyout
+	if len(copyouts) != 2 || !copyouts[0].OnSuccess || !copyouts[1].OnSuccess || copyouts[0].Size != 4 {
+		t.Fatalf("bad copyouts %+v", copyouts)
+	}
+	for i, call := range exec.Calls[1:] {
+		res, ok := call.Args[0].(ExecArgResult)
+		if !ok || res.Index != uint64(i) || res.Default != 0xffffffffffffffff {
+			t.Fatalf("bad result arg %+v", call.Args[0])
+		}
+	}
+	text := checkExecEncoding(t, target, data)
+	if !strings.Contains(text, " 4 on_success=1\n") || !strings.Contains(text, " default=0xffffffffffffffff") {
+		t.Fatalf("no on_success copyout or result default in assembly:\n%v", text)
+	}
+	// Without the header flag the copyout flag is an error.
+	exec, _ = serializeAndDecode(t, p, ExecOpts{})
+	if exec.Calls[0].Copyout[0].OnSuccess || exec.Calls[1].Args[0].(ExecArgResult).Default != 0 {
+		t.Fatalf("copyout on success is emitted by default")
+	}
+	exec.Calls[0].Copyout[0].OnSuccess = true
+	if _, err := target.DeserializeExec(exec.encode()); err == nil {
+		t.Fatalf("no error for copyout on success without the header flag")
+	}
+}
+
+func TestSerializeForExecVarintTools(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p := parseProg(t, target, "r0 = syz_test$res0()\n"+
+		"syz_test$res1(r0)\n"+
+		"syz_test$array1(&(0x7f0000001000)={0x42, \"0102030405\"})\n"+
+		"syz_test$int(0x1, 0x2, 0x3, 0x4, 0x5)")
+	n := len(serializeForExec(t, p, ExecOpts{EmitHeader: true}))
+	data := serializeForExec(t, p, ExecOpts{EmitHeader: true, Varint: true})
+	if n1 := len(data); n1*2 > n {
+		t.Fatalf("compact program has %v bytes, the original has %v bytes", n1, n)
+	}
+	checkExecEncoding(t, target, data)
+	// The header is not varint-encoded, so that decoders can detect the encoding.
+	if word := binary.LittleEndian.Uint64(data); word != ExecInstrHeader {
+		t.Fatalf("program starts with 0x%x, want fixed-size ExecInstrHeader", word)
+	}
+	if header := binary.LittleEndian.Uint64(data[8:]); header&ExecFlagVarint == 0 {
+		t.Fatalf("no varint header flag: 0x%x", header)
+	}
+}
+
+func TestExecutorOpts(t *testing.T) {
+	target, rs, iters := initTest(t)
+	testTarget, err := GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := testTarget.ExecutorOpts(); opts.EmitHeader || opts.Varint {
+		t.Fatalf("test target uses non-default encoding: %+v", opts)
+	}
+	opts := target.ExecutorOpts()
+	if !opts.EmitHeader || !opts.Varint {
+		t.Fatalf("linux executor does not use varints: %+v", opts)
+	}
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		want, _ := serializeAndDecode(t, p, ExecOpts{})
+		got, data := serializeAndDecode(t, p, opts)
+		if got.Flags != ExecFlagVarint {
+			t.Fatalf("got header flags 0x%x, want ExecFlagVarint", got.Flags)
+		}
+		checkExecEncoding(t, target, data)
+		got.Version, got.Flags, got.varint = want.Version, want.Flags, want.varint
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("varint program differs from the original:\n%s", p.Serialize())
+		}
+	}
+}
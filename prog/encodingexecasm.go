@@ -0,0 +1,607 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This file implements textual assembly representation of the exec format
+// for manual crafting and review of exec programs. Each line is an instruction
+// in the same order as in the binary format, args of calls are on the following
+// lines indented with a tab (args of an arg block with 2 tabs), e.g.:
+//
+//	copyin 0x7f0000000000 const 8 0x1234
+//	copyin 0x7f0000000008 data 0102ab
+//	call syz_test$opt1 copyout=0
+//		const 8|ptr 0x0
+//		result 4 0 div=0x1 add=0x2
+//	copyout 1 0x7f0000000010 4
+//
+// Args are:
+//
+//	const SIZE VALUE [high=VALUE] [bitfield=OFFSET:LENGTH]
+//	result SIZE INDEX [div=VALUE] [add=VALUE] [default=VALUE]
+//	data HEX
+//	zdata SIZE HEX (zlib-compressed data of SIZE bytes)
+//	csum SIZE inet [data:ADDR:SIZE | const:VALUE:SIZE]...
+//	csum SIZE crc32 data:ADDR:SIZE POLY
+//	block
+//
+// SIZE of const and result args can have "|be" and "|ptr" suffixes
+// for ExecArgFlagBigEndian and ExecArgFlagPointer.
+// Other instructions are "header VERSION FLAGS", "prog_id ID", "reset", "fill ADDR SIZE VALUE",
+// "union ADDR INDEX", "expect_return VALUE" and "copyout_data INDEX ADDR SIZE". Copyouts have optional
+// "on_success=1" (ExecCopyoutFlagOnSuccess). Calls have optional
+// "copyout=INDEX", "repeat=COUNT", "hash=VALUE", "timeout=MS", "async=1" and "fail_nth=N", and call
+// properties "collide_group=N", "sandbox=N" and "prop_KEY=VALUE" (for unknown keys).
+// The final ExecInstrEOF is implicit.
+// Empty lines and lines starting with # are ignored.
+
+// DisassembleExec returns textual assembly of program exec produced by SerializeForExec.
+// Instructions that don't affect execution (e.g. ExecInstrNop) are not preserved.
+func (target *Target) DisassembleExec(exec []byte) (string, error) {
+	p, err := target.DeserializeExec(exec)
+	if err != nil {
+		return "", err
+	}
+	return p.asm(), nil
+}
+
+// ExecDump returns human-readable representation of program exec produced by SerializeForExec
+// for debugging. It is the same as DisassembleExec, but since there is no target,
+// calls are represented by their IDs (e.g. "call #42"). Errors are included in the output.
+func ExecDump(exec []byte) string {
+	dec := &execDecoder{data: exec}
+	dec.parse()
+	if dec.err != nil {
+		return fmt.Sprintf("malformed program: %v\n", dec.err)
+	}
+	return dec.prog().asm()
+}
+
+func (p ExecProg) asm() string {
+	buf := new(bytes.Buffer)
+	if p.Version != 0 {
+		fmt.Fprintf(buf, "header %v 0x%x\n", p.Version, p.Flags)
+	}
+	if p.ProgID != 0 {
+		fmt.Fprintf(buf, "prog_id 0x%x\n", p.ProgID)
+	}
+	if p.Reset {
+		fmt.Fprintf(buf, "reset\n")
+	}
+	for _, call := range p.Calls {
+		for _, copyin := range call.Copyin {
+			switch a := copyin.Arg.(type) {
+			case ExecArgFill:
+				fmt.Fprintf(buf, "fill 0x%x %v 0x%x\n", copyin.Addr, a.Size, a.Value)
+			case ExecArgUnionOption:
+				fmt.Fprintf(buf, "union 0x%x %v\n", copyin.Addr, a.Index)
+			default:
+				fmt.Fprintf(buf, "copyin 0x%x %v\n", copyin.Addr, execArgAsm(copyin.Arg))
+			}
+		}
+		fmt.Fprintf(buf, "call %v", call.Meta.Name)
+		if call.Index != ExecNoCopyout {
+			fmt.Fprintf(buf, " copyout=%v", call.Index)
+		}
+		if call.Repeat != 0 {
+			fmt.Fprintf(buf, " repeat=%v", call.Repeat)
+		}
+		if call.HasHash {
+			fmt.Fprintf(buf, " hash=0x%x", call.Hash)
+		}
+		if call.Timeout != 0 {
+			fmt.Fprintf(buf, " timeout=%v", call.Timeout)
+		}
+		if call.Async {
+			fmt.Fprintf(buf, " async=1")
+		}
+		if call.FailNth != 0 {
+			fmt.Fprintf(buf, " fail_nth=%v", call.FailNth)
+		}
+		for _, prop := range call.Props {
+			fmt.Fprintf(buf, " %v=%v", execCallPropAsm(prop.Key), prop.Value)
+		}
+		fmt.Fprintf(buf, "\n")
+		for _, arg := range call.Args {
+			fmt.Fprintf(buf, "\t%v\n", execArgAsm(arg))
+			if block, ok := arg.(ExecArgBlock); ok {
+				for _, arg1 := range block.Args {
+					fmt.Fprintf(buf, "\t\t%v\n", execArgAsm(arg1))
+				}
+			}
+		}
+		if call.HasExpectedRet {
+			fmt.Fprintf(buf, "expect_return 0x%x\n", call.ExpectedRet)
+		}
+		for _, copyout := range call.Copyout {
+			fmt.Fprintf(buf, "copyout %v 0x%x %v", copyout.Index, copyout.Addr, copyout.Size)
+			if copyout.OnSuccess {
+				fmt.Fprintf(buf, " on_success=1")
+			}
+			fmt.Fprintf(buf, "\n")
+		}
+		for _, copyout := range call.CopyoutData {
+			fmt.Fprintf(buf, "copyout_data %v 0x%x %v\n", copyout.Index, copyout.Addr, copyout.Size)
+		}
+	}
+	return buf.String()
+}
+
+func execArgAsm(arg ExecArg) string {
+	switch a := arg.(type) {
+	case ExecArgConst:
+		res := fmt.Sprintf("const %v 0x%x", execSizeAsm(a.Size), a.Value)
+		if a.ValueHigh != 0 {
+			res += fmt.Sprintf(" high=0x%x", a.ValueHigh)
+		}
+		if a.BitfieldOffset != 0 || a.BitfieldLength != 0 {
+			res += fmt.Sprintf(" bitfield=%v:%v", a.BitfieldOffset, a.BitfieldLength)
+		}
+		return res
+	case ExecArgResult:
+		res := fmt.Sprintf("result %v %v", execSizeAsm(a.Size), a.Index)
+		if a.DivOp != 0 {
+			res += fmt.Sprintf(" div=0x%x", a.DivOp)
+		}
+		if a.AddOp != 0 {
+			res += fmt.Sprintf(" add=0x%x", a.AddOp)
+		}
+		if a.Default != 0 {
+			res += fmt.Sprintf(" default=0x%x", a.Default)
+		}
+		return res
+	case ExecArgData:
+		if a.Compressed != nil {
+			return fmt.Sprintf("zdata %v %v", len(a.Data), hex.EncodeToString(a.Compressed))
+		}
+		if len(a.Data) == 0 {
+			return "data"
+		}
+		return "data " + hex.EncodeToString(a.Data)
+	case ExecArgCsum:
+		if a.Kind == ExecArgCsumCrc32 {
+			return fmt.Sprintf("csum %v crc32 data:0x%x:%v 0x%x", a.Size, a.Chunks[0].Value, a.Chunks[0].Size, a.Poly)
+		}
+		res := fmt.Sprintf("csum %v inet", a.Size)
+		for _, chunk := range a.Chunks {
+			kind := "data"
+			if chunk.Kind == ExecArgCsumChunkConst {
+				kind = "const"
+			}
+			res += fmt.Sprintf(" %v:0x%x:%v", kind, chunk.Value, chunk.Size)
+		}
+		return res
+	case ExecArgBlock:
+		return "block"
+	default:
+		panic(fmt.Sprintf("unknown exec arg %#v", arg))
+	}
+}
+
+func execSizeAsm(size uint64) string {
+	res := fmt.Sprint(size &^ (ExecArgFlagBigEndian | ExecArgFlagPointer))
+	if size&ExecArgFlagBigEndian != 0 {
+		res += "|be"
+	}
+	if size&ExecArgFlagPointer != 0 {
+		res += "|ptr"
+	}
+	return res
+}
+
+// AssembleExec converts textual assembly produced by DisassembleExec
+// (or written manually) into the exec format.
+func (target *Target) AssembleExec(text string) ([]byte, error) {
+	var p ExecProg
+	var call ExecCall
+	commit := func() {
+		if call.Meta != nil {
+			p.Calls = append(p.Calls, call)
+			call = ExecCall{}
+		}
+	}
+	for i, line := range strings.Split(text, "\n") {
+		depth := len(line) - len(strings.TrimLeft(line, "\t"))
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := target.assembleLine(&p, &call, commit, depth, fields); err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+	}
+	if call.Meta == nil && (len(call.Copyin) != 0 || call.Repeat != 0) {
+		return nil, fmt.Errorf("copyin after the last call")
+	}
+	commit()
+	p.bigEndian = target.BigEndian
+	p.varint = p.Flags&ExecFlagVarint != 0
+	exec := p.encode()
+	// Reuse checks of the decoder.
+	if _, err := target.DeserializeExec(exec); err != nil {
+		return nil, err
+	}
+	return exec, nil
+}
+
+func (target *Target) assembleLine(p *ExecProg, call *ExecCall, commit func(), depth int, fields []string) error {
+	if depth != 0 {
+		if call.Meta == nil || len(call.Copyout) != 0 || len(call.CopyoutData) != 0 || call.HasExpectedRet {
+			return fmt.Errorf("arg does not follow a call")
+		}
+		arg, err := parseExecArgAsm(fields)
+		if err != nil {
+			return err
+		}
+		switch depth {
+		case 1:
+			call.Args = append(call.Args, arg)
+		case 2:
+			if len(call.Args) == 0 {
+				return fmt.Errorf("arg does not follow a block")
+			}
+			block, ok := call.Args[len(call.Args)-1].(ExecArgBlock)
+			if !ok {
+				return fmt.Errorf("arg does not follow a block")
+			}
+			block.Args = append(block.Args, arg)
+			call.Args[len(call.Args)-1] = block
+		default:
+			return fmt.Errorf("bad indentation")
+		}
+		return nil
+	}
+	instr, args := fields[0], fields[1:]
+	nums, err := parseAsmNums(args)
+	switch instr {
+	case "prog_id", "expect_return":
+		if err != nil || len(nums) != 1 {
+			return fmt.Errorf("%v wants 1 number", instr)
+		}
+		if instr == "prog_id" {
+			p.ProgID = nums[0]
+			return nil
+		}
+		if call.Meta == nil {
+			return fmt.Errorf("expected return does not follow a call")
+		}
+		call.HasExpectedRet = true
+		call.ExpectedRet = nums[0]
+	case "header":
+		if err != nil || len(nums) != 2 {
+			return fmt.Errorf("header wants version and flags")
+		}
+		p.Version, p.Flags = nums[0], nums[1]
+	case "reset":
+		if len(args) != 0 {
+			return fmt.Errorf("reset has no arguments")
+		}
+		p.Reset = true
+	case "copyin":
+		if len(args) < 2 {
+			return fmt.Errorf("copyin wants address and arg")
+		}
+		addr, err := strconv.ParseUint(args[0], 0, 64)
+		if err != nil {
+			return err
+		}
+		arg, err := parseExecArgAsm(args[1:])
+		if err != nil {
+			return err
+		}
+		commit()
+		call.Copyin = append(call.Copyin, ExecCopyin{Addr: addr, Arg: arg})
+	case "fill":
+		if err != nil || len(nums) != 3 {
+			return fmt.Errorf("fill wants 3 numbers")
+		}
+		commit()
+		call.Copyin = append(call.Copyin, ExecCopyin{Addr: nums[0], Arg: ExecArgFill{Size: nums[1], Value: nums[2]}})
+	case "union":
+		if err != nil || len(nums) != 2 {
+			return fmt.Errorf("union wants 2 numbers")
+		}
+		commit()
+		call.Copyin = append(call.Copyin, ExecCopyin{Addr: nums[0], Arg: ExecArgUnionOption{Index: nums[1]}})
+	case "call":
+		if len(args) == 0 {
+			return fmt.Errorf("call wants syscall name")
+		}
+		commit()
+		call.Meta = target.SyscallMap[args[0]]
+		if call.Meta == nil {
+			return fmt.Errorf("unknown syscall %v", args[0])
+		}
+		call.Index = ExecNoCopyout
+		fields, props, err := parseAsmCallProps(args[1:])
+		if err != nil {
+			return err
+		}
+		call.Props = props
+		opts, err := parseAsmOpts(fields, "copyout", "repeat", "hash", "timeout", "async", "fail_nth")
+		if err != nil {
+			return err
+		}
+		if v, ok := opts["copyout"]; ok {
+			call.Index = v
+		}
+		call.Repeat = opts["repeat"]
+		call.Hash, call.HasHash = opts["hash"]
+		call.Timeout = opts["timeout"]
+		call.Async = opts["async"] != 0
+		call.FailNth = opts["fail_nth"]
+	case "copyout":
+		if len(args) < 3 {
+			return fmt.Errorf("copyout wants 3 numbers")
+		}
+		nums, err := parseAsmNums(args[:3])
+		if err != nil {
+			return fmt.Errorf("copyout wants 3 numbers")
+		}
+		opts, err := parseAsmOpts(args[3:], "on_success")
+		if err != nil {
+			return err
+		}
+		if call.Meta == nil {
+			return fmt.Errorf("copyout does not follow a call")
+		}
+		call.Copyout = append(call.Copyout, ExecCopyout{Index: nums[0], Addr: nums[1], Size: nums[2],
+			OnSuccess: opts["on_success"] != 0})
+	case "copyout_data":
+		if err != nil || len(nums) != 3 {
+			return fmt.Errorf("copyout_data wants 3 numbers")
+		}
+		if call.Meta == nil {
+			return fmt.Errorf("copyout_data does not follow a call")
+		}
+		call.CopyoutData = append(call.CopyoutData, ExecCopyout{Index: nums[0], Addr: nums[1], Size: nums[2]})
+	default:
+		return fmt.Errorf("unknown instruction %q", instr)
+	}
+	return nil
+}
+
+func parseExecArgAsm(fields []string) (ExecArg, error) {
+	typ, args := fields[0], fields[1:]
+	switch typ {
+	case "const", "result":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%v wants size and value", typ)
+		}
+		size, err := parseExecSizeAsm(args[0])
+		if err != nil {
+			return nil, err
+		}
+		val, err := strconv.ParseUint(args[1], 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		if typ == "result" {
+			opts, err := parseAsmOpts(args[2:], "div", "add", "default")
+			if err != nil {
+				return nil, err
+			}
+			return ExecArgResult{Size: size, Index: val, DivOp: opts["div"], AddOp: opts["add"],
+				Default: opts["default"]}, nil
+		}
+		arg := ExecArgConst{Size: size, Value: val}
+		for _, opt := range args[2:] {
+			if bf := strings.TrimPrefix(opt, "bitfield="); bf != opt {
+				parts := strings.Split(bf, ":")
+				nums, err := parseAsmNums(parts)
+				if err != nil || len(nums) != 2 {
+					return nil, fmt.Errorf("bad bitfield %q", bf)
+				}
+				arg.BitfieldOffset, arg.BitfieldLength = nums[0], nums[1]
+				continue
+			}
+			opts, err := parseAsmOpts([]string{opt}, "high")
+			if err != nil {
+				return nil, err
+			}
+			arg.ValueHigh = opts["high"]
+		}
+		return arg, nil
+	case "data":
+		if len(args) > 1 {
+			return nil, fmt.Errorf("data wants 1 hex string")
+		}
+		data := []byte{}
+		if len(args) == 1 {
+			var err error
+			if data, err = hex.DecodeString(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		return ExecArgData{Data: data}, nil
+	case "zdata":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("zdata wants size and hex string")
+		}
+		size, err := strconv.ParseUint(args[0], 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := hex.DecodeString(args[1])
+		if err != nil {
+			return nil, err
+		}
+		data, err := decompressExecData(compressed, size)
+		if err != nil {
+			return nil, err
+		}
+		return ExecArgData{Data: data, Compressed: compressed}, nil
+	case "csum":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("csum wants size and kind")
+		}
+		size, err := strconv.ParseUint(args[0], 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		arg := ExecArgCsum{Size: size}
+		rest := args[2:]
+		switch args[1] {
+		case "inet":
+			arg.Kind = ExecArgCsumInet
+		case "crc32":
+			arg.Kind = ExecArgCsumCrc32
+			if len(rest) != 2 {
+				return nil, fmt.Errorf("crc32 csum wants data chunk and polynomial")
+			}
+			if arg.Poly, err = strconv.ParseUint(rest[1], 0, 64); err != nil {
+				return nil, err
+			}
+			rest = rest[:1]
+		default:
+			return nil, fmt.Errorf("unknown csum kind %q", args[1])
+		}
+		for _, chunk := range rest {
+			parts := strings.Split(chunk, ":")
+			nums, err := parseAsmNums(parts[1:])
+			if err != nil || len(nums) != 2 {
+				return nil, fmt.Errorf("bad csum chunk %q", chunk)
+			}
+			kind := ExecArgCsumChunkData
+			switch {
+			case parts[0] == "const" && arg.Kind == ExecArgCsumInet:
+				kind = ExecArgCsumChunkConst
+			case parts[0] != "data":
+				return nil, fmt.Errorf("bad csum chunk %q", chunk)
+			}
+			arg.Chunks = append(arg.Chunks, ExecCsumChunk{Kind: kind, Value: nums[0], Size: nums[1]})
+		}
+		return arg, nil
+	case "block":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("block args must be on the following lines")
+		}
+		return ExecArgBlock{}, nil
+	default:
+		return nil, fmt.Errorf("unknown arg type %q", typ)
+	}
+}
+
+func parseExecSizeAsm(s string) (uint64, error) {
+	parts := strings.Split(s, "|")
+	size, err := strconv.ParseUint(parts[0], 0, 64)
+	if err != nil {
+		return 0, err
+	}
+	for _, flag := range parts[1:] {
+		switch flag {
+		case "be":
+			size |= ExecArgFlagBigEndian
+		case "ptr":
+			size |= ExecArgFlagPointer
+		default:
+			return 0, fmt.Errorf("unknown size flag %q", flag)
+		}
+	}
+	return size, nil
+}
+
+func parseAsmNums(fields []string) ([]uint64, error) {
+	var nums []uint64
+	for _, f := range fields {
+		v, err := strconv.ParseUint(f, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, v)
+	}
+	return nums, nil
+}
+
+// parseAsmOpts parses NAME=VALUE fields, names must be in allowed.
+var execCallPropNames = map[uint64]string{
+	ExecCallPropCollideGroup: "collide_group",
+	ExecCallPropSandbox:      "sandbox",
+	ExecCallPropRerun:        "rerun",
+}
+
+// execCallPropAsm returns name of call property key, "prop_KEY" for unknown keys.
+func execCallPropAsm(key uint64) string {
+	if name, ok := execCallPropNames[key]; ok {
+		return name
+	}
+	return fmt.Sprintf("prop_%v", key)
+}
+
+// parseAsmCallProps extracts call properties from call options,
+// returns the remaining options and the properties sorted by key.
+func parseAsmCallProps(fields []string) ([]string, []ExecCallProp, error) {
+	var rest []string
+	var props []ExecCallProp
+	for _, f := range fields {
+		eq := strings.IndexByte(f, '=')
+		if eq == -1 {
+			rest = append(rest, f)
+			continue
+		}
+		key, ok := uint64(0), false
+		for k, name := range execCallPropNames {
+			if name == f[:eq] {
+				key, ok = k, true
+			}
+		}
+		if num := strings.TrimPrefix(f[:eq], "prop_"); num != f[:eq] {
+			v, err := strconv.ParseUint(num, 0, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad call prop %q", f[:eq])
+			}
+			key, ok = v, true
+		}
+		if !ok {
+			rest = append(rest, f)
+			continue
+		}
+		v, err := strconv.ParseUint(f[eq+1:], 0, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		props = append(props, ExecCallProp{Key: key, Value: v})
+	}
+	sort.Slice(props, func(i, j int) bool {
+		return props[i].Key < props[j].Key
+	})
+	for i := 1; i < len(props); i++ {
+		if props[i].Key == props[i-1].Key {
+			return nil, nil, fmt.Errorf("duplicate call prop %v", execCallPropAsm(props[i].Key))
+		}
+	}
+	return rest, props, nil
+}
+
+func parseAsmOpts(fields []string, allowed ...string) (map[string]uint64, error) {
+	opts := make(map[string]uint64)
+	for _, f := range fields {
+		eq := strings.IndexByte(f, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("bad option %q", f)
+		}
+		name := f[:eq]
+		known := false
+		for _, a := range allowed {
+			known = known || a == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown option %q", name)
+		}
+		v, err := strconv.ParseUint(f[eq+1:], 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		opts[name] = v
+	}
+	return opts, nil
+}
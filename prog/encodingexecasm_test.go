@@ -0,0 +1,120 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExecAsmRoundTrip(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		n, err := p.SerializeForExecOpts(buf, i%16, ExecOpts{ProgID: uint64(i + 1)})
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		text, err := target.DisassembleExec(buf[:n])
+		if err != nil {
+			t.Fatalf("failed to disassemble: %v", err)
+		}
+		exec, err := target.AssembleExec(text)
+		if err != nil {
+			t.Fatalf("failed to assemble: %v\n%s", err, text)
+		}
+		if !bytes.Equal(exec, buf[:n]) {
+			t.Fatalf("assembly round trip mismatch:\n%s", text)
+		}
+	}
+}
+
+func TestExecAsmFormat(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte("syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "copyin 0x6400000 const 1 0x42\n" +
+		"copyin 0x6400001 data 0102030405\n" +
+		"call syz_test$array1\n" +
+		"\tconst 8 0x6400000\n"
+	text, err := target.DisassembleExec(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != want {
+		t.Fatalf("bad assembly:\n%s\nwant:\n%s", text, want)
+	}
+	exec, err := target.AssembleExec(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exec, buf[:n]) {
+		t.Fatalf("assembled to different bytes")
+	}
+	id := fmt.Sprintf("#%v", target.SyscallMap["syz_test$array1"].ID)
+	if dump, want := ExecDump(buf[:n]), strings.Replace(want, "syz_test$array1", id, 1); dump != want {
+		t.Fatalf("bad dump:\n%s\nwant:\n%s", dump, want)
+	}
+	if dump := ExecDump(buf[:8]); !strings.HasPrefix(dump, "malformed program") {
+		t.Fatalf("bad dump of malformed program:\n%s", dump)
+	}
+}
+
+func TestExecAsmAssemble(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	text := "header 1 0x3\n" +
+		"prog_id 0x5\n" +
+		"reset\n" +
+		"fill 0x6400000 16 0xff\n" +
+		"union 0x6400000 1\n" +
+		"copyin 0x6400010 const 2|be 0x1234 bitfield=3:4\n" +
+		"copyin 0x6400040 data\n" +
+		"copyin 0x6400020 csum 2 inet data:0x6400000:16 const:0x1100:2\n" +
+		"copyin 0x6400030 csum 4 crc32 data:0x6400000:16 0x82f63b78\n" +
+		"call syz_test$res0 copyout=0 repeat=3\n" +
+		"expect_return 0x0\n" +
+		"copyout 1 0x6400050 4\n" +
+		"call syz_test$int\n" +
+		"\tresult 8 0 div=0x2 add=0x1\n" +
+		"\tconst 1 0x1\n" +
+		"\tconst 2 0x2\n" +
+		"\tconst 4 0x3\n" +
+		"\tblock\n" +
+		"\t\tconst 8|ptr 0x6400000\n"
+	exec, err := target.AssembleExec("# comment\n\n" + text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := target.DisassembleExec(exec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != text {
+		t.Fatalf("bad assembly:\n%s\nwant:\n%s", got, text)
+	}
+	for _, bad := range []string{
+		"\tconst 8 0x0\n",
+		"call foo\n",
+		"call syz_test$res0 index=1\n",
+		"copyin 0x0 const 8|le 0x0\n",
+		"call syz_test$res0\n\t\tconst 8 0x0\n",
+		"call syz_test$res0\ncopyin 0x0 const 8 0x0\n",
+		"copyout 1 0x0 4\n",
+		"move 0x0\n",
+	} {
+		if _, err := target.AssembleExec(bad); err == nil {
+			t.Errorf("assembled bad text:\n%s", bad)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// This file implements JSON representation of the exec format for harnesses
+// that can't transfer binary data. The document is an array of instructions
+// in the same order as in the binary format. Integer fields are encoded as
+// strings, because JSON numbers can't represent all uint64 values,
+// data blobs are encoded in base64.
+
+type execJSONInstr struct {
+	Instr  string        `json:"instr"` // "copyin", "call", "expect_return", "copyout" or "copyout_data"
+	Addr   uint64        `json:"addr,omitempty,string"`
+	Arg    *execJSONArg  `json:"arg,omitempty"`
+	Call   string        `json:"call,omitempty"`
+	Index  uint64        `json:"index,omitempty,string"`
+	Repeat uint64        `json:"repeat,omitempty,string"`
+	Args   []execJSONArg `json:"args,omitempty"`
+	Size   uint64        `json:"size,omitempty,string"`
+	Value  uint64        `json:"value,omitempty,string"`
+}
+
+type execJSONArg struct {
+	Type           string            `json:"type"` // "const", "result", "data", "csum", "fill", "union" or "block"
+	Size           uint64            `json:"size,omitempty,string"`
+	Value          uint64            `json:"value,omitempty,string"`
+	ValueHigh      uint64            `json:"value_high,omitempty,string"`
+	BitfieldOffset uint64            `json:"bitfield_offset,omitempty,string"`
+	BitfieldLength uint64            `json:"bitfield_length,omitempty,string"`
+	Index          uint64            `json:"index,omitempty,string"`
+	DivOp          uint64            `json:"div_op,omitempty,string"`
+	AddOp          uint64            `json:"add_op,omitempty,string"`
+	Data           []byte            `json:"data,omitempty"`
+	Kind           uint64            `json:"kind,omitempty,string"`
+	Chunks         []execJSONCsumChk `json:"chunks,omitempty"`
+	Poly           uint64            `json:"poly,omitempty,string"`
+	Args           []execJSONArg     `json:"args,omitempty"`
+}
+
+type execJSONCsumChk struct {
+	Kind  uint64 `json:"kind,string"`
+	Value uint64 `json:"value,string"`
+	Size  uint64 `json:"size,string"`
+}
+
+// SerializeForExecJSON serializes program p for execution by process pid
+// in JSON representation of the exec format.
+func (p *Prog) SerializeForExecJSON(pid int) ([]byte, error) {
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf, pid)
+	if tooSmall, ok := err.(*ExecBufferTooSmallError); ok {
+		buf = make([]byte, tooSmall.Size)
+		n, err = p.SerializeForExec(buf, pid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	exec, err := p.Target.DeserializeExec(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	var instrs []execJSONInstr
+	for _, call := range exec.Calls {
+		for _, copyin := range call.Copyin {
+			instrs = append(instrs, execJSONInstr{
+				Instr: "copyin",
+				Addr:  copyin.Addr,
+				Arg:   execArgToJSON(copyin.Arg),
+			})
+		}
+		instr := execJSONInstr{
+			Instr:  "call",
+			Call:   call.Meta.Name,
+			Index:  call.Index,
+			Repeat: call.Repeat,
+		}
+		for _, arg := range call.Args {
+			instr.Args = append(instr.Args, *execArgToJSON(arg))
+		}
+		instrs = append(instrs, instr)
+		if call.HasExpectedRet {
+			instrs = append(instrs, execJSONInstr{
+				Instr: "expect_return",
+				Value: call.ExpectedRet,
+			})
+		}
+		for _, copyout := range call.Copyout {
+			instrs = append(instrs, execJSONInstr{
+				Instr: "copyout",
+				Index: copyout.Index,
+				Addr:  copyout.Addr,
+				Size:  copyout.Size,
+			})
+		}
+		for _, copyout := range call.CopyoutData {
+			instrs = append(instrs, execJSONInstr{
+				Instr: "copyout_data",
+				Index: copyout.Index,
+				Addr:  copyout.Addr,
+				Size:  copyout.Size,
+			})
+		}
+	}
+	if instrs == nil {
+		instrs = []execJSONInstr{}
+	}
+	return json.Marshal(instrs)
+}
+
+// DeserializeExecJSON parses a program produced by SerializeForExecJSON.
+func (target *Target) DeserializeExecJSON(data []byte) (ExecProg, error) {
+	var instrs []execJSONInstr
+	if err := json.Unmarshal(data, &instrs); err != nil {
+		return ExecProg{}, err
+	}
+	// Convert the program back to the binary format to reuse checks of the decoder.
+	var p ExecProg
+	var call ExecCall
+	for i, instr := range instrs {
+		switch instr.Instr {
+		case "copyin":
+			if instr.Arg == nil {
+				return ExecProg{}, fmt.Errorf("instruction %v: copyin without arg", i)
+			}
+			arg, err := execArgFromJSON(instr.Arg)
+			if err != nil {
+				return ExecProg{}, fmt.Errorf("instruction %v: %v", i, err)
+			}
+			call.Copyin = append(call.Copyin, ExecCopyin{Addr: instr.Addr, Arg: arg})
+		case "call":
+			call.Meta = target.SyscallMap[instr.Call]
+			if call.Meta == nil {
+				return ExecProg{}, fmt.Errorf("instruction %v: unknown syscall %v", i, instr.Call)
+			}
+			call.Index = instr.Index
+			call.Repeat = instr.Repeat
+			for j := range instr.Args {
+				arg, err := execArgFromJSON(&instr.Args[j])
+				if err != nil {
+					return ExecProg{}, fmt.Errorf("instruction %v: arg %v: %v", i, j, err)
+				}
+				call.Args = append(call.Args, arg)
+			}
+			p.Calls = append(p.Calls, call)
+			call = ExecCall{}
+		case "expect_return":
+			if len(p.Calls) == 0 {
+				return ExecProg{}, fmt.Errorf("instruction %v: expected return before calls", i)
+			}
+			last := &p.Calls[len(p.Calls)-1]
+			last.HasExpectedRet = true
+			last.ExpectedRet = instr.Value
+		case "copyout", "copyout_data":
+			if len(p.Calls) == 0 {
+				return ExecProg{}, fmt.Errorf("instruction %v: copyout before calls", i)
+			}
+			last := &p.Calls[len(p.Calls)-1]
+			copyout := ExecCopyout{
+				Index: instr.Index,
+				Addr:  instr.Addr,
+				Size:  instr.Size,
+			}
+			if instr.Instr == "copyout" {
+				last.Copyout = append(last.Copyout, copyout)
+			} else {
+				last.CopyoutData = append(last.CopyoutData, copyout)
+			}
+		default:
+			return ExecProg{}, fmt.Errorf("instruction %v: unknown instruction %q", i, instr.Instr)
+		}
+	}
+	if len(call.Copyin) != 0 {
+		return ExecProg{}, fmt.Errorf("copyin after the last call")
+	}
+	p.bigEndian = target.BigEndian
+	p.varint = p.Flags&ExecFlagVarint != 0
+	return target.DeserializeExec(p.encode())
+}
+
+func execArgToJSON(arg ExecArg) *execJSONArg {
+	switch a := arg.(type) {
+	case ExecArgConst:
+		return &execJSONArg{
+			Type:           "const",
+			Size:           a.Size,
+			Value:          a.Value,
+			ValueHigh:      a.ValueHigh,
+			BitfieldOffset: a.BitfieldOffset,
+			BitfieldLength: a.BitfieldLength,
+		}
+	case ExecArgResult:
+		return &execJSONArg{
+			Type:  "result",
+			Size:  a.Size,
+			Index: a.Index,
+			DivOp: a.DivOp,
+			AddOp: a.AddOp,
+		}
+	case ExecArgData:
+		return &execJSONArg{
+			Type: "data",
+			Size: uint64(len(a.Data)),
+			Data: a.Data,
+		}
+	case ExecArgCsum:
+		res := &execJSONArg{
+			Type: "csum",
+			Size: a.Size,
+			Kind: a.Kind,
+			Poly: a.Poly,
+		}
+		for _, chunk := range a.Chunks {
+			res.Chunks = append(res.Chunks, execJSONCsumChk(chunk))
+		}
+		return res
+	case ExecArgFill:
+		return &execJSONArg{
+			Type:  "fill",
+			Size:  a.Size,
+			Value: a.Value,
+		}
+	case ExecArgUnionOption:
+		return &execJSONArg{
+			Type:  "union",
+			Index: a.Index,
+		}
+	case ExecArgBlock:
+		res := &execJSONArg{
+			Type: "block",
+		}
+		for _, arg := range a.Args {
+			res.Args = append(res.Args, *execArgToJSON(arg))
+		}
+		return res
+	default:
+		panic(fmt.Sprintf("unknown exec arg %#v", arg))
+	}
+}
+
+func execArgFromJSON(arg *execJSONArg) (ExecArg, error) {
+	switch arg.Type {
+	case "const":
+		return ExecArgConst{
+			Size:           arg.Size,
+			Value:          arg.Value,
+			ValueHigh:      arg.ValueHigh,
+			BitfieldOffset: arg.BitfieldOffset,
+			BitfieldLength: arg.BitfieldLength,
+		}, nil
+	case "result":
+		return ExecArgResult{
+			Size:  arg.Size,
+			Index: arg.Index,
+			DivOp: arg.DivOp,
+			AddOp: arg.AddOp,
+		}, nil
+	case "data":
+		if arg.Size != uint64(len(arg.Data)) {
+			return nil, fmt.Errorf("data arg has size %v, but %v bytes of data", arg.Size, len(arg.Data))
+		}
+		return ExecArgData{Data: arg.Data}, nil
+	case "csum":
+		res := ExecArgCsum{
+			Size: arg.Size,
+			Kind: arg.Kind,
+			Poly: arg.Poly,
+		}
+		for _, chunk := range arg.Chunks {
+			res.Chunks = append(res.Chunks, ExecCsumChunk(chunk))
+		}
+		return res, nil
+	case "fill":
+		return ExecArgFill{
+			Size:  arg.Size,
+			Value: arg.Value,
+		}, nil
+	case "union":
+		return ExecArgUnionOption{
+			Index: arg.Index,
+		}, nil
+	case "block":
+		res := ExecArgBlock{}
+		for i := range arg.Args {
+			arg1, err := execArgFromJSON(&arg.Args[i])
+			if err != nil {
+				return nil, err
+			}
+			res.Args = append(res.Args, arg1)
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("bad argument type %q", arg.Type)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSerializeForExecJSON(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		n, err := p.SerializeForExec(buf, i%16)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		want, err := target.DeserializeExec(buf[:n])
+		if err != nil {
+			t.Fatalf("failed to deserialize: %v", err)
+		}
+		data, err := p.SerializeForExecJSON(i % 16)
+		if err != nil {
+			t.Fatalf("failed to serialize to json: %v", err)
+		}
+		got, err := target.DeserializeExecJSON(data)
+		if err != nil {
+			t.Fatalf("failed to deserialize json: %v\n%s", err, data)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("json round trip mismatch:\n%s\ngot:  %+v\nwant: %+v", data, got, want)
+		}
+	}
+}
+
+func TestSerializeForExecJSONFormat(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte("syz_test$array1(&(0x7f0000000000)={0x42, \"0102030405\"})"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.SerializeForExecJSON(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instrs []map[string]interface{}
+	if err := json.Unmarshal(data, &instrs); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{
+			"instr": "copyin",
+			"addr":  "104857600",
+			"arg":   map[string]interface{}{"type": "const", "size": "1", "value": "66"},
+		},
+		{
+			"instr": "copyin",
+			"addr":  "104857601",
+			"arg":   map[string]interface{}{"type": "data", "size": "5", "data": "AQIDBAU="},
+		},
+		{
+			"instr": "call",
+			"call":  "syz_test$array1",
+			"index": "18446744073709551615",
+			"args": []interface{}{
+				map[string]interface{}{"type": "const", "size": "8", "value": "104857600"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(instrs, want) {
+		t.Fatalf("bad json:\n%s", data)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// ExecCsumCache remembers inputs of checksums of the last program serialized
+// with SerializeForExecOpts, see ExecOpts.CsumCache.
+// The zero value is ready to use. ExecCsumCache is not safe for concurrent use.
+type ExecCsumCache struct {
+	hashes map[uint64]uint64 // checksum address -> hash of checksum inputs
+}
+
+// cachedCsums returns checksum args of call c that don't need to be recalculated
+// according to ExecOpts.CsumCache, and records inputs of all checksums of c
+// for the next serialization (see commitCsums).
+func (w *execContext) cachedCsums(c *Call, pid int, csumMap map[Arg]CsumInfo) map[Arg]bool {
+	addrs := make(map[Arg]uint64)
+	foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+		if a, ok := arg.(*PointerArg); ok && a.Res != nil {
+			base := w.physicalAddr(arg)
+			foreachSubargOffset(a.Res, func(arg1 Arg, offset uint64) {
+				addrs[arg1] = base + offset
+			})
+		}
+	})
+	if w.csumHashes == nil {
+		w.csumHashes = make(map[uint64]uint64)
+		w.csumDups = make(map[uint64]bool)
+	}
+	skip := make(map[Arg]bool)
+	for arg, info := range csumMap {
+		addr := addrs[arg]
+		if _, dup := w.csumHashes[addr]; dup {
+			// The field is checksummed several times, so the executor
+			// can't keep the value for any of the checksums.
+			w.csumDups[addr] = true
+			continue
+		}
+		sum, ok := csumInputsHash(arg, info, addrs, pid)
+		if !ok {
+			w.csumDups[addr] = true
+			continue
+		}
+		w.csumHashes[addr] = sum
+		if prev, ok := w.opts.CsumCache.hashes[addr]; ok && prev == sum {
+			skip[arg] = true
+		}
+	}
+	for arg := range skip {
+		if w.csumDups[addrs[arg]] {
+			delete(skip, arg)
+		}
+	}
+	return skip
+}
+
+// commitCsums saves inputs of checksums of the serialized program in ExecOpts.CsumCache.
+// Checksums that are not present in the program are forgotten,
+// since the program could overwrite their memory.
+func (w *execContext) commitCsums() {
+	hashes := make(map[uint64]uint64)
+	for addr, sum := range w.csumHashes {
+		if !w.csumDups[addr] {
+			hashes[addr] = sum
+		}
+	}
+	w.opts.CsumCache.hashes = hashes
+}
+
+// csumInputsHash returns hash of everything that the value of checksum arg depends on.
+// Returns false if the value can't be proven to be the same for the same hash
+// (e.g. it depends on results of other calls).
+func csumInputsHash(arg Arg, info CsumInfo, addrs map[Arg]uint64, pid int) (uint64, bool) {
+	h := fnv.New64a()
+	var word [8]byte
+	put := func(v uint64) {
+		binary.LittleEndian.PutUint64(word[:], v)
+		h.Write(word[:])
+	}
+	put(uint64(pid))
+	put(uint64(info.Kind))
+	put(arg.Size())
+	ok := true
+	for _, chunk := range info.Chunks {
+		put(uint64(chunk.Kind))
+		switch chunk.Kind {
+		case CsumChunkConst:
+			put(chunk.Value)
+			put(chunk.Size)
+		case CsumChunkLen:
+			put(chunk.lenValue())
+			put(chunk.Size)
+		case CsumChunkArg:
+			put(addrs[chunk.Arg])
+			put(chunk.Arg.Size())
+			foreachSubarg(chunk.Arg, func(arg1, _ Arg, _ *[]Arg) {
+				switch a := arg1.(type) {
+				case *ConstArg:
+					if _, isCsum := a.Type().(*CsumType); isCsum && arg1 != arg {
+						ok = false
+					}
+					v, _ := a.hostValue(pid)
+					put(v)
+					put(a.ValHigh)
+					put(a.Type().BitfieldOffset())
+					put(a.Type().BitfieldLength())
+				case *DataArg:
+					put(uint64(len(a.Data())))
+					h.Write(a.Data())
+				case *UnionArg:
+					put(unionOptionIndex(a))
+				case *ResultArg:
+					if a.Res != nil {
+						ok = false
+					}
+					put(a.Val)
+				case *PointerArg:
+					ok = false
+				}
+			})
+		}
+	}
+	return h.Sum64(), ok
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"sync"
+)
+
+const (
+	execPoolMinSize = 4 << 10
+	execPoolClasses = 10 // up to execPoolMinSize<<9 = ExecBufferSize
+	execPoolMaxFree = 16 // max cached buffers per size class
+)
+
+// ExecBufferPool caches buffers for serialized programs.
+// Buffers are grouped into power-of-2 size classes, so that small programs
+// don't need to hold ExecBufferSize buffers.
+// The zero value is ready to use. ExecBufferPool is safe for concurrent use.
+type ExecBufferPool struct {
+	mu   sync.Mutex
+	free [execPoolClasses][][]byte
+}
+
+// Get returns a buffer of length size.
+func (pool *ExecBufferPool) Get(size int) []byte {
+	class := 0
+	for ; class < execPoolClasses && execPoolMinSize<<uint(class) < size; class++ {
+	}
+	if class == execPoolClasses {
+		return make([]byte, size)
+	}
+	pool.mu.Lock()
+	free := pool.free[class]
+	if len(free) != 0 {
+		buf := free[len(free)-1]
+		pool.free[class] = free[:len(free)-1]
+		pool.mu.Unlock()
+		return buf[:size]
+	}
+	pool.mu.Unlock()
+	return make([]byte, size, execPoolMinSize<<uint(class))
+}
+
+// Put returns buf obtained from Get to the pool.
+func (pool *ExecBufferPool) Put(buf []byte) {
+	class := -1
+	for ; class+1 < execPoolClasses && execPoolMinSize<<uint(class+1) <= cap(buf); class++ {
+	}
+	if class < 0 {
+		return
+	}
+	pool.mu.Lock()
+	if len(pool.free[class]) < execPoolMaxFree {
+		pool.free[class] = append(pool.free[class], buf[:0])
+	}
+	pool.mu.Unlock()
+}
+
+// SerializeForExecPool serializes program p for execution by process pid
+// into a buffer from pool that fits the program.
+// The buffer should be returned to the pool with Put when it is not needed anymore.
+func (p *Prog) SerializeForExecPool(pool *ExecBufferPool, pid int) ([]byte, error) {
+	// Most programs fit into the smallest size class, so try it first
+	// and serialize again only if the program turns out to be larger.
+	buf := pool.Get(execPoolMinSize)
+	n, err := p.SerializeForExec(buf, pid)
+	if tooSmall, ok := err.(*ExecBufferTooSmallError); ok {
+		pool.Put(buf)
+		buf = pool.Get(tooSmall.Size)
+		n, err = p.SerializeForExec(buf, pid)
+	}
+	if err != nil {
+		pool.Put(buf)
+		return nil, err
+	}
+	return buf[:n], nil
+}
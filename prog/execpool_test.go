@@ -0,0 +1,98 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestExecBufferPool(t *testing.T) {
+	var pool ExecBufferPool
+	for _, size := range []int{0, 1, 4 << 10, 4<<10 + 1, 100 << 10, ExecBufferSize, ExecBufferSize + 1} {
+		buf := pool.Get(size)
+		if len(buf) != size {
+			t.Fatalf("Get(%v) returned buffer of size %v", size, len(buf))
+		}
+		pool.Put(buf)
+		buf = pool.Get(size)
+		if len(buf) != size {
+			t.Fatalf("Get(%v) after Put returned buffer of size %v", size, len(buf))
+		}
+	}
+}
+
+func TestSerializeForExecPool(t *testing.T) {
+	target, rs, iters := initTest(t)
+	var pool ExecBufferPool
+	buf := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		data, err := p.SerializeForExecPool(&pool, i%16)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		n, err := p.SerializeForExec(buf, i%16)
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		if !bytes.Equal(data, buf[:n]) {
+			t.Fatalf("pooled serialization differs")
+		}
+		pool.Put(data)
+	}
+}
+
+func TestSerializeForExecPoolLarge(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte("syz_test$hint_data(&(0x7f0000000000)=\"00\")"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The program does not fit into the smallest size class.
+	p.Calls[0].Args[0].(*PointerArg).Res.(*DataArg).data = bytes.Repeat([]byte{1, 2}, execPoolMinSize)
+	var pool ExecBufferPool
+	data, err := p.SerializeForExecPool(&pool, 0)
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf, 0)
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+	if n <= execPoolMinSize || !bytes.Equal(data, buf[:n]) {
+		t.Fatalf("pooled serialization differs: %v/%v bytes", len(data), n)
+	}
+}
+
+func BenchmarkSerializeForExec(b *testing.B) {
+	defer overrideDebug(false)()
+	target, err := GetTarget("linux", "amd64")
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := target.Generate(rand.NewSource(0), 30, nil)
+	b.Run("make", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := make([]byte, ExecBufferSize)
+			if _, err := p.SerializeForExec(buf, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		var pool ExecBufferPool
+		for i := 0; i < b.N; i++ {
+			buf, err := p.SerializeForExecPool(&pool, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			pool.Put(buf)
+		}
+	})
+}
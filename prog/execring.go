@@ -0,0 +1,51 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+)
+
+// ExecRing is a ring buffer (e.g. shared memory of the IPC channel with the executor)
+// that programs can be serialized into directly with SerializeForExecRing,
+// without serializing into an intermediate buffer and copying.
+type ExecRing interface {
+	// Reserve returns free space of the ring. If the free space wraps around
+	// the end of the ring, first is the part up to the end and second
+	// is the part at the beginning, otherwise second is empty.
+	Reserve() (first, second []byte)
+	// Commit makes n bytes written into the reserved space available to the reader.
+	Commit(n int)
+}
+
+// SerializeForExecRing serializes program p for execution by process pid
+// into free space of ring and commits it. Programs can wrap around the end
+// of the ring. Returns number of committed bytes.
+// If the program does not fit into free space of the ring, nothing is committed
+// and ExecBufferTooSmallError with the required size is returned.
+func (p *Prog) SerializeForExecRing(ring ExecRing, pid int, opts ExecOpts) (int, error) {
+	if opts.AppendChecksum {
+		return 0, fmt.Errorf("AppendChecksum can't be used with SerializeForExecRing")
+	}
+	first, second := ring.Reserve()
+	w := newExecContext(p.Target, first, opts)
+	w.next = second
+	if err := w.serializeProg(p, pid); err != nil {
+		return 0, err
+	}
+	w.writeEOF()
+	if w.eof {
+		size, err := p.execByteSize(pid, opts)
+		if err != nil {
+			return 0, err
+		}
+		return 0, &ExecBufferTooSmallError{size}
+	}
+	if opts.CsumCache != nil {
+		w.commitCsums()
+	}
+	n := len(first) + len(second) - len(w.buf) - len(w.next)
+	ring.Commit(n)
+	return n, nil
+}
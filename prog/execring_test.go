@@ -0,0 +1,116 @@
+// Copyright 2018 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// testRing is a single-producer ring buffer as used for the IPC channel.
+type testRing struct {
+	data []byte
+	head int // total number of committed bytes
+	tail int // total number of consumed bytes
+}
+
+func (r *testRing) Reserve() (first, second []byte) {
+	size := len(r.data)
+	pos := r.head % size
+	free := size - (r.head - r.tail)
+	if pos+free <= size {
+		return r.data[pos : pos+free], nil
+	}
+	return r.data[pos:], r.data[:pos+free-size]
+}
+
+func (r *testRing) Commit(n int) {
+	r.head += n
+}
+
+// read consumes n bytes from the ring.
+func (r *testRing) read(n int) []byte {
+	res := make([]byte, n)
+	for i := range res {
+		res[i] = r.data[(r.tail+i)%len(r.data)]
+	}
+	r.tail += n
+	return res
+}
+
+func TestSerializeForExecRing(t *testing.T) {
+	target, rs, iters := initTest(t)
+	buf := make([]byte, ExecBufferSize)
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, nil)
+		for _, opts := range []ExecOpts{{}, {EmitHeader: true, Varint: true}} {
+			n, err := p.SerializeForExecOpts(buf, i%16, opts)
+			if err != nil {
+				t.Fatalf("failed to serialize: %v", err)
+			}
+			// Position the ring so that the program wraps around the end.
+			ring := &testRing{data: make([]byte, n+n%7+1)}
+			ring.head = len(ring.data) - n/(i%5+2)
+			ring.tail = ring.head
+			n1, err := p.SerializeForExecRing(ring, i%16, opts)
+			if err != nil {
+				t.Fatalf("failed to serialize into ring: %v", err)
+			}
+			if n1 != n {
+				t.Fatalf("committed %v bytes, want %v", n1, n)
+			}
+			if got := ring.read(n1); !bytes.Equal(got, buf[:n]) {
+				t.Fatalf("ring contents differ from SerializeForExec:\n%v", p.Serialize())
+			}
+			// The ring has less free space than the program needs.
+			ring.head += len(ring.data) - n + 1
+			head := ring.head
+			_, err = p.SerializeForExecRing(ring, i%16, opts)
+			if e, ok := err.(*ExecBufferTooSmallError); !ok || e.Size != n {
+				t.Fatalf("got error %v, want ExecBufferTooSmallError{%v}", err, n)
+			}
+			if ring.head != head {
+				t.Fatalf("ring committed %v bytes on error", ring.head-head)
+			}
+		}
+	}
+}
+
+func BenchmarkSerializeForExecRing(b *testing.B) {
+	defer overrideDebug(false)()
+	target, err := GetTarget("linux", "amd64")
+	if err != nil {
+		b.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	var progs []*Prog
+	for i := 0; i < 100; i++ {
+		progs = append(progs, target.Generate(rs, 30, nil))
+	}
+	ring := &testRing{data: make([]byte, ExecBufferSize)}
+	b.Run("copy", func(b *testing.B) {
+		buf := make([]byte, ExecBufferSize)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			n, err := progs[i%len(progs)].SerializeForExec(buf, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			first, second := ring.Reserve()
+			copy(second, buf[copy(first, buf[:n]):n])
+			ring.Commit(n)
+			ring.tail = ring.head
+		}
+	})
+	b.Run("ring", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := progs[i%len(progs)].SerializeForExecRing(ring, 0, ExecOpts{}); err != nil {
+				b.Fatal(err)
+			}
+			ring.tail = ring.head
+		}
+	})
+}
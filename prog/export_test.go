@@ -44,3 +44,10 @@ func initRandomTargetTest(t *testing.T, os, arch string) (*Target, rand.Source,
 func initTest(t *testing.T) (*Target, rand.Source, int) {
 	return initRandomTargetTest(t, "linux", "amd64")
 }
+
+// overrideDebug sets debug to v and returns a function that restores the previous value.
+func overrideDebug(v bool) func() {
+	old := debug
+	debug = v
+	return func() { debug = old }
+}
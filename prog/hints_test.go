@@ -56,7 +56,7 @@ func TestHintsCheckConstArg(t *testing.T) {
 	for _, test := range tests {
 		t.Run(fmt.Sprintf("%v", test.name), func(t *testing.T) {
 			res := uint64Set{}
-			constArg := &ConstArg{ArgCommon{nil}, test.in}
+			constArg := &ConstArg{ArgCommon: ArgCommon{nil}, Val: test.in}
 			checkConstArg(constArg, test.comps, func() {
 				res[constArg.Val] = true
 			})
@@ -169,6 +169,18 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Pro
 					if !ok {
 						break
 					}
+					if a.IsNull {
+						arg1, calls1 := r.generateArg(s, t)
+						p.replaceArg(c, arg, arg1, calls1)
+						break
+					}
+					if t.Optional() && r.oneOf(10) {
+						if a.Res != nil {
+							p.removeArg(c, a.Res)
+						}
+						p.replaceArg(c, arg, MakeNullPointerArg(t), nil)
+						break
+					}
 					// TODO: we don't know size for out args
 					size := uint64(1)
 					if a.Res != nil {
@@ -16,6 +16,30 @@ type Call struct {
 	Meta *Syscall
 	Args []Arg
 	Ret  Arg
+	// Repeat is the number of times the call is executed in a row
+	// if serialized with ExecOpts.RepeatCalls (0 means once).
+	Repeat uint64
+	// Async makes executor issue the call without waiting for its completion
+	// if serialized with ExecOpts.AsyncCalls, so that it runs concurrently
+	// with the following calls.
+	Async bool
+	// FailNth injects a fault into the FailNth-th (1-based) fault injection point
+	// (e.g. memory allocation) during execution of the call if serialized with
+	// ExecOpts.EmitFailNth, 0 means no fault injection.
+	FailNth uint64
+	// Props are passed to executor with ExecInstrCallProps if serialized
+	// with ExecOpts.EmitCallProps (along with Repeat as ExecCallPropRerun).
+	Props CallProps
+}
+
+// CallProps are properties of a call that control how executor runs it.
+// Zero values mean the default behavior.
+type CallProps struct {
+	// CollideGroup makes calls with the same non-zero group run concurrently
+	// in collide mode.
+	CollideGroup uint64
+	// Sandbox overrides sandbox of the program for the call (ExecSandbox*).
+	Sandbox uint64
 }
 
 type Arg interface {
@@ -52,7 +76,8 @@ func (arg *ArgCommon) Type() Type {
 // Used for ConstType, IntType, FlagsType, LenType, ProcType and CsumType.
 type ConstArg struct {
 	ArgCommon
-	Val uint64
+	Val     uint64
+	ValHigh uint64 // upper 64 bits of 16-byte values
 }
 
 func MakeConstArg(t Type, v uint64) Arg {
@@ -65,29 +90,36 @@ func (arg *ConstArg) Size() uint64 {
 
 // Returns value taking endianness and executor pid into consideration.
 func (arg *ConstArg) Value(pid int) uint64 {
+	v, bigEndian := arg.hostValue(pid)
+	return encodeValue(v, arg.Size(), bigEndian)
+}
+
+// hostValue returns value taking executor pid into consideration,
+// but not endianness. The second result says if the value must be stored big-endian.
+func (arg *ConstArg) hostValue(pid int) (uint64, bool) {
 	switch typ := (*arg).Type().(type) {
 	case *IntType:
-		return encodeValue(arg.Val, typ.Size(), typ.BigEndian)
+		return arg.Val, typ.BigEndian
 	case *ConstType:
-		return encodeValue(arg.Val, typ.Size(), typ.BigEndian)
+		return arg.Val, typ.BigEndian
 	case *FlagsType:
-		return encodeValue(arg.Val, typ.Size(), typ.BigEndian)
+		return arg.Val, typ.BigEndian
 	case *LenType:
-		return encodeValue(arg.Val, typ.Size(), typ.BigEndian)
+		return arg.Val, typ.BigEndian
 	case *CsumType:
 		// Checksums are computed dynamically in executor.
-		return 0
+		return 0, false
 	case *ResourceType:
 		if t, ok := typ.Desc.Type.(*IntType); ok {
-			return encodeValue(arg.Val, t.Size(), t.BigEndian)
+			return arg.Val, t.BigEndian
 		} else {
 			panic(fmt.Sprintf("bad base type for a resource: %v", t))
 		}
 	case *ProcType:
 		val := typ.ValuesStart + typ.ValuesPerProc*uint64(pid) + arg.Val
-		return encodeValue(val, typ.Size(), typ.BigEndian)
+		return val, typ.BigEndian
 	}
-	return arg.Val
+	return arg.Val, false
 }
 
 // Used for PtrType and VmaType.
@@ -99,6 +131,7 @@ type PointerArg struct {
 	PageOffset int    // offset within a page
 	PagesNum   uint64 // number of available pages
 	Res        Arg    // pointee
+	IsNull     bool   // pointer is NULL rather than an address in the data region
 }
 
 func MakePointerArg(t Type, page uint64, off int, npages uint64, obj Arg) Arg {
@@ -111,6 +144,12 @@ func MakePointerArg(t Type, page uint64, off int, npages uint64, obj Arg) Arg {
 	}
 }
 
+// MakeNullPointerArg creates a NULL pointer. Note that MakePointerArg(t, 0, 0, 0, nil)
+// creates a pointer to the beginning of the data region instead.
+func MakeNullPointerArg(t Type) Arg {
+	return &PointerArg{ArgCommon: ArgCommon{typ: t}, IsNull: true}
+}
+
 func (arg *PointerArg) Size() uint64 {
 	return arg.typ.Size()
 }
@@ -98,3 +98,37 @@ func TestVmaType(t *testing.T) {
 		check(c.Args[4], c.Args[5], 7, 9)
 	}
 }
+
+func TestGenerateNullPointers(t *testing.T) {
+	target, rs, _ := initTest(t)
+	countNulls := func(p *Prog) int {
+		n := 0
+		for _, c := range p.Calls {
+			foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+				if a, ok := arg.(*PointerArg); ok && a.IsNull {
+					n++
+				}
+			})
+		}
+		return n
+	}
+	generated, mutated := false, false
+	for i := 0; i < 1000 && !(generated && mutated); i++ {
+		p := target.Generate(rs, 10, nil)
+		before := countNulls(p)
+		generated = generated || before != 0
+		p.Mutate(rs, 10, nil, nil)
+		mutated = mutated || countNulls(p) > before
+		data := p.Serialize()
+		p1, err := target.Deserialize(data)
+		if err != nil {
+			t.Fatalf("failed to deserialize program: %v\n%s", err, data)
+		}
+		if countNulls(p1) != countNulls(p) {
+			t.Fatalf("null pointers are not preserved:\n%s", data)
+		}
+	}
+	if !generated || !mutated {
+		t.Fatalf("no null pointers: generated %v, mutated %v", generated, mutated)
+	}
+}
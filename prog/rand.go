@@ -539,6 +539,10 @@ func (r *randGen) generateArg(s *state, typ Type) (arg Arg, calls []*Call) {
 	}
 
 	if typ.Optional() && r.oneOf(5) {
+		if _, ok := typ.(*PtrType); ok && r.bin() {
+			// Some syscalls handle NULL differently from a pointer to empty memory.
+			return MakeNullPointerArg(typ), nil
+		}
 		return defaultArg(typ), nil
 	}
 
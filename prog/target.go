@@ -18,6 +18,15 @@ type Target struct {
 	PtrSize    uint64
 	PageSize   uint64
 	DataOffset uint64
+	// BigEndian is set for big-endian architectures. Words of the exec format
+	// are written in the target byte order, and big-endian args are not byte-swapped.
+	// Data args are copied as is, they have no scalar types to swap.
+	// No architecture sets it yet, so it is covered only by tests.
+	BigEndian bool
+	// ExecVarint is set if executor of the target accepts the compact varint encoding
+	// (ExecOpts.Varint), which considerably reduces size of programs passed to executor.
+	// See ExecutorOpts.
+	ExecVarint bool
 
 	Syscalls  []*Syscall
 	Resources []*ResourceDesc
@@ -39,6 +48,21 @@ type Target struct {
 	// SanitizeCall neutralizes harmful calls.
 	SanitizeCall func(c *Call)
 
+	// ExecArgOrder returns order in which args of the syscall are passed to executor
+	// as indices into Call.Args, or nil if args are passed in the declared order.
+	// It is used for ABIs that pass syscall arguments in a different order.
+	ExecArgOrder func(meta *Syscall) []int
+
+	// ExecRegArgs returns number of args of the syscall that are passed in registers,
+	// the rest is passed in a memory block (see ExecArgTypeArgBlock).
+	// If it is nil, all args are passed in registers.
+	ExecRegArgs func(meta *Syscall) int
+
+	// FlatMemory is set for targets without paging (e.g. nommu embedded OSes).
+	// Pointers are then linear offsets from DataOffset (PageIndex*PageSize+PageOffset),
+	// and negative page offsets don't count from the end of the page.
+	FlatMemory bool
+
 	// SpecialStructs allows target to do custom generation/mutation for some struct types.
 	// Map key is struct name for which custom generation/mutation is required.
 	// Map value is custom generation/mutation function that will be called
@@ -57,9 +81,16 @@ type Target struct {
 	initArch    func(target *Target)
 	SyscallMap  map[string]*Syscall
 	ConstMap    map[string]uint64
+	NumPages    uint64 // number of pages in the data region
 	resourceMap map[string]*ResourceDesc
 	// Maps resource name to a list of calls that can create the resource.
 	resourceCtors map[string][]*Syscall
+	// Maps types to their indices, see TypeID.
+	typeIDsOnce sync.Once
+	typeIDs     map[Type]uint64
+	// Syscalls that have checksum fields, see hasCsums.
+	csumCallsOnce sync.Once
+	csumCalls     map[*Syscall]bool
 }
 
 var targets = make(map[string]*Target)
@@ -110,7 +141,28 @@ func (target *Target) lazyInit() {
 	target.ConstMap = nil // currently used only by initArch
 }
 
+// TypeID returns index of type typ among all types of the target.
+// Indices are stable as long as descriptions don't change.
+func (target *Target) TypeID(typ Type) uint64 {
+	target.typeIDsOnce.Do(func() {
+		target.typeIDs = make(map[Type]uint64)
+		for _, c := range target.Syscalls {
+			ForeachType(c, func(t Type) {
+				if _, ok := target.typeIDs[t]; !ok {
+					target.typeIDs[t] = uint64(len(target.typeIDs))
+				}
+			})
+		}
+	})
+	id, ok := target.typeIDs[typ]
+	if !ok {
+		panic(fmt.Sprintf("type %v is not a type of target %v/%v", typ.Name(), target.OS, target.Arch))
+	}
+	return id
+}
+
 func (target *Target) initTarget() {
+	target.NumPages = maxPages
 	target.ConstMap = make(map[string]uint64)
 	for _, c := range target.Consts {
 		target.ConstMap[c.Name] = c.Value
@@ -14,6 +14,9 @@ type Syscall struct {
 	CallName string
 	Args     []Type
 	Ret      Type
+	// Timeout is the call execution timeout in milliseconds set with
+	// timeout_N attribute in descriptions, 0 means the default timeout.
+	Timeout uint64
 }
 
 type Dir int
@@ -178,6 +181,10 @@ type CsumKind int
 const (
 	CsumInet CsumKind = iota
 	CsumPseudo
+	CsumCrc32
+	CsumCrc32c
+	CsumTcp // CsumPseudo with IPPROTO_TCP
+	CsumUdp // CsumPseudo with IPPROTO_UDP
 )
 
 type CsumType struct {
@@ -156,6 +156,10 @@ func (c *Call) validate(ctx *validCtx) error {
 		switch a := arg.(type) {
 		case *ConstArg:
 		case *PointerArg:
+			if a.IsNull && (a.Res != nil || a.PageIndex != 0 || a.PageOffset != 0 || a.PagesNum != 0) {
+				return fmt.Errorf("syscall %v: null pointer arg '%v' has address or data",
+					c.Meta.Name, a.Type().Name())
+			}
 			switch t := a.Type().(type) {
 			case *VmaType:
 				if a.Res != nil {
@@ -177,10 +181,8 @@ func (c *Call) validate(ctx *validCtx) error {
 				return fmt.Errorf("syscall %v: pointer arg '%v' has bad meta type %+v", c.Meta.Name, arg.Type().Name(), arg.Type())
 			}
 		case *DataArg:
-			typ1 := a.Type()
-			if !typ1.Varlen() && typ1.Size() != a.Size() {
-				return fmt.Errorf("syscall %v: data arg %v has wrong size %v, want %v",
-					c.Meta.Name, arg.Type().Name(), a.Size(), typ1.Size())
+			if err := checkDataSize(a); err != nil {
+				return fmt.Errorf("syscall %v: %v", c.Meta.Name, err)
 			}
 			switch typ1 := a.Type().(type) {
 			case *ArrayType:
@@ -286,3 +288,271 @@ func (c *Call) validate(ctx *validCtx) error {
 	}
 	return nil
 }
+
+// validateExec checks properties of the program that SerializeForExec relies on.
+// It is too expensive for every serialization, so it's done only in debug mode
+// and with ExecOpts.Validate. Programs built or modified outside of prog
+// must be checked with ValidateForExec before serialization.
+func (p *Prog) validateExec(dataOffset uint64) error {
+	if errs := p.execErrors(dataOffset, false); len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateForExec checks whether program p can be serialized for execution
+// by process pid and returns all found problems rather than only the first one.
+// In addition to the checks done by SerializeForExec, it checks consistency
+// of the program, checksum references and values of proc args for pid.
+func (p *Prog) ValidateForExec(pid int) []error {
+	errs := p.execErrors(p.Target.DataOffset, true)
+	ctx := &validCtx{make(map[Arg]bool), make(map[Arg]Arg)}
+	for _, c := range p.Calls {
+		// Wrong number of args is already reported by execErrors.
+		if len(c.Args) == len(c.Meta.Args) {
+			if err := c.validate(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		parentsMap := csumParents(c)
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			switch typ := arg.Type().(type) {
+			case *CsumType:
+				if _, err := lookupCsummedArg(arg, typ, parentsMap); err != nil {
+					errs = append(errs, fmt.Errorf("syscall %v: %v", c.Meta.Name, err))
+				}
+			case *ProcType:
+				if a, ok := arg.(*ConstArg); ok {
+					if err := checkProcValue(a, typ, pid); err != nil {
+						errs = append(errs, fmt.Errorf("syscall %v: %v", c.Meta.Name, err))
+					}
+				}
+			}
+		})
+	}
+	for u, orig := range ctx.uses {
+		if !ctx.args[u] {
+			errs = append(errs, fmt.Errorf("use of %+v referes to an out-of-tree arg", orig))
+		}
+	}
+	return errs
+}
+
+// checkProcValue checks that value of proc arg a for process pid fits into the arg.
+func checkProcValue(a *ConstArg, typ *ProcType, pid int) error {
+	bits := a.Size() * 8
+	if typ.BitfieldLength() != 0 {
+		bits = typ.BitfieldLength()
+	}
+	if val, _ := a.hostValue(pid); bits < 64 && val>>bits != 0 {
+		return fmt.Errorf("proc arg %v value 0x%x for pid %v does not fit into %v bits",
+			typ.Name(), val, pid, bits)
+	}
+	return nil
+}
+
+// execErrors returns problems that prevent serialization of the program
+// for the data region at dataOffset. If all is not set, it stops at the first one.
+func (p *Prog) execErrors(dataOffset uint64, all bool) []error {
+	var errs []error
+	// Executor reads referenced results from copyouts of previous calls
+	// (or of the same call for in-place inout results),
+	// so results produced by later calls are not available yet.
+	producers := make(map[Arg]int)
+	for ci, c := range p.Calls {
+		if isUsed(c.Ret) {
+			producers[c.Ret] = ci
+		}
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			if isUsed(arg) {
+				producers[arg] = ci
+			}
+		})
+	}
+	for ci, c := range p.Calls {
+		if !all && len(errs) != 0 {
+			break
+		}
+		if len(c.Args) != len(c.Meta.Args) {
+			errs = append(errs, fmt.Errorf("syscall %v: wrong number of arguments, want %v, got %v",
+				c.Meta.Name, len(c.Meta.Args), len(c.Args)))
+			if !all {
+				break
+			}
+		}
+		foreachArg(c, func(arg, _ Arg, _ *[]Arg) {
+			a, ok := arg.(*ResultArg)
+			if !ok || a.Res == nil || !all && len(errs) != 0 {
+				return
+			}
+			if producer, ok := producers[a.Res]; !ok {
+				errs = append(errs, fmt.Errorf("syscall %v: result arg %v references result"+
+					" that is not produced by any call", c.Meta.Name, a.Type().Name()))
+			} else if producer > ci {
+				errs = append(errs, fmt.Errorf("syscall %v: result arg %v references result of a later call %v",
+					c.Meta.Name, a.Type().Name(), p.Calls[producer].Meta.Name))
+			} else if resultCycle(a) {
+				errs = append(errs, fmt.Errorf("syscall %v: result arg %v references itself",
+					c.Meta.Name, a.Type().Name()))
+			}
+			// Executor computes result/OpDiv+OpAdd truncated to the arg size.
+			// Large addends are wrap-around subtractions and are truncated by SerializeForExec,
+			// but a divisor that doesn't fit into the arg makes no sense.
+			if size := a.Size(); size < 8 && a.OpDiv>>(size*8) != 0 {
+				errs = append(errs, fmt.Errorf("syscall %v: result arg %v divisor 0x%x"+
+					" doesn't fit into %v bytes", c.Meta.Name, a.Type().Name(), a.OpDiv, size))
+			}
+		})
+		for i, arg := range c.Args {
+			if !all && len(errs) != 0 {
+				break
+			}
+			var err error
+			foreachSubarg(arg, func(arg, _ Arg, _ *[]Arg) {
+				if err == nil {
+					err = p.Target.checkExecGeometry(arg, dataOffset)
+				}
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("syscall %v: arg %v: %v", c.Meta.Name, i, err))
+			}
+		}
+	}
+	return errs
+}
+
+// resultCycle returns whether the chain of results referenced by arg leads back to arg.
+// Such in-place references within a single call would read a copyout
+// that is not initialized yet.
+func resultCycle(arg *ResultArg) bool {
+	visited := make(map[*ResultArg]bool)
+	for a := arg; a != nil; {
+		if visited[a] {
+			return true
+		}
+		visited[a] = true
+		a, _ = a.Res.(*ResultArg)
+	}
+	return false
+}
+
+// checkExecGeometry checks that arg fits into data region of the target,
+// e.g. a program created for a target with a larger data region does not.
+func (target *Target) checkExecGeometry(arg Arg, dataOffset uint64) error {
+	switch a := arg.(type) {
+	case *PointerArg:
+		if a.IsNull {
+			return nil
+		}
+		if a.PageIndex >= target.NumPages || a.PagesNum > target.NumPages-a.PageIndex {
+			return fmt.Errorf("pointer arg %v pages [%v, %v) are outside of data region of %v pages",
+				a.Type().Name(), a.PageIndex, a.PageIndex+a.PagesNum, target.NumPages)
+		}
+		if _, err := target.physicalAddr(arg, dataOffset); err != nil {
+			return err
+		}
+	case *DataArg:
+		if err := checkDataSize(a); err != nil {
+			return err
+		}
+		if size := a.Size(); size > target.NumPages*target.PageSize {
+			return fmt.Errorf("data arg %v has size %v larger than data region",
+				a.Type().Name(), size)
+		}
+	}
+	return nil
+}
+
+// checkDataSize checks that size of data arg matches size constraints of its type.
+func checkDataSize(arg *DataArg) error {
+	typ := arg.Type()
+	size := arg.Size()
+	if !typ.Varlen() && typ.Size() != size {
+		return fmt.Errorf("data arg %v has wrong size %v, want %v",
+			typ.Name(), size, typ.Size())
+	}
+	if t, ok := typ.(*BufferType); ok && t.Kind == BufferBlobRange &&
+		(size < t.RangeBegin || size > t.RangeEnd) {
+		return fmt.Errorf("data arg %v has wrong size %v, want [%v:%v]",
+			typ.Name(), size, t.RangeBegin, t.RangeEnd)
+	}
+	return nil
+}
+
+// execOrderChecker checks that copyouts of a call are emitted before copyins
+// of the following calls that overwrite the copied out memory. Executor performs
+// instructions in order, so otherwise it would capture the overwritten values.
+// It also checks that checksums of a call follow all its data copyins, because
+// executor calculates checksums at the point of copyin.
+// This catches bugs in options that reorder instructions.
+type execOrderChecker struct {
+	copyins []copyinRange // copyins emitted after the last call
+	call    bool          // a call was emitted
+	csum    bool          // a checksum was emitted after the last call
+}
+
+func (oc *execOrderChecker) reset() {
+	oc.copyins = oc.copyins[:0]
+	oc.call = false
+	oc.csum = false
+}
+
+// add checks the next instruction with all its words (without type IDs).
+func (oc *execOrderChecker) add(words []uint64) error {
+	switch kind := words[0]; {
+	case kind == ExecInstrCopyin && len(words) >= 4:
+		size := words[3]
+		if words[2] == ExecArgTypeConst {
+			size &^= ExecArgFlagBigEndian | ExecArgFlagPointer
+		}
+		if words[2] == ExecArgTypeDataCompressed && len(words) >= 5 {
+			size = words[4]
+		}
+		if words[2] == ExecArgTypeCsum {
+			oc.csum = true
+			break
+		}
+		if oc.csum {
+			return fmt.Errorf("data copyin to 0x%x follows checksum copyin", words[1])
+		}
+		if oc.call {
+			oc.copyins = append(oc.copyins, copyinRange{words[1], size})
+		}
+	case kind == ExecInstrCopyinFill && len(words) >= 3:
+		if oc.csum {
+			return fmt.Errorf("data copyin to 0x%x follows checksum copyin", words[1])
+		}
+		if oc.call {
+			oc.copyins = append(oc.copyins, copyinRange{words[1], words[2]})
+		}
+	case (kind == ExecInstrCopyout || kind == ExecInstrCopyoutData) && len(words) >= 4:
+		addr, size := words[2], words[3]
+		if kind == ExecInstrCopyout {
+			size &^= ExecCopyoutFlagOnSuccess
+		}
+		for _, r := range oc.copyins {
+			if addr < r.addr+r.size && r.addr < addr+size {
+				return fmt.Errorf("copyout %v of [0x%x, +%v) follows copyin of [0x%x, +%v) of the next call",
+					words[1], addr, size, r.addr, r.size)
+			}
+		}
+	case kind == ExecInstrBatchSep:
+		oc.reset()
+	case kind < execInstrMin:
+		oc.copyins = oc.copyins[:0]
+		oc.call = true
+		oc.csum = false
+	}
+	return nil
+}
+
+// checkExecOrder checks order of serialized instructions with execOrderChecker.
+func checkExecOrder(instrs []ExecInstr) error {
+	var oc execOrderChecker
+	for i, instr := range instrs {
+		if err := oc.add(instr.Words); err != nil {
+			return fmt.Errorf("instruction %v: %v", i, err)
+		}
+	}
+	return nil
+}
@@ -134,11 +134,18 @@ func generate(target *targets.Target, prg *compiler.Prog, consts map[string]uint
 	fmt.Fprintf(out, "package %v\n\n", target.OS)
 	fmt.Fprintf(out, "import . \"github.com/google/syzkaller/prog\"\n\n")
 
+	flags := ""
+	if target.BigEndian {
+		flags += " BigEndian: true,"
+	}
+	if target.ExecutorUsesVarint {
+		flags += " ExecVarint: true,"
+	}
 	fmt.Fprintf(out, "func init() {\n")
-	fmt.Fprintf(out, "\tRegisterTarget(&Target{OS: %q, Arch: %q, Revision: revision_%v, PtrSize: %v,"+
+	fmt.Fprintf(out, "\tRegisterTarget(&Target{OS: %q, Arch: %q, Revision: revision_%v, PtrSize: %v,%v"+
 		"Syscalls: syscalls_%v, Resources: resources_%v, Structs: structDescs_%v, Consts: consts_%v}, "+
 		"initTarget)\n",
-		target.OS, target.Arch, target.Arch, target.PtrSize,
+		target.OS, target.Arch, target.Arch, target.PtrSize, flags,
 		target.Arch, target.Arch, target.Arch, target.Arch)
 	fmt.Fprintf(out, "}\n\n")
 
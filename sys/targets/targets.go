@@ -8,6 +8,7 @@ type Target struct {
 	OS                 string
 	Arch               string
 	PtrSize            uint64
+	BigEndian          bool // not set for any target yet, see prog.Target.BigEndian
 	CArch              []string
 	CFlags             []string
 	CrossCFlags        []string
@@ -29,6 +30,9 @@ type os struct {
 	ExecutorUsesShmem bool
 	// If ExecutorUsesForkServer, executor uses extended protocol with handshake.
 	ExecutorUsesForkServer bool
+	// If ExecutorUsesVarint, programs are passed to executor in the compact varint encoding
+	// (see prog.Target.ExecVarint).
+	ExecutorUsesVarint bool
 }
 
 var List = map[string]map[string]*Target{
@@ -135,6 +139,7 @@ var oses = map[string]os{
 		SyscallPrefix:          "__NR_",
 		ExecutorUsesShmem:      true,
 		ExecutorUsesForkServer: true,
+		ExecutorUsesVarint:     true,
 	},
 	"freebsd": {
 		SyscallNumbers:         true,
@@ -34,6 +34,7 @@ var (
 	flagFaultCall = flag.Int("fault_call", -1, "inject fault into this call (0-based)")
 	flagFaultNth  = flag.Int("fault_nth", 0, "inject fault on n-th operation (0-based)")
 	flagHints     = flag.Bool("hints", false, "do a hints-generation run")
+	flagDumpExec  = flag.Bool("dump-exec", false, "print serialized exec representation of programs and exit")
 )
 
 func main() {
@@ -61,6 +62,10 @@ func main() {
 	if len(entries) == 0 {
 		return
 	}
+	if *flagDumpExec {
+		dumpExec(target, entries)
+		return
+	}
 
 	config, execOpts, err := ipc.DefaultConfig()
 	if err != nil {
@@ -220,3 +225,18 @@ func main() {
 	osutil.HandleInterrupts(shutdown)
 	wg.Wait()
 }
+
+func dumpExec(target *prog.Target, entries []*prog.LogEntry) {
+	buf := make([]byte, prog.ExecBufferSize)
+	for i, entry := range entries {
+		n, err := entry.P.SerializeForExec(buf, 0)
+		if err != nil {
+			Fatalf("failed to serialize program %v: %v", i, err)
+		}
+		text, err := target.DisassembleExec(buf[:n])
+		if err != nil {
+			Fatalf("failed to decode program %v: %v", i, err)
+		}
+		fmt.Printf("# program %v\n%v\n", i, text)
+	}
+}